@@ -0,0 +1,570 @@
+package soqchigfc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	"io"
+	"math"
+	"time"
+)
+
+// maxChartPoints je nejvyšší počet bodů v grafu, delší období se zhustí, aby graf zůstal čitelný
+const maxChartPoints = 120
+
+// errNoChartData vrací generování grafu, pokud nejsou hodnoty alespoň ze dvou dní
+var errNoChartData = errors.New("no data for chart")
+
+// dailyValue je souhrn hodnot za jeden den, X je půlnoc dne jako unix čas
+type dailyValue struct {
+	X             float64
+	Min, Max, Avg float64
+	// Interpolated je den bez naměřené hodnoty, dopočtený z okolních dní
+	Interpolated bool
+}
+
+// dailyValues seskupí hodnoty heartbeatů po dnech. Zařízení nemá Real Time Clock obvod a heartbeat
+// může chybět, takže dny bez hodnoty se lineárně dopočtou z okolních dní, aby graf neměl skoky.
+func dailyValues(data soqchi.Heartbeats, value func(h soqchi.Heartbeat) float64) []dailyValue {
+	var (
+		days  []dailyValue
+		count int
+		last  time.Time
+	)
+
+	for _, h := range data {
+		v := value(h)
+		day := startOfDay(h.At)
+
+		if l := len(days); l > 0 && day.Equal(last) {
+			d := &days[l-1]
+			d.Min = math.Min(d.Min, v)
+			d.Max = math.Max(d.Max, v)
+			count++
+			d.Avg += (v - d.Avg) / float64(count)
+			continue
+		}
+
+		if l := len(days); l > 0 {
+			prev := days[l-1]
+			var missing []time.Time
+			for d := last.AddDate(0, 0, 1); d.Before(day); d = d.AddDate(0, 0, 1) {
+				missing = append(missing, d)
+			}
+			for i, d := range missing {
+				k := float64(i+1) / float64(len(missing)+1)
+				iv := prev.Avg + (v-prev.Avg)*k
+				days = append(days, dailyValue{X: float64(d.Unix()), Min: iv, Max: iv, Avg: iv, Interpolated: true})
+			}
+		}
+
+		days = append(days, dailyValue{X: float64(day.Unix()), Min: v, Max: v, Avg: v})
+		count = 1
+		last = day
+	}
+	return days
+}
+
+// downsample sloučí sousední dny do nejvýše max bodů - bod nese minimum, maximum a průměr sloučených dní
+func downsample(days []dailyValue, max int) []dailyValue {
+	if len(days) <= max {
+		return days
+	}
+	size := (len(days) + max - 1) / max
+
+	result := make([]dailyValue, 0, max)
+	for i := 0; i < len(days); i += size {
+		end := i + size
+		if end > len(days) {
+			end = len(days)
+		}
+		b := days[i]
+		var sum float64
+		for _, d := range days[i:end] {
+			b.Min = math.Min(b.Min, d.Min)
+			b.Max = math.Max(b.Max, d.Max)
+			b.Interpolated = b.Interpolated && d.Interpolated
+			sum += d.Avg
+		}
+		b.Avg = sum / float64(end-i)
+		result = append(result, b)
+	}
+	return result
+}
+
+func startOfDay(t time.Time) time.Time {
+	return startOfDayIn(t, soqchi.TZ)
+}
+
+func startOfDayIn(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func roundUnix(t time.Time) float64 {
+	return float64(startOfDay(t).Unix())
+}
+
+func genTicks(min, max, step float64) []chart.Tick {
+	var ticks []chart.Tick
+	tmp := min
+	var format = "%.1f"
+	if step == math.Floor(step) {
+		format = "%.f"
+	}
+	for ; tmp <= max; tmp += step {
+		ticks = append(ticks, chart.Tick{
+			Value: tmp,
+			Label: fmt.Sprintf(format, tmp),
+		})
+	}
+	return ticks
+}
+
+// dailyChart sestaví graf s denními hodnotami - společný vzhled pro všechny grafy posílané botem
+func dailyChart(yTicks []chart.Tick, series ...chart.Series) chart.Chart {
+	graph := chart.Chart{
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    50,
+				Left:   10,
+				Right:  25,
+				Bottom: 10,
+			},
+			FillColor: drawing.ColorFromHex("eeeeee"),
+		},
+		XAxis: chart.XAxis{
+			Name:         "Time",
+			TickPosition: chart.TickPositionBetweenTicks,
+			ValueFormatter: func(v interface{}) string {
+				vf := v.(float64)
+				t := time.Unix(int64(vf), 0).In(soqchi.TZ)
+				return t.Format("02.01")
+			},
+		},
+
+		YAxis: chart.YAxis{
+			Name: " ",
+			NameStyle: chart.Style{
+				TextRotationDegrees: 270,
+			},
+			Style: chart.Style{
+				Padding:   chart.NewBox(10, 10, 10, 10),
+				FillColor: drawing.ColorFromHex("efefef"),
+			},
+
+			TickStyle: chart.Style{
+				TextRotationDegrees: 315,
+			},
+
+			Ticks: yTicks,
+		},
+
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+	return graph
+}
+
+func xValues(days []dailyValue) []float64 {
+	xs := make([]float64, len(days))
+	for i, d := range days {
+		xs[i] = d.X
+	}
+	return xs
+}
+
+func yValues(days []dailyValue, value func(d dailyValue) float64) []float64 {
+	ys := make([]float64, len(days))
+	for i, d := range days {
+		ys[i] = value(d)
+	}
+	return ys
+}
+
+// voltageChart vykreslí graf napětí baterie včetně odhadu, kdy napětí klesne pod limit
+func voltageChart(data soqchi.Heartbeats, limit float64, w io.Writer) error {
+	if len(data) == 0 {
+		return errNoChartData
+	}
+
+	var iMin int
+	for i, v := range data {
+		if data[iMin].Voltage >= v.Voltage {
+			iMin = i
+		}
+	}
+
+	days := downsample(dailyValues(data, func(h soqchi.Heartbeat) float64 { return h.Voltage }), maxChartPoints)
+	if len(days) < 2 {
+		return errNoChartData
+	}
+
+	series := []chart.Series{
+		chart.ContinuousSeries{
+			Name:    "Voltage",
+			YAxis:   chart.YAxisPrimary,
+			XValues: xValues(days),
+			Style: chart.Style{
+				StrokeColor: drawing.ColorFromHex("008800"),
+				FillColor:   drawing.ColorFromHex("CCFFCC"),
+			},
+			YValues: yValues(days, func(d dailyValue) float64 { return d.Avg }),
+		},
+	}
+	annotations := []chart.Value2{
+		{
+			XValue: roundUnix(data[iMin].At),
+			YValue: data[iMin].Voltage,
+			Label:  fmt.Sprintf("Min %.2fV", data[iMin].Voltage),
+		},
+	}
+
+	// odhad vývoje napětí se promítne nejvýše o délku zobrazeného období (aspoň o týden) dopředu
+	if f, ok := soqchi.PredictBattery(data, limit); ok && !f.LimitAt.IsZero() {
+		last := data[len(data)-1].At
+		horizon := last.Sub(data[0].At)
+		if horizon < 7*24*time.Hour {
+			horizon = 7 * 24 * time.Hour
+		}
+		end := f.LimitAt
+		if end.After(last.Add(horizon)) {
+			end = last.Add(horizon)
+		} else {
+			annotations = append(annotations, chart.Value2{
+				XValue: float64(end.Unix()),
+				YValue: limit,
+				Label:  fmt.Sprintf("%.1fV ~ %s", limit, end.In(soqchi.TZ).Format("02.01.")),
+			})
+		}
+		if end.After(last) {
+			series = append(series, chart.ContinuousSeries{
+				Name:    "Forecast",
+				YAxis:   chart.YAxisPrimary,
+				XValues: []float64{float64(last.Unix()), float64(end.Unix())},
+				YValues: []float64{f.Voltage(last), f.Voltage(end)},
+				Style: chart.Style{
+					StrokeColor:     drawing.ColorFromHex("cc6600"),
+					StrokeDashArray: []float64{5, 5},
+				},
+			})
+		}
+	}
+
+	series = append(series, chart.AnnotationSeries{
+		YAxis:       chart.YAxisPrimary,
+		Annotations: annotations,
+	})
+
+	graph := dailyChart(genTicks(1.5, 3.5, 0.5), series...)
+	return graph.Render(chart.PNG, w)
+}
+
+// temperatureChart vykreslí pásmo denních minimálních a maximálních teplot s denním průměrem. Dny
+// s mrazem jsou označeny tečkou na minimální teplotě, nejnižší teplota je popsána.
+func temperatureChart(data soqchi.Heartbeats, w io.Writer) error {
+	if len(data) == 0 {
+		return errNoChartData
+	}
+
+	days := downsample(dailyValues(data, func(h soqchi.Heartbeat) float64 { return h.Temperature }), maxChartPoints)
+	if len(days) < 2 {
+		return errNoChartData
+	}
+	xs := xValues(days)
+
+	lo, hi, iMin := math.MaxFloat64, -math.MaxFloat64, 0
+	var frostX, frostY []float64
+	for i, d := range days {
+		if d.Min < days[iMin].Min {
+			iMin = i
+		}
+		lo = math.Min(lo, d.Min)
+		hi = math.Max(hi, d.Max)
+		if d.Min <= 0 && !d.Interpolated {
+			frostX = append(frostX, d.X)
+			frostY = append(frostY, d.Min)
+		}
+	}
+
+	step := 5.0
+	if hi-lo > 40 {
+		step = 10
+	}
+	lo = math.Floor(lo/step) * step
+	hi = math.Ceil(hi/step) * step
+	if lo == hi {
+		hi += step
+	}
+
+	series := []chart.Series{
+		bandSeries{
+			Name:    "Min-Max",
+			XValues: xs,
+			Low:     yValues(days, func(d dailyValue) float64 { return d.Min }),
+			High:    yValues(days, func(d dailyValue) float64 { return d.Max }),
+			Style: chart.Style{
+				FillColor: drawing.ColorFromHex("ffe0cc"),
+			},
+		},
+		chart.ContinuousSeries{
+			Name:    "Max",
+			YAxis:   chart.YAxisPrimary,
+			XValues: xs,
+			YValues: yValues(days, func(d dailyValue) float64 { return d.Max }),
+			Style: chart.Style{
+				StrokeColor: drawing.ColorFromHex("cc3300"),
+			},
+		},
+		chart.ContinuousSeries{
+			Name:    "Min",
+			YAxis:   chart.YAxisPrimary,
+			XValues: xs,
+			YValues: yValues(days, func(d dailyValue) float64 { return d.Min }),
+			Style: chart.Style{
+				StrokeColor: drawing.ColorFromHex("0066cc"),
+			},
+		},
+		chart.ContinuousSeries{
+			Name:    "Avg",
+			YAxis:   chart.YAxisPrimary,
+			XValues: xs,
+			YValues: yValues(days, func(d dailyValue) float64 { return d.Avg }),
+			Style: chart.Style{
+				StrokeColor: drawing.ColorFromHex("333333"),
+				StrokeWidth: 2,
+			},
+		},
+	}
+
+	if lo < 0 {
+		series = append(series, chart.ContinuousSeries{
+			Name:    "0 °C",
+			YAxis:   chart.YAxisPrimary,
+			XValues: []float64{xs[0], xs[len(xs)-1]},
+			YValues: []float64{0, 0},
+			Style: chart.Style{
+				StrokeColor:     drawing.ColorFromHex("66aaff"),
+				StrokeDashArray: []float64{5, 5},
+			},
+		})
+	}
+	if len(frostX) > 0 {
+		series = append(series, chart.ContinuousSeries{
+			Name:    "Frost",
+			YAxis:   chart.YAxisPrimary,
+			XValues: frostX,
+			YValues: frostY,
+			Style: chart.Style{
+				StrokeWidth: chart.Disabled,
+				DotWidth:    4,
+				DotColor:    drawing.ColorFromHex("0033aa"),
+			},
+		})
+	}
+	series = append(series, chart.AnnotationSeries{
+		YAxis: chart.YAxisPrimary,
+		Annotations: []chart.Value2{
+			{
+				XValue: days[iMin].X,
+				YValue: days[iMin].Min,
+				Label:  fmt.Sprintf("Min %.1f°C", days[iMin].Min),
+			},
+		},
+	})
+
+	graph := dailyChart(genTicks(lo, hi, step), series...)
+	return graph.Render(chart.PNG, w)
+}
+
+// bandSeries vyplní pásmo mezi dolními a horními hodnotami (např. denní minimum a maximum).
+// ContinuousSeries umí vyplnit jen plochu k nule, což u záporných teplot nefunguje.
+type bandSeries struct {
+	Name      string
+	Style     chart.Style
+	XValues   []float64
+	Low, High []float64
+}
+
+func (bs bandSeries) GetName() string           { return bs.Name }
+func (bs bandSeries) GetStyle() chart.Style     { return bs.Style }
+func (bs bandSeries) GetYAxis() chart.YAxisType { return chart.YAxisPrimary }
+
+func (bs bandSeries) Validate() error {
+	if len(bs.XValues) != len(bs.Low) || len(bs.XValues) != len(bs.High) {
+		return fmt.Errorf("band series %s: values length mismatch", bs.Name)
+	}
+	return nil
+}
+
+func (bs bandSeries) Render(r chart.Renderer, canvasBox chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	if len(bs.XValues) == 0 {
+		return
+	}
+	style := bs.Style.InheritFrom(defaults)
+	style.GetFillOptions().WriteDrawingOptionsToRenderer(r)
+
+	point := func(x, y float64) (int, int) {
+		return canvasBox.Left + xrange.Translate(x), canvasBox.Bottom - yrange.Translate(y)
+	}
+
+	r.MoveTo(point(bs.XValues[0], bs.High[0]))
+	for i := 1; i < len(bs.XValues); i++ {
+		r.LineTo(point(bs.XValues[i], bs.High[i]))
+	}
+	for i := len(bs.XValues) - 1; i >= 0; i-- {
+		r.LineTo(point(bs.XValues[i], bs.Low[i]))
+	}
+	r.Close()
+	r.Fill()
+}
+
+// activityTimelineChart vykreslí časovou osu otevření dveří - pro každý den v intervalu <from, to)
+// sloupec s úseky, kdy byly dveře otevřené (osa Y je hodina dne v časové zóně loc)
+func activityTimelineChart(intervals []soqchi.DoorInterval, from, to time.Time, loc *time.Location, w io.Writer) error {
+	if len(intervals) == 0 {
+		return errNoChartData
+	}
+
+	graph := dailyChart(genTicks(0, 24, 6), intervalSeries{
+		Name:      "Open",
+		Intervals: intervals,
+		End:       to,
+		Location:  loc,
+		Style: chart.Style{
+			FillColor:   drawing.ColorFromHex("cc3300"),
+			StrokeColor: drawing.ColorFromHex("cc3300"),
+		},
+	})
+	graph.XAxis.Range = &chart.ContinuousRange{
+		Min: float64(startOfDayIn(from, loc).Unix()),
+		Max: float64(startOfDayIn(to, loc).AddDate(0, 0, 1).Unix()),
+	}
+	graph.XAxis.ValueFormatter = func(v interface{}) string {
+		return time.Unix(int64(v.(float64)), 0).In(loc).Format("02.01")
+	}
+	return graph.Render(chart.PNG, w)
+}
+
+// intervalSeries kreslí intervaly otevření jako obdélníky - X je den, Y hodina dne
+type intervalSeries struct {
+	Name      string
+	Style     chart.Style
+	Intervals []soqchi.DoorInterval
+	// End je konec dosud neuzavřeného intervalu
+	End      time.Time
+	Location *time.Location
+}
+
+func (is intervalSeries) GetName() string           { return is.Name }
+func (is intervalSeries) GetStyle() chart.Style     { return is.Style }
+func (is intervalSeries) GetYAxis() chart.YAxisType { return chart.YAxisPrimary }
+func (is intervalSeries) Validate() error           { return nil }
+
+func (is intervalSeries) Render(r chart.Renderer, canvasBox chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	style := is.Style.InheritFrom(defaults)
+	day := float64(24 * time.Hour / time.Second)
+
+	for _, i := range is.Intervals {
+		from, to := i.From.In(is.Location), i.To
+		if to.IsZero() || to.After(is.End) {
+			to = is.End
+		}
+		// interval přes půlnoc se rozdělí na úseky po dnech
+		for from.Before(to) {
+			start := startOfDayIn(from, is.Location)
+			end := start.AddDate(0, 0, 1)
+			if to.Before(end) {
+				end = to
+			}
+
+			x := float64(start.Unix())
+			box := chart.Box{
+				Left:   canvasBox.Left + xrange.Translate(x+0.15*day),
+				Right:  canvasBox.Left + xrange.Translate(x+0.85*day),
+				Top:    canvasBox.Bottom - yrange.Translate(end.Sub(start).Hours()),
+				Bottom: canvasBox.Bottom - yrange.Translate(from.Sub(start).Hours()),
+			}
+			// i krátké otevření musí být vidět
+			if box.Bottom-box.Top < 2 {
+				box.Top = box.Bottom - 2
+			}
+			chart.Draw.Box(r, box, style)
+			from = end
+		}
+	}
+}
+
+// heatmapWeekdays je pořadí dní v heatmapě - od pondělí
+var heatmapWeekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday,
+	time.Saturday, time.Sunday}
+
+// activityHeatmapChart vykreslí heatmapu počtu otevření dveří podle dne v týdnu a hodiny. weekdays
+// jsou popisky dní v týdnu od neděle (index dle time.Weekday).
+func activityHeatmapChart(h soqchi.ActivityHeatmap, weekdays []string, w io.Writer) error {
+	max := h.Max()
+	if max == 0 {
+		return errNoChartData
+	}
+
+	const (
+		width, height   = 1024, 400
+		left, top       = 50, 20
+		right, bottom   = 20, 40
+		cols, rows      = 24, 7
+		cellW, cellH    = (width - left - right) / cols, (height - top - bottom) / rows
+		fontSize        = 10.0
+		backgroundColor = "eeeeee"
+	)
+
+	r, err := chart.PNG(width, height)
+	if err != nil {
+		return err
+	}
+	font, err := chart.GetDefaultFont()
+	if err != nil {
+		return err
+	}
+	textStyle := chart.Style{Font: font, FontSize: fontSize, FontColor: drawing.ColorFromHex("333333")}
+
+	chart.Draw.Box(r, chart.Box{Right: width, Bottom: height}, chart.Style{FillColor: drawing.ColorFromHex(backgroundColor)})
+
+	low, high := drawing.ColorWhite, drawing.ColorFromHex("cc3300")
+	for row, wd := range heatmapWeekdays {
+		y := top + row*cellH
+		if int(wd) < len(weekdays) {
+			chart.Draw.Text(r, weekdays[wd], 15, y+cellH/2+4, textStyle)
+		}
+
+		for hour := 0; hour < cols; hour++ {
+			x := left + hour*cellW
+			n := h[wd][hour]
+			k := float64(n) / float64(max)
+			fill := drawing.Color{
+				R: uint8(float64(low.R) + (float64(high.R)-float64(low.R))*k),
+				G: uint8(float64(low.G) + (float64(high.G)-float64(low.G))*k),
+				B: uint8(float64(low.B) + (float64(high.B)-float64(low.B))*k),
+				A: 255,
+			}
+			chart.Draw.Box(r, chart.Box{Left: x, Top: y, Right: x + cellW - 1, Bottom: y + cellH - 1}, chart.Style{
+				FillColor:   fill,
+				StrokeColor: drawing.ColorFromHex(backgroundColor),
+				StrokeWidth: 1,
+			})
+			if n > 0 {
+				label := fmt.Sprintf("%d", n)
+				tb := chart.Draw.MeasureText(r, label, textStyle)
+				chart.Draw.Text(r, label, x+(cellW-tb.Width())/2, y+cellH/2+tb.Height()/2, textStyle)
+			}
+		}
+	}
+	for hour := 0; hour < cols; hour += 2 {
+		chart.Draw.Text(r, fmt.Sprintf("%d", hour), left+hour*cellW+cellW/2-4, height-bottom+20, textStyle)
+	}
+
+	return r.Save(w)
+}
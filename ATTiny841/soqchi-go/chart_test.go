@@ -0,0 +1,77 @@
+package soqchigfc
+
+import (
+	"bytes"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"testing"
+	"time"
+)
+
+func TestDailyValues(t *testing.T) {
+	day := time.Date(2022, 1, 10, 0, 0, 0, 0, soqchi.TZ)
+	data := soqchi.Heartbeats{
+		{At: day.Add(8 * time.Hour), Temperature: -2},
+		{At: day.Add(20 * time.Hour), Temperature: 4},
+		// 11. a 12. den chybí
+		{At: day.AddDate(0, 0, 3).Add(9 * time.Hour), Temperature: 7},
+	}
+
+	days := dailyValues(data, func(h soqchi.Heartbeat) float64 { return h.Temperature })
+	if len(days) != 4 {
+		t.Fatalf("expected 4 days, got %#v", days)
+	}
+	if d := days[0]; d.Min != -2 || d.Max != 4 || d.Avg != 1 || d.Interpolated {
+		t.Errorf("unexpected first day %#v", d)
+	}
+	if d := days[1]; !d.Interpolated || d.Avg != 3 || d.X != float64(day.AddDate(0, 0, 1).Unix()) {
+		t.Errorf("unexpected interpolated day %#v", d)
+	}
+	if d := days[2]; !d.Interpolated || d.Avg != 5 {
+		t.Errorf("unexpected interpolated day %#v", d)
+	}
+	if d := days[3]; d.Avg != 7 || d.Interpolated {
+		t.Errorf("unexpected last day %#v", d)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	var days []dailyValue
+	for i := 0; i < 10; i++ {
+		days = append(days, dailyValue{X: float64(i), Min: float64(-i), Max: float64(i), Avg: float64(i)})
+	}
+
+	if got := downsample(days, 20); len(got) != 10 {
+		t.Errorf("short series should stay untouched, got %d points", len(got))
+	}
+
+	got := downsample(days, 4)
+	if len(got) != 4 {
+		t.Fatalf("expected 4 points, got %#v", got)
+	}
+	if b := got[0]; b.X != 0 || b.Min != -2 || b.Max != 2 || b.Avg != 1 {
+		t.Errorf("unexpected first bucket %#v", b)
+	}
+	if b := got[3]; b.X != 9 || b.Min != -9 || b.Max != 9 || b.Avg != 9 {
+		t.Errorf("unexpected last bucket %#v", b)
+	}
+}
+
+func TestTemperatureChart(t *testing.T) {
+	if err := temperatureChart(nil, &bytes.Buffer{}); err != errNoChartData {
+		t.Errorf("expected errNoChartData, got %v", err)
+	}
+
+	var data soqchi.Heartbeats
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, soqchi.TZ)
+	for i := 0; i < 10; i++ {
+		data = append(data, soqchi.Heartbeat{At: start.AddDate(0, 0, i), Temperature: float64(i) - 4, Voltage: 3})
+	}
+
+	var png bytes.Buffer
+	if err := temperatureChart(data, &png); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(png.Bytes(), []byte("\x89PNG")) {
+		t.Error("expected PNG image")
+	}
+}
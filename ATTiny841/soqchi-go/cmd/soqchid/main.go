@@ -0,0 +1,96 @@
+// soqchid je samostatný server, který provozuje všechny cloudové funkce soqchi bez Google Cloudu.
+// HTTP funkce Device a TelegramHTTPReceiver běží na běžném HTTP serveru, Watchdog spouští vnitřní
+// plánovač a zprávy pro PlainTelegramMessage i události pro DeviceEvent jdou přes frontu v procesu
+// místo Google Pub/Sub.
+package main
+
+import (
+	gps "cloud.google.com/go/pubsub"
+	"context"
+	"flag"
+	"github.com/ISim/Arduino/soqchigfc"
+	"github.com/ISim/Arduino/soqchigfc/cron"
+	"github.com/ISim/Arduino/soqchigfc/pubsub"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		addr            = flag.String("addr", ":8080", "HTTP listen address")
+		watchdogSpec    = flag.String("watchdog", "0 8 * * *", "watchdog schedule as cron expression (Europe/Prague)")
+		queueSize       = flag.Int("queue", 100, "size of in-process message queue")
+		shutdownTimeout = flag.Duration("shutdown-timeout", 20*time.Second, "graceful shutdown timeout")
+	)
+	flag.Parse()
+
+	schedule, err := cron.Parse(*watchdogSpec)
+	if err != nil {
+		log.Fatalf("invalid watchdog schedule: %s", err.Error())
+	}
+
+	queue := pubsub.NewQueue(*queueSize)
+	queue.Subscribe(soqchi.PlainMessageTopic, func(ctx context.Context, data []byte) error {
+		return soqchigfc.PlainTelegramMessage(ctx, gps.Message{Data: data})
+	})
+	queue.Subscribe(soqchi.EventTopic, func(ctx context.Context, data []byte) error {
+		return soqchigfc.DeviceEvent(ctx, gps.Message{Data: data})
+	})
+	pubsub.UseQueue(queue)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", soqchigfc.Device)
+	mux.HandleFunc("/telegram", soqchigfc.TelegramHTTPReceiver)
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: mux,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go queue.Run(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cron.Run(ctx, schedule, soqchi.TZ, func(ctx context.Context) {
+			if err := soqchigfc.Watchdog(ctx, gps.Message{}); err != nil {
+				log.Printf("watchdog failed: %s", err.Error())
+			}
+		})
+	}()
+
+	go func() {
+		log.Printf("listening on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("http server failed: %s", err.Error())
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	s := <-sig
+	log.Printf("%s received, shutting down", s)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancelShutdown()
+
+	// nejdřív se přestanou přijímat nové požadavky a plánovat watchdog, pak se doručí zprávy z fronty
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http server shutdown failed: %s", err.Error())
+	}
+	cancel()
+	wg.Wait()
+	if err := queue.Close(shutdownCtx); err != nil {
+		log.Printf("message queue shutdown failed: %s", err.Error())
+	}
+}
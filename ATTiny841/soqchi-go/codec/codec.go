@@ -0,0 +1,80 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verzi formátu payloadu určují bity 1-4 prvního bajtu (příznaků). Původní firmware tyto bity
+// nepoužívá a posílá je nulové, proto verze 0 odpovídá ASCII formátu V1.
+const (
+	versionMask  byte = 0x1e
+	versionShift      = 1
+
+	// MaxPayload je maximální délka Sigfox uplink zprávy
+	MaxPayload = 12
+)
+
+const (
+	V1 = iota
+	V2
+)
+
+var ErrEmptyPayload = errors.New("empty payload")
+
+// Payload jsou dekódovaná data zprávy ze zařízení
+type Payload struct {
+	Flags   byte
+	Version int
+
+	Temperature float64
+	Voltage     float64
+
+	// jen V2
+	Firmware      int
+	BootCount     int
+	DoorOpenCount int
+}
+
+// Codec převádí payload mezi bajty ze Sigfoxu a strukturou Payload
+type Codec interface {
+	Decode(raw []byte) (*Payload, error)
+	Encode(p *Payload) ([]byte, error)
+}
+
+var codecs = map[int]Codec{
+	V1: v1{},
+	V2: v2{},
+}
+
+// Version vrací verzi formátu payloadu dle prvního bajtu
+func Version(flags byte) int {
+	return int(flags&versionMask) >> versionShift
+}
+
+// WithVersion vrací příznaky s nastavenou verzí formátu
+func WithVersion(flags byte, version int) byte {
+	return flags&^versionMask | byte(version<<versionShift)&versionMask
+}
+
+// Decode dekóduje payload kodekem dle verze v prvním bajtu
+func Decode(raw []byte) (*Payload, error) {
+	if len(raw) == 0 {
+		return nil, ErrEmptyPayload
+	}
+	v := Version(raw[0])
+	c, ok := codecs[v]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload version %d", v)
+	}
+	return c.Decode(raw)
+}
+
+// Encode zakóduje payload kodekem dle p.Version
+func Encode(p *Payload) ([]byte, error) {
+	c, ok := codecs[p.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload version %d", p.Version)
+	}
+	return c.Encode(p)
+}
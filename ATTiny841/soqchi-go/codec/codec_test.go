@@ -0,0 +1,130 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		exp  Payload
+		err  bool
+	}{
+		{
+			name: "v1 heartbeat",
+			raw:  []byte{0x00, 0x32, 0x36, 0x31, 0x35, 0x38, 0x32, 0x35},
+			exp:  Payload{Flags: 0x00, Version: V1, Temperature: 26.1, Voltage: 5.825},
+		},
+		{
+			name: "v1 negative temperature",
+			raw:  []byte("\x20-502950"),
+			exp:  Payload{Flags: 0x20, Version: V1, Temperature: -5, Voltage: 2.95},
+		},
+		{
+			name: "v1 alarm without data",
+			raw:  []byte{0x81},
+			exp:  Payload{Flags: 0x81, Version: V1},
+		},
+		{
+			name: "v1 garbage values",
+			raw:  []byte("\x40x1y2z"),
+			exp:  Payload{Flags: 0x40, Version: V1},
+		},
+		{
+			name: "v2 heartbeat",
+			raw:  []byte{0x22, 0xff, 0x9c, 0x0b, 0x86, 0x03, 0x00, 0x07, 0x01, 0x2c},
+			exp:  Payload{Flags: 0x22, Version: V2, Temperature: -10, Voltage: 2.95, Firmware: 3, BootCount: 7, DoorOpenCount: 300},
+		},
+		{
+			name: "v2 alarm without data",
+			raw:  []byte{0x83},
+			exp:  Payload{Flags: 0x83, Version: V2},
+		},
+		{
+			name: "v2 truncated",
+			raw:  []byte{0x22, 0xff, 0x9c},
+			err:  true,
+		},
+		{
+			name: "unknown version",
+			raw:  []byte{0x1e, 0x00},
+			err:  true,
+		},
+		{
+			name: "empty",
+			raw:  nil,
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		p, err := Decode(tc.raw)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if *p != tc.exp {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.exp, *p)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Payload
+		exp  []byte
+		err  bool
+	}{
+		{
+			name: "v1 heartbeat",
+			p:    Payload{Version: V1, Temperature: 26.1, Voltage: 5.825},
+			exp:  []byte{0x00, 0x32, 0x36, 0x31, 0x35, 0x38, 0x32, 0x35},
+		},
+		{
+			name: "v1 temperature out of range",
+			p:    Payload{Version: V1, Temperature: 105},
+			err:  true,
+		},
+		{
+			name: "v2 heartbeat",
+			p:    Payload{Flags: 0x20, Version: V2, Temperature: -10, Voltage: 2.95, Firmware: 3, BootCount: 7, DoorOpenCount: 300},
+			exp:  []byte{0x22, 0xff, 0x9c, 0x0b, 0x86, 0x03, 0x00, 0x07, 0x01, 0x2c},
+		},
+		{
+			name: "v2 counter out of range",
+			p:    Payload{Version: V2, BootCount: 70000},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		raw, err := Encode(&tc.p)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(raw, tc.exp) {
+			t.Errorf("%s: expected % x, got % x", tc.name, tc.exp, raw)
+		}
+
+		p, err := Decode(raw)
+		if err != nil || p.Temperature != tc.p.Temperature || p.Voltage != tc.p.Voltage {
+			t.Errorf("%s: round trip failed: %+v, %v", tc.name, p, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package codec
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// v1 je původní formát: příznaky, 3 ASCII číslice teploty v desetinách °C a ASCII číslice napětí
+// v milivoltech (např. "261" "5825" = 26.1 °C, 5.825 V). Zprávy bez teploty a napětí (např. alarm)
+// obsahují jen příznaky. Nečitelné hodnoty se dekódují jako nula, aby se kvůli nim neztratil alarm.
+type v1 struct{}
+
+func (v1) Decode(raw []byte) (*Payload, error) {
+	if len(raw) == 0 {
+		return nil, ErrEmptyPayload
+	}
+	p := &Payload{Flags: raw[0], Version: V1}
+	if len(raw) < 4 {
+		return p, nil
+	}
+
+	if t, err := strconv.Atoi(string(raw[1:4])); err == nil {
+		p.Temperature = float64(t) / 10
+	}
+	if v, err := strconv.Atoi(string(raw[4:])); err == nil {
+		p.Voltage = float64(v) / 1000
+	}
+	return p, nil
+}
+
+func (v1) Encode(p *Payload) ([]byte, error) {
+	t := fmt.Sprintf("%03d", round(p.Temperature*10))
+	if len(t) != 3 {
+		return nil, fmt.Errorf("temperature %.1f out of V1 range", p.Temperature)
+	}
+	raw := append([]byte{WithVersion(p.Flags, V1)}, t...)
+	raw = append(raw, strconv.Itoa(round(p.Voltage*1000))...)
+	if len(raw) > MaxPayload {
+		return nil, fmt.Errorf("voltage %.3f out of V1 range", p.Voltage)
+	}
+	return raw, nil
+}
+
+func round(f float64) int {
+	if f < 0 {
+		return int(f - 0.5)
+	}
+	return int(f + 0.5)
+}
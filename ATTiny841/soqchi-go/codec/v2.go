@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// v2 je binární formát (big endian):
+//
+//	0     příznaky (verze 1 v bitech 1-4)
+//	1-2   teplota v desetinách °C, int16
+//	3-4   napětí v mV, uint16
+//	5     verze firmware
+//	6-7   počet startů zařízení, uint16
+//	8-9   počet otevření dveří, uint16
+//
+// Zprávy bez dat (např. alarm) mohou obsahovat jen příznaky.
+type v2 struct{}
+
+const v2Length = 10
+
+func (v2) Decode(raw []byte) (*Payload, error) {
+	if len(raw) == 0 {
+		return nil, ErrEmptyPayload
+	}
+	p := &Payload{Flags: raw[0], Version: V2}
+	if len(raw) == 1 {
+		return p, nil
+	}
+	if len(raw) < v2Length {
+		return nil, fmt.Errorf("V2 payload too short (%d bytes)", len(raw))
+	}
+
+	p.Temperature = float64(int16(binary.BigEndian.Uint16(raw[1:3]))) / 10
+	p.Voltage = float64(binary.BigEndian.Uint16(raw[3:5])) / 1000
+	p.Firmware = int(raw[5])
+	p.BootCount = int(binary.BigEndian.Uint16(raw[6:8]))
+	p.DoorOpenCount = int(binary.BigEndian.Uint16(raw[8:10]))
+	return p, nil
+}
+
+func (v2) Encode(p *Payload) ([]byte, error) {
+	t := round(p.Temperature * 10)
+	mv := round(p.Voltage * 1000)
+	switch {
+	case t < math.MinInt16 || t > math.MaxInt16:
+		return nil, fmt.Errorf("temperature %.1f out of V2 range", p.Temperature)
+	case mv < 0 || mv > math.MaxUint16:
+		return nil, fmt.Errorf("voltage %.3f out of V2 range", p.Voltage)
+	case p.Firmware < 0 || p.Firmware > math.MaxUint8:
+		return nil, fmt.Errorf("firmware version %d out of V2 range", p.Firmware)
+	case p.BootCount < 0 || p.BootCount > math.MaxUint16 || p.DoorOpenCount < 0 || p.DoorOpenCount > math.MaxUint16:
+		return nil, fmt.Errorf("counter out of V2 range")
+	}
+
+	raw := make([]byte, v2Length)
+	raw[0] = WithVersion(p.Flags, V2)
+	binary.BigEndian.PutUint16(raw[1:3], uint16(int16(t)))
+	binary.BigEndian.PutUint16(raw[3:5], uint16(mv))
+	raw[5] = byte(p.Firmware)
+	binary.BigEndian.PutUint16(raw[6:8], uint16(p.BootCount))
+	binary.BigEndian.PutUint16(raw[8:10], uint16(p.DoorOpenCount))
+	return raw, nil
+}
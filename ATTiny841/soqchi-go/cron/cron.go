@@ -0,0 +1,157 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule je rozparsovaný cron výraz ve tvaru "minuta hodina den měsíc den-v-týdnu". Každé pole
+// může být "*", číslo, rozsah "a-b", seznam "a,b,c" a krok "*/n" nebo "a-b/n". Den v týdnu
+// 0 i 7 je neděle.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny a dowAny určují, zda je den v měsíci resp. v týdnu "*" - pokud jsou omezené oba,
+	// stačí, aby platil jeden z nich (stejně jako v klasickém cronu)
+	domAny, dowAny bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse rozparsuje cron výraz
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron %q: expected %d fields, got %d", spec, len(fields), len(parts))
+	}
+
+	var bits [5]uint64
+	for i, p := range parts {
+		b, err := parseField(p, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// neděle může být zadána jako 0 i 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+			rng, step = item[:i], n
+		}
+
+		from, to := f.min, f.max
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				from, err = strconv.Atoi(rng[:i])
+				if err == nil {
+					to, err = strconv.Atoi(rng[i+1:])
+				}
+			} else {
+				from, err = strconv.Atoi(rng)
+				to = from
+				if step > 1 {
+					to = f.max
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s %q", f.name, item)
+			}
+		}
+		if from < f.min || to > f.max || from > to {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", f.name, item, f.min, f.max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next vrací nejbližší čas po t, který vyhovuje výrazu. Počítá se v časové zóně t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// omezení pro výrazy, které nikdy nenastanou (např. 30. února)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Run volá job v časech daných rozvrhem (v časové zóně loc), dokud není ctx ukončen.
+// Další spuštění se plánuje až po doběhnutí jobu, běhy se tedy nepřekrývají.
+func Run(ctx context.Context, s *Schedule, loc *time.Location, job func(ctx context.Context)) {
+	for {
+		next := s.Next(time.Now().In(loc))
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			job(ctx)
+		}
+	}
+}
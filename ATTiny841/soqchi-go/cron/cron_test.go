@@ -0,0 +1,46 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 20.2.2022 je neděle
+	from := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2022, 2, 20, 10, 31, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2022, 2, 21, 8, 0, 0, 0, time.UTC)},
+		{"45 10 * * *", time.Date(2022, 2, 20, 10, 45, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, 2, 20, 10, 45, 0, 0, time.UTC)},
+		{"0 9-12 * * 2", time.Date(2022, 2, 22, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2022, 2, 20, 12, 0, 0, 0, time.UTC)},
+		{"0 12 1,15 * 1", time.Date(2022, 2, 21, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tc := range tests {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tc.exp) {
+			t.Errorf("%q: expected %s, got %s", tc.spec, tc.exp, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
@@ -5,6 +5,9 @@ export GOOGLE_APPLICATION_CREDENTIALS=iot-oisw-316feba13ec0.json
 gcloud functions deploy PlainTelegramMessage  \
   --env-vars-file gcf_soqchi.env.yaml --region europe-west3 --runtime go116 --trigger-topic PlainMessage2Telegram
 
+gcloud functions deploy DeviceEvent  \
+  --env-vars-file gcf_soqchi.env.yaml --region europe-west3 --runtime go116 --trigger-topic DeviceEvents
+
 gcloud functions deploy Watchdog  \
   --env-vars-file gcf_soqchi.env.yaml --region europe-west3 --runtime go116 --trigger-topic watchdog
 
@@ -1,7 +1,22 @@
 package firestore
 
+import "time"
+
 const (
 	collectionDevices = "devices"
+	collectionUnclaimed = "unclaimed"
 	collectionChats = "chats"
 	collectionHeartbeats = "Heartbeats"
+	collectionMessages = "Messages"
+	collectionFrames = "Frames"
+	collectionInvites = "invites"
+	collectionAlerts = "Alerts"
+	collectionSubscriptions = "Subscriptions"
+	collectionChatSettings = "chatSettings"
 )
+
+// frameRetention je doba, po kterou se drží evidence framů pro odhalení duplicit
+const frameRetention = 7 * 24 * time.Hour
+
+// heartbeatLimit je počet posledních heartbeatů, které vrací DeviceInfo
+const heartbeatLimit = 60
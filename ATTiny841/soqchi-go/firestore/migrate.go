@@ -0,0 +1,66 @@
+package firestore
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// collectionMigrations eviduje provedené jednorázové úpravy dat, ID dokumentu je název úpravy
+	collectionMigrations = "migrations"
+	// migrationChatID je doplnění atributu ChatID do dokumentů chats
+	migrationChatID = "chatID"
+)
+
+// migrateOnce zajistí, že instance funkce kontroluje úpravy dat jen při prvním vytvoření klienta
+var migrateOnce sync.Once
+
+// migrate provede jednorázové úpravy dat. Chyba se jen zaloguje - úprava se zopakuje v další instanci.
+func (c *Client) migrate(ctx context.Context) {
+	migrateOnce.Do(func() {
+		if err := c.backfillChatIDs(ctx); err != nil {
+			log.Printf("migration %s failed: %s", migrationChatID, err.Error())
+		}
+	})
+}
+
+// backfillChatIDs doplní atribut ChatID dokumentům chats založeným před jeho zavedením, bez něj by je
+// dotaz v ChatDevices nenašel. Po doplnění se uloží značka, další instance už dokumenty neprochází.
+func (c *Client) backfillChatIDs(ctx context.Context) error {
+	marker := c.c.Collection(collectionMigrations).Doc(migrationChatID)
+	_, err := marker.Get(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case status.Code(err) != codes.NotFound:
+		return err
+	}
+
+	docs, err := c.c.CollectionGroup(collectionChats).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("can't retrieve chats: %w", err)
+	}
+	for _, doc := range docs {
+		var ch Chat
+		if err := doc.DataTo(&ch); err != nil {
+			return fmt.Errorf("chat %s decoding failed: %w", doc.Ref.Path, err)
+		}
+		id, err := strconv.ParseInt(doc.Ref.ID, 10, 64)
+		if ch.ChatID != 0 || err != nil {
+			continue
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "ChatID", Value: id}}); err != nil {
+			return fmt.Errorf("can't update chat %s: %w", doc.Ref.Path, err)
+		}
+	}
+
+	_, err = marker.Set(ctx, map[string]interface{}{"DoneAt": time.Now()})
+	return err
+}
@@ -3,11 +3,14 @@ package firestore
 import (
 	"cloud.google.com/go/firestore"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -16,9 +19,13 @@ type Client struct {
 	c *firestore.Client
 }
 
+// Chat je přihlášení chatu k zařízení, ID dokumentu je ID chatu. ChatID je v dokumentu kvůli dotazu
+// přes všechna zařízení (ChatDevices).
 type Chat struct {
+	ChatID    int64
 	Username  string
 	CreatedAt time.Time
+	Pending   bool
 }
 
 type Device struct {
@@ -28,6 +35,54 @@ type Device struct {
 	LastHeartbeatAt time.Time
 	AccessAllowed   bool
 	Voltage         float64
+
+	AccessAllowedUntil time.Time
+	AccessWindows      []AccessWindow
+	TimeZone           string
+	OwnerChatID        int64
+	Thresholds         Thresholds
+}
+
+// Thresholds jsou limity zařízení, nulové hodnoty a nil znamenají výchozí hodnoty
+type Thresholds struct {
+	HeartbeatInterval time.Duration
+	HeartbeatGrace    time.Duration
+	VoltageLow        float64
+	VoltageCritical   float64
+	TempMin           *float64
+	TempMax           *float64
+	TempHysteresis    float64
+}
+
+type AccessWindow struct {
+	Weekday int
+	From    int
+	To      int
+	Note    string
+}
+
+// Alert je stav upozornění na podmínku zařízení, ID dokumentu je název podmínky
+type Alert struct {
+	Firing     bool
+	Since      time.Time
+	NotifiedAt time.Time
+	ResolvedAt time.Time
+}
+
+// Subscription je odběr zpráv ze zařízení v dalším kanálu, ID dokumentu je hash kanálu a adresy
+// (adresa může obsahovat znaky, které v ID dokumentu být nesmí)
+type Subscription struct {
+	Channel   string
+	Address   string
+	Secret    string
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// ChatSettings je nastavení chatu, ID dokumentu je ID chatu
+type ChatSettings struct {
+	Lang     string
+	TimeZone string
 }
 
 type Heartbeat struct {
@@ -36,15 +91,71 @@ type Heartbeat struct {
 	Temp       float64
 }
 
+type Message struct {
+	ReceivedAt time.Time
+	Raw        string
+	Flags      int
+	Ack        bool
+	Voltage    float64
+	Temp       float64
+	Downlink   string
+
+	Version       int
+	Firmware      int
+	BootCount     int
+	DoorOpenCount int
+
+	SeqNumber   *int
+	RSSI        float64
+	SNR         float64
+	AvgSNR      float64
+	Station     string
+	LinkQuality string
+}
+
+type Unclaimed struct {
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	Count       int
+	LastRaw     string
+}
+
+type Frame struct {
+	ReceivedAt time.Time
+	// ExpireAt je určen pro TTL politiku Firestore, starší záznamy už nejsou k ničemu
+	ExpireAt time.Time
+}
+
+type Invite struct {
+	DeviceID   string
+	CreatedBy  int64
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedBy     int64
+	UsedByName string
+	UsedAt     time.Time
+	RevokedAt  time.Time
+}
+
 func New(ctx context.Context) (*Client, error) {
 	c, err := app.Firestore(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{c: c}, nil
+	client := &Client{c: c}
+	client.migrate(ctx)
+	return client, nil
 }
 
 func (c *Client) AddUser(ctx context.Context, deviceID string, chatID int64, username string) error {
+	return c.addUser(ctx, deviceID, chatID, username, false)
+}
+
+func (c *Client) AddPendingUser(ctx context.Context, deviceID string, chatID int64, username string) error {
+	return c.addUser(ctx, deviceID, chatID, username, true)
+}
+
+func (c *Client) addUser(ctx context.Context, deviceID string, chatID int64, username string, pending bool) error {
 	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
@@ -53,13 +164,110 @@ func (c *Client) AddUser(ctx context.Context, deviceID string, chatID int64, use
 		return err
 	}
 
-	_, err = c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionChats).Doc(fmt.Sprintf("%d", chatID)).Set(ctx, Chat{
+	_, err = c.chatRef(deviceID, chatID).Set(ctx, Chat{
+		ChatID:    chatID,
 		Username:  username,
 		CreatedAt: time.Now(),
+		Pending:   pending,
 	})
 	return err
 }
 
+func (c *Client) ApproveUser(ctx context.Context, deviceID string, chatID int64) (bool, error) {
+	ch, err := c.Chat(ctx, deviceID, chatID)
+	if err != nil || ch == nil || !ch.Pending {
+		return false, err
+	}
+	_, err = c.chatRef(deviceID, chatID).Update(ctx, []firestore.Update{{Path: "Pending", Value: false}})
+	return err == nil, err
+}
+
+func (c *Client) RemoveUser(ctx context.Context, deviceID string, chatID int64) error {
+	devRef := c.c.Collection(collectionDevices).Doc(deviceID)
+	return c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		d, err := tx.Get(devRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var dev Device
+			if err := d.DataTo(&dev); err != nil {
+				return err
+			}
+			if dev.OwnerChatID == chatID {
+				if err := tx.Update(devRef, []firestore.Update{{Path: "OwnerChatID", Value: 0}}); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Delete(c.chatRef(deviceID, chatID))
+	})
+}
+
+func (c *Client) ClaimOwnership(ctx context.Context, deviceID string, chatID int64, username string) (bool, error) {
+	devRef := c.c.Collection(collectionDevices).Doc(deviceID)
+	var claimed bool
+
+	err := c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		d, err := tx.Get(devRef)
+		if err != nil {
+			return err
+		}
+		var dev Device
+		if err := d.DataTo(&dev); err != nil {
+			return err
+		}
+		if dev.OwnerChatID != 0 {
+			return nil
+		}
+
+		chats, err := tx.Documents(devRef.Collection(collectionChats)).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range chats {
+			var ch Chat
+			if err := doc.DataTo(&ch); err == nil && !ch.Pending {
+				return nil
+			}
+		}
+
+		if err := tx.Update(devRef, []firestore.Update{{Path: "OwnerChatID", Value: chatID}}); err != nil {
+			return err
+		}
+		claimed = true
+		return tx.Set(c.chatRef(deviceID, chatID), Chat{
+			ChatID:    chatID,
+			Username:  username,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't claim ownership of device %s: %w", deviceID, err)
+	}
+	return claimed, nil
+}
+
+func (c *Client) Chat(ctx context.Context, deviceID string, chatID int64) (*soqchi.Chat, error) {
+	d, err := c.chatRef(deviceID, chatID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ch Chat
+	if err := d.DataTo(&ch); err != nil {
+		return nil, err
+	}
+	return &soqchi.Chat{ID: chatID, Username: ch.Username, CreatedAt: ch.CreatedAt, Pending: ch.Pending}, nil
+}
+
+func (c *Client) chatRef(deviceID string, chatID int64) *firestore.DocumentRef {
+	return c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionChats).Doc(fmt.Sprintf("%d", chatID))
+}
+
 func (c *Client) Device(ctx context.Context, deviceID string) (*soqchi.Device, error) {
 	d, err := c.c.Collection(collectionDevices).Doc(deviceID).Get(ctx)
 	if err != nil {
@@ -72,6 +280,28 @@ func (c *Client) Device(ctx context.Context, deviceID string) (*soqchi.Device, e
 	return unwrapDevice(d)
 }
 
+func (c *Client) SetAccess(ctx context.Context, deviceID string, allowed bool, until time.Time) error {
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Update(ctx, []firestore.Update{
+		{Path: "AccessAllowed", Value: allowed}, {Path: "AccessAllowedUntil", Value: until}})
+	return err
+}
+
+func (c *Client) SetAccessWindows(ctx context.Context, deviceID string, windows soqchi.AccessSchedule) error {
+	var ws []AccessWindow
+	for _, w := range windows {
+		ws = append(ws, AccessWindow{Weekday: int(w.Weekday), From: w.From, To: w.To, Note: w.Note})
+	}
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Update(ctx, []firestore.Update{
+		{Path: "AccessWindows", Value: ws}})
+	return err
+}
+
+func (c *Client) SetThresholds(ctx context.Context, deviceID string, t soqchi.Thresholds) error {
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Update(ctx, []firestore.Update{
+		{Path: "Thresholds", Value: Thresholds(t)}})
+	return err
+}
+
 func (c *Client) AllChats(ctx context.Context, deviceID string) ([]int64, error) {
 	iter := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionChats).Documents(ctx)
 	var chats []int64
@@ -83,6 +313,11 @@ func (c *Client) AllChats(ctx context.Context, deviceID string) ([]int64, error)
 		if err != nil {
 			return nil, fmt.Errorf("retrieve all chats failed: %w", err)
 		}
+		// neschválené žádosti o přihlášení zprávy nedostávají
+		var ch Chat
+		if err := doc.DataTo(&ch); err != nil || ch.Pending {
+			continue
+		}
 		if id, err := strconv.ParseInt(doc.Ref.ID, 10, 64); err == nil {
 			chats = append(chats, id)
 		}
@@ -113,13 +348,214 @@ func (c *Client) SaveTimestamp(ctx context.Context, deviceID string, t time.Time
 	return err
 }
 
-func (c *Client) DeviceInfo(ctx context.Context, deviceID string) (*soqchi.DeviceInfo, error) {
-	it := c.c.Collection("devices").Doc(deviceID).Collection("Heartbeats").
-		OrderBy("ReceivedAt", firestore.Asc).Limit(60).Documents(ctx)
+func (c *Client) RegisterFrame(ctx context.Context, deviceID, key string, at time.Time) (bool, error) {
+	// Create selže, pokud dokument již existuje - zaevidovat frame tak uspěje jen jednou
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionFrames).Doc(key).Create(ctx, Frame{
+		ReceivedAt: at,
+		ExpireAt:   at.Add(frameRetention),
+	})
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) ReleaseFrame(ctx context.Context, deviceID, key string) error {
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionFrames).Doc(key).Delete(ctx)
+	return err
+}
+
+func (c *Client) SaveUnclaimed(ctx context.Context, msg *soqchi.Message) (bool, error) {
+	ref := c.c.Collection(collectionUnclaimed).Doc(msg.DeviceID)
+	var first bool
+
+	err := c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		first = false
+		u := Unclaimed{FirstSeenAt: msg.At}
+
+		d, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			first = true
+		case err != nil:
+			return err
+		default:
+			if err := d.DataTo(&u); err != nil {
+				return err
+			}
+			first = u.FirstSeenAt.Equal(msg.At)
+		}
+
+		u.LastSeenAt = msg.At
+		u.LastRaw = msg.Raw
+		u.Count++
+		return tx.Set(ref, u)
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't save unclaimed device %s: %w", msg.DeviceID, err)
+	}
+	return first, nil
+}
+
+func (c *Client) UnclaimedDevices(ctx context.Context) ([]*soqchi.UnclaimedDevice, error) {
+	docs, err := c.c.Collection(collectionUnclaimed).OrderBy("LastSeenAt", firestore.Desc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve unclaimed devices: %w", err)
+	}
+
+	var result []*soqchi.UnclaimedDevice
+	for _, d := range docs {
+		var u Unclaimed
+		if err := d.DataTo(&u); err != nil {
+			return nil, err
+		}
+		result = append(result, &soqchi.UnclaimedDevice{
+			ID:          d.Ref.ID,
+			FirstSeenAt: u.FirstSeenAt.In(soqchi.TZ),
+			LastSeenAt:  u.LastSeenAt.In(soqchi.TZ),
+			Count:       u.Count,
+			LastRaw:     u.LastRaw,
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) ClaimDevice(ctx context.Context, deviceID, name string) (bool, error) {
+	ref := c.c.Collection(collectionUnclaimed).Doc(deviceID)
+	var claimed bool
+
+	err := c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		d, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var u Unclaimed
+		if err := d.DataTo(&u); err != nil {
+			return err
+		}
+
+		err = tx.Create(c.c.Collection(collectionDevices).Doc(deviceID), map[string]interface{}{
+			"Name":          name,
+			"LastMessageAt": u.LastSeenAt,
+		})
+		if err != nil {
+			return err
+		}
+		claimed = true
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't claim device %s: %w", deviceID, err)
+	}
+	return claimed, nil
+}
+
+func (c *Client) SaveMessage(ctx context.Context, msg *soqchi.Message, downlink string) error {
+	_, err := c.c.Collection(collectionDevices).Doc(msg.DeviceID).Collection(collectionMessages).Doc(msg.At.UTC().Format(time.RFC3339)).Set(ctx, Message{
+		ReceivedAt: msg.At,
+		Raw:        msg.Raw,
+		Flags:      int(msg.Flags),
+		Ack:        msg.Ack,
+		Voltage:    msg.Voltage,
+		Temp:       msg.Temp,
+		Downlink:   downlink,
+
+		Version:       msg.Version,
+		Firmware:      msg.Firmware,
+		BootCount:     msg.BootCount,
+		DoorOpenCount: msg.DoorOpenCount,
+
+		SeqNumber:   msg.SeqNumber,
+		RSSI:        msg.RSSI,
+		SNR:         msg.SNR,
+		AvgSNR:      msg.AvgSNR,
+		Station:     msg.Station,
+		LinkQuality: msg.LinkQuality,
+	})
+	return err
+}
+
+func (c *Client) Messages(ctx context.Context, deviceID string, from, to time.Time) ([]soqchi.LoggedMessage, error) {
+	it := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionMessages).
+		Where("ReceivedAt", ">=", from).Where("ReceivedAt", "<", to).
+		OrderBy("ReceivedAt", firestore.Asc).Documents(ctx)
 	defer it.Stop()
 
-	var inf = soqchi.DeviceInfo{HeartBeats: soqchi.Heartbeats{}}
+	var result []soqchi.LoggedMessage
+	for {
+		d, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("messages for (%s) failed: %w", deviceID, err)
+		}
+
+		var m Message
+		if err := d.DataTo(&m); err != nil {
+			return nil, fmt.Errorf("message decoding failed: %w", err)
+		}
+
+		result = append(result, soqchi.LoggedMessage{
+			Message: soqchi.Message{
+				DeviceID: deviceID,
+				At:       m.ReceivedAt.In(soqchi.TZ),
+				Ack:      m.Ack,
+				Raw:      m.Raw,
+				Flags:    byte(m.Flags),
+				Voltage:  m.Voltage,
+				Temp:     m.Temp,
+
+				Version:       m.Version,
+				Firmware:      m.Firmware,
+				BootCount:     m.BootCount,
+				DoorOpenCount: m.DoorOpenCount,
 
+				SeqNumber:   m.SeqNumber,
+				RSSI:        m.RSSI,
+				SNR:         m.SNR,
+				AvgSNR:      m.AvgSNR,
+				Station:     m.Station,
+				LinkQuality: m.LinkQuality,
+			},
+			Downlink: m.Downlink,
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) Heartbeats(ctx context.Context, deviceID string, from, to time.Time, limit int) (soqchi.Heartbeats, error) {
+	// při omezení počtu se čte od nejnovějších, aby se načetl konec intervalu
+	q := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionHeartbeats).
+		Where("ReceivedAt", ">=", from).Where("ReceivedAt", "<", to)
+	if limit > 0 {
+		q = q.OrderBy("ReceivedAt", firestore.Desc).Limit(limit)
+	} else {
+		q = q.OrderBy("ReceivedAt", firestore.Asc)
+	}
+	result, err := c.heartbeats(ctx, deviceID, q)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		result.Reverse()
+	}
+	return result, nil
+}
+
+func (c *Client) heartbeats(ctx context.Context, deviceID string, q firestore.Query) (soqchi.Heartbeats, error) {
+	it := q.Documents(ctx)
+	defer it.Stop()
+
+	var result soqchi.Heartbeats
 	for {
 		d, err := it.Next()
 		if err == iterator.Done {
@@ -133,14 +569,151 @@ func (c *Client) DeviceInfo(ctx context.Context, deviceID string) (*soqchi.Devic
 		if err := d.DataTo(&h); err != nil {
 			return nil, fmt.Errorf("heartbeat decoding failed: %w", err)
 		}
-
-		inf.HeartBeats = append(inf.HeartBeats, soqchi.Heartbeat{
-			At:          h.ReceivedAt,
+		result = append(result, soqchi.Heartbeat{
+			At:          h.ReceivedAt.In(soqchi.TZ),
 			Voltage:     h.Voltage,
 			Temperature: h.Temp,
 		})
+	}
+	return result, nil
+}
 
+func (c *Client) AlertStates(ctx context.Context, deviceID string) ([]soqchi.AlertState, error) {
+	docs, err := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionAlerts).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("alert states of device %s failed: %w", deviceID, err)
+	}
+
+	var states []soqchi.AlertState
+	for _, doc := range docs {
+		var a Alert
+		if err := doc.DataTo(&a); err != nil {
+			return nil, fmt.Errorf("alert state decoding failed: %w", err)
+		}
+		states = append(states, soqchi.AlertState{
+			Condition:  soqchi.AlertCondition(doc.Ref.ID),
+			Firing:     a.Firing,
+			Since:      a.Since,
+			NotifiedAt: a.NotifiedAt,
+			ResolvedAt: a.ResolvedAt,
+		})
+	}
+	return states, nil
+}
+
+func (c *Client) SaveAlertState(ctx context.Context, deviceID string, state soqchi.AlertState) error {
+	_, err := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionAlerts).Doc(string(state.Condition)).Set(ctx, Alert{
+		Firing:     state.Firing,
+		Since:      state.Since,
+		NotifiedAt: state.NotifiedAt,
+		ResolvedAt: state.ResolvedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("can't save alert state %s of device %s: %w", state.Condition, deviceID, err)
 	}
+	return nil
+}
+
+func (c *Client) subscriptionRef(deviceID string, channel soqchi.Channel, address string) *firestore.DocumentRef {
+	h := sha1.Sum([]byte(string(channel) + "\n" + address))
+	return c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionSubscriptions).Doc(hex.EncodeToString(h[:]))
+}
+
+func (c *Client) AddSubscription(ctx context.Context, deviceID string, sub soqchi.Subscription) error {
+	_, err := c.subscriptionRef(deviceID, sub.Channel, sub.Address).Set(ctx, Subscription{
+		Channel:   string(sub.Channel),
+		Address:   sub.Address,
+		Secret:    sub.Secret,
+		CreatedBy: sub.CreatedBy,
+		CreatedAt: sub.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("can't add subscription %s to device %s: %w", sub, deviceID, err)
+	}
+	return nil
+}
+
+func (c *Client) RemoveSubscription(ctx context.Context, deviceID string, channel soqchi.Channel, address string) (bool, error) {
+	_, err := c.subscriptionRef(deviceID, channel, address).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("can't remove subscription %s %s from device %s: %w", channel, address, deviceID, err)
+	}
+	return true, nil
+}
+
+func (c *Client) Subscriptions(ctx context.Context, deviceID string) ([]soqchi.Subscription, error) {
+	docs, err := c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionSubscriptions).
+		OrderBy("CreatedAt", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("subscriptions of device %s failed: %w", deviceID, err)
+	}
+
+	var subs []soqchi.Subscription
+	for _, doc := range docs {
+		var s Subscription
+		if err := doc.DataTo(&s); err != nil {
+			return nil, fmt.Errorf("subscription decoding failed: %w", err)
+		}
+		if soqchi.Channel(s.Channel) == soqchi.ChannelWebhook && s.Secret == "" {
+			// webhook přidaný před zavedením klíčů podpisu dostane klíč při prvním čtení
+			if s.Secret, err = soqchi.NewWebhookSecret(); err != nil {
+				return nil, err
+			}
+			if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "Secret", Value: s.Secret}}); err != nil {
+				return nil, fmt.Errorf("can't save secret of subscription %s: %w", s.Address, err)
+			}
+		}
+		subs = append(subs, soqchi.Subscription{
+			Channel:   soqchi.Channel(s.Channel),
+			Address:   s.Address,
+			Secret:    s.Secret,
+			CreatedBy: s.CreatedBy,
+			CreatedAt: s.CreatedAt,
+		})
+	}
+	return subs, nil
+}
+
+func (c *Client) ChatSettings(ctx context.Context, chatID int64) (*soqchi.ChatSettings, error) {
+	d, err := c.c.Collection(collectionChatSettings).Doc(fmt.Sprintf("%d", chatID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("settings of chat %d failed: %w", chatID, err)
+	}
+	var s ChatSettings
+	if err := d.DataTo(&s); err != nil {
+		return nil, fmt.Errorf("chat settings decoding failed: %w", err)
+	}
+	return &soqchi.ChatSettings{ChatID: chatID, Lang: s.Lang, TimeZone: s.TimeZone}, nil
+}
+
+func (c *Client) SaveChatSettings(ctx context.Context, s soqchi.ChatSettings) error {
+	_, err := c.c.Collection(collectionChatSettings).Doc(fmt.Sprintf("%d", s.ChatID)).Set(ctx, ChatSettings{
+		Lang:     s.Lang,
+		TimeZone: s.TimeZone,
+	})
+	if err != nil {
+		return fmt.Errorf("can't save settings of chat %d: %w", s.ChatID, err)
+	}
+	return nil
+}
+
+func (c *Client) DeviceInfo(ctx context.Context, deviceID string) (*soqchi.DeviceInfo, error) {
+	// posledních heartbeatLimit heartbeatů, v grafu ale od nejstaršího
+	hbs, err := c.heartbeats(ctx, deviceID, c.c.Collection(collectionDevices).Doc(deviceID).Collection(collectionHeartbeats).
+		OrderBy("ReceivedAt", firestore.Desc).Limit(heartbeatLimit))
+	if err != nil {
+		return nil, err
+	}
+	hbs.Reverse()
+
+	var inf = soqchi.DeviceInfo{HeartBeats: soqchi.Heartbeats{}}
+	inf.HeartBeats = append(inf.HeartBeats, hbs...)
 	return &inf, nil
 }
 
@@ -165,18 +738,182 @@ func (c *Client) AllDevices(ctx context.Context) ([]*soqchi.Device, error) {
 	return result, nil
 }
 
+func (c *Client) ChatDevices(ctx context.Context, chatID int64) ([]*soqchi.Device, error) {
+	// přihlášení se drží v podkolekcích zařízení - dotaz přes všechny podkolekce chats najde jen
+	// přihlášení chatu, zařízení se pak načtou jedním hromadným čtením
+	chats, err := c.c.CollectionGroup(collectionChats).Where("ChatID", "==", chatID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve devices of chat %d: %w", chatID, err)
+	}
+
+	var refs []*firestore.DocumentRef
+	for _, doc := range chats {
+		var ch Chat
+		if err := doc.DataTo(&ch); err != nil || ch.Pending {
+			continue
+		}
+		refs = append(refs, doc.Ref.Parent.Parent)
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	docs, err := c.c.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve devices of chat %d: %w", chatID, err)
+	}
+
+	var result []*soqchi.Device
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		d, err := unwrapDevice(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
 func unwrapDevice(f *firestore.DocumentSnapshot) (*soqchi.Device, error) {
 	var dev Device
 	if err := f.DataTo(&dev); err != nil {
 		return nil, err
 	}
 
+	var windows soqchi.AccessSchedule
+	for _, w := range dev.AccessWindows {
+		windows = append(windows, soqchi.AccessWindow{Weekday: time.Weekday(w.Weekday), From: w.From, To: w.To, Note: w.Note})
+	}
+
 	return &soqchi.Device{
 		ID:              f.Ref.ID,
 		Name:            dev.Name,
-		LastMessageAt:   dev.LastMessageAt,
-		LastHeartbeatAt: dev.LastHeartbeatAt,
+		LastMessageAt:   dev.LastMessageAt.In(soqchi.TZ),
+		LastHeartbeatAt: dev.LastHeartbeatAt.In(soqchi.TZ),
 		AccessAllowed:   dev.AccessAllowed,
 		Voltage:         dev.Voltage,
+
+		AccessAllowedUntil: dev.AccessAllowedUntil.In(soqchi.TZ),
+		AccessWindows:      windows,
+		TimeZone:           dev.TimeZone,
+		OwnerChatID:        dev.OwnerChatID,
+		Thresholds:         soqchi.Thresholds(dev.Thresholds),
+	}, nil
+}
+
+func (c *Client) SaveInvite(ctx context.Context, invite *soqchi.Invite) error {
+	_, err := c.c.Collection(collectionInvites).Doc(invite.Code).Create(ctx, Invite{
+		DeviceID:  invite.DeviceID,
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("can't save invite for device %s: %w", invite.DeviceID, err)
+	}
+	return nil
+}
+
+func (c *Client) Invite(ctx context.Context, code string) (*soqchi.Invite, error) {
+	d, err := c.c.Collection(collectionInvites).Doc(code).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return unwrapInvite(d)
+}
+
+func (c *Client) RedeemInvite(ctx context.Context, code string, chatID int64, username string, at time.Time) (*soqchi.Invite, error) {
+	ref := c.c.Collection(collectionInvites).Doc(code)
+	var invite *soqchi.Invite
+
+	err := c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		invite = nil
+		d, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		inv, err := unwrapInvite(d)
+		if err != nil {
+			return err
+		}
+		if !inv.Valid(at) {
+			return nil
+		}
+
+		inv.UsedBy, inv.UsedByName, inv.UsedAt = chatID, username, at
+		err = tx.Update(ref, []firestore.Update{
+			{Path: "UsedBy", Value: chatID},
+			{Path: "UsedByName", Value: username},
+			{Path: "UsedAt", Value: at},
+		})
+		if err != nil {
+			return err
+		}
+		invite = inv
+		return tx.Set(c.chatRef(inv.DeviceID, chatID), Chat{
+			ChatID:    chatID,
+			Username:  username,
+			CreatedAt: at,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't redeem invite: %w", err)
+	}
+	return invite, nil
+}
+
+func (c *Client) RevokeInvite(ctx context.Context, code string, at time.Time) (bool, error) {
+	ref := c.c.Collection(collectionInvites).Doc(code)
+	var revoked bool
+
+	err := c.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		revoked = false
+		d, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		inv, err := unwrapInvite(d)
+		if err != nil {
+			return err
+		}
+		if !inv.UsedAt.IsZero() || !inv.RevokedAt.IsZero() {
+			return nil
+		}
+		revoked = true
+		return tx.Update(ref, []firestore.Update{{Path: "RevokedAt", Value: at}})
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't revoke invite: %w", err)
+	}
+	return revoked, nil
+}
+
+func unwrapInvite(d *firestore.DocumentSnapshot) (*soqchi.Invite, error) {
+	var inv Invite
+	if err := d.DataTo(&inv); err != nil {
+		return nil, err
+	}
+	return &soqchi.Invite{
+		Code:       d.Ref.ID,
+		DeviceID:   inv.DeviceID,
+		CreatedBy:  inv.CreatedBy,
+		CreatedAt:  inv.CreatedAt,
+		ExpiresAt:  inv.ExpiresAt,
+		UsedBy:     inv.UsedBy,
+		UsedByName: inv.UsedByName,
+		UsedAt:     inv.UsedAt,
+		RevokedAt:  inv.RevokedAt,
 	}, nil
 }
@@ -5,16 +5,16 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"github.com/ISim/Arduino/soqchigfc/firestore"
+	"github.com/ISim/Arduino/soqchigfc/codec"
 	"github.com/ISim/Arduino/soqchigfc/pubsub"
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
 	"io"
 
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 )
 
@@ -35,30 +35,25 @@ type dataDTO struct {
 	TS       int64  `json:"ts"`
 	Data     string `json:"data"`
 	Ack      bool   `json:"ack"`
-}
-
-// inPayload je interní payload (bajty ze sigfoxu)
-type inPayload []byte
 
-type soqchiEvent struct {
-	ctx        context.Context
-	receivedAt time.Time
-	deviceID   string
-	data       inPayload
-	ack        bool
+	// nepovinná rádiová metadata
+	SeqNumber   *int     `json:"seqNumber"`
+	RSSI        *float64 `json:"rssi"`
+	SNR         *float64 `json:"snr"`
+	AvgSNR      *float64 `json:"avgSnr"`
+	Station     string   `json:"station"`
+	LinkQuality string   `json:"linkQuality"`
 }
 
 type deviceMessage struct {
 	publish interface {
-		PlainMessage(ctx context.Context, chats []int64, msg string) error
+		Event(ctx context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error
 	}
 
-	storage interface {
-		Device(ctx context.Context, deviceID string) (*soqchi.Device, error)
-		AllChats(ctx context.Context, deviceID string) ([]int64, error)
-		SaveHeartbeat(ctx context.Context, deviceID string, t time.Time, voltage, temperature float64) error
-		SaveTimestamp(ctx context.Context, deviceID string, t time.Time) error
-	}
+	storage storage.Storage
+
+	// admins jsou chaty administrátorů, kterým chodí upozornění na neznámá zařízení
+	admins []int64
 }
 
 // Device je handler vyvolávaný jako HTTP Google Cloud Funkce
@@ -80,12 +75,13 @@ func Device(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("pyaload decoding error: %s", err.Error())
 		http.Error(w, "payload error", http.StatusBadRequest)
+		return
 	}
 
-	storage, err := firestore.New(r.Context())
+	store, err := storage.New(r.Context())
 
 	if err != nil {
-		log.Printf("can't initialize firestore: %s", err.Error())
+		log.Printf("can't initialize storage: %s", err.Error())
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -99,7 +95,8 @@ func Device(w http.ResponseWriter, r *http.Request) {
 
 	dm := &deviceMessage{
 		publish: publish,
-		storage: storage,
+		storage: store,
+		admins:  soqchi.AdminChats(),
 	}
 
 	resp, err := dm.handle(r.Context(), msg)
@@ -146,19 +143,42 @@ func decodePayload(r io.Reader) (*soqchi.Message, error) {
 		return nil, fmt.Errorf("can't decode hexa payload data: %s", err.Error())
 	}
 
-	payload := inPayload(tmp)
-	toFloat64 := func(f func() (float64, bool)) float64 {
-		v, _ := f()
-		return v
+	if len(tmp) == 0 {
+		return nil, fmt.Errorf("can't decode payload: %w", codec.ErrEmptyPayload)
+	}
+
+	payload, err := codec.Decode(tmp)
+	if err != nil {
+		// příznaky jsou vždy v prvním bajtu - alarm se tak zpracuje i s nečitelnými daty
+		log.Printf("payload %s decoding error: %s", data.Data, err.Error())
+		payload = &codec.Payload{Flags: tmp[0], Version: codec.Version(tmp[0])}
+	}
+
+	orZero := func(v *float64) float64 {
+		if v == nil {
+			return 0
+		}
+		return *v
 	}
 
 	return &soqchi.Message{
-		DeviceID: data.DeviceID,
-		At:       time.Unix(data.TS, 0).In(soqchi.TZ),
-		Ack:      data.Ack,
-		Flags:    tmp[0],
-		Voltage:  toFloat64(payload.voltage),
-		Temp:     toFloat64(payload.temperature),
+		DeviceID:      data.DeviceID,
+		At:            time.Unix(data.TS, 0).In(soqchi.TZ),
+		Ack:           data.Ack,
+		Raw:           data.Data,
+		Flags:         payload.Flags,
+		Voltage:       payload.Voltage,
+		Temp:          payload.Temperature,
+		Version:       payload.Version,
+		Firmware:      payload.Firmware,
+		BootCount:     payload.BootCount,
+		DoorOpenCount: payload.DoorOpenCount,
+		SeqNumber:     data.SeqNumber,
+		RSSI:          orZero(data.RSSI),
+		SNR:           orZero(data.SNR),
+		AvgSNR:        orZero(data.AvgSNR),
+		Station:       data.Station,
+		LinkQuality:   data.LinkQuality,
 	}, nil
 }
 
@@ -166,95 +186,259 @@ func (h *deviceMessage) handle(ctx context.Context, msg *soqchi.Message) (*soqch
 	devUplink := &soqchi.UplinkResponse{}
 
 	device, err := h.storage.Device(ctx, msg.DeviceID)
-	devUplink.AccessEnabled = device.AccessAllowed
-
 	if err != nil {
 		return nil, fmt.Errorf("can't retrieve device data id=%s: %w", msg.DeviceID, err)
 	}
+	if device != nil {
+		// povolený přístup (i časově omezený nebo dle rozvrhu) se vyhodnocuje k času zprávy
+		devUplink.AccessEnabled = device.AccessEnabled(msg.At)
+	}
+
+	// Sigfox doručuje stejný frame z více základnových stanic a webhook může přijít i opakovaně.
+	// Duplicita dostane stejnou odpověď, ale znovu se nezpracovává. Pokud evidence framů selže,
+	// zpráva se raději zpracuje - duplicitní notifikace je menší zlo než ztracený alarm.
+	key := msg.FrameKey()
+	first, err := h.storage.RegisterFrame(ctx, msg.DeviceID, key, msg.At)
+	if err != nil {
+		log.Printf("frame registration failed, processing anyway: %s", err.Error())
+		first = true
+	}
+	if !first {
+		log.Printf("duplicate frame %s from device %s ignored", key, msg.DeviceID)
+		return devUplink, nil
+	}
+
+	if device == nil {
+		// neznámé zařízení dostane výchozí odpověď a jeho zprávy se jen evidují
+		if err := h.unclaimed(ctx, msg); err != nil {
+			// bez uvolnění framu by se opakovaný webhook zahodil jako duplicita a upozornění by se neposlalo
+			logErr(h.storage.ReleaseFrame(ctx, msg.DeviceID, key))
+			return devUplink, err
+		}
+		return devUplink, nil
+	}
+
+	if err := h.process(ctx, device, msg, devUplink); err != nil {
+		// process vrací chybu, jen dokud se nic nepublikovalo - frame se uvolní, aby ho opakovaný
+		// webhook mohl zpracovat znovu, aniž by se zprávy poslaly dvakrát
+		logErr(h.storage.ReleaseFrame(ctx, msg.DeviceID, key))
+		return devUplink, err
+	}
+	return devUplink, nil
+}
 
+func (h *deviceMessage) process(ctx context.Context, device *soqchi.Device, msg *soqchi.Message, devUplink *soqchi.UplinkResponse) error {
 	// vzdy se aktualizuje datum zprávy
 	h.storage.SaveTimestamp(ctx, msg.DeviceID, msg.At)
 
+	// do historie se ukládá každá zpráva včetně odpovědi zaslané do zařízení
+	var downlink string
+	if msg.Ack {
+		downlink = devUplink.Serialize()
+	}
+	logErr(h.storage.SaveMessage(ctx, msg, downlink))
+
 	if msg.Hartbeat() {
 		logErr(h.storage.SaveHeartbeat(ctx, device.ID, msg.At, msg.Voltage, msg.Temp))
 	}
 
-	if !msg.Alarm() && !msg.Info() {
-		// nic se nikomu nemá posílat
-		return devUplink, nil
+	// poplach a stav dveří se publikují první a jen jejich chyba vrací zprávu k opakování. Jakmile se
+	// něco publikovalo, chyby se už jen logují - opakovaný webhook by poslal stejné zprávy znovu.
+	var published bool
+	if msg.Alarm() {
+		if err := h.alarm(ctx, device, msg); err != nil {
+			return fmt.Errorf("alarm failed: %w", err)
+		}
+		published = true
+	}
+
+	if msg.Info() {
+		err := h.info(ctx, device, msg)
+		switch {
+		case err != nil && !published:
+			return fmt.Errorf("info failed: %w", err)
+		case err != nil:
+			log.Printf("info failed: %s", err.Error())
+		}
+	}
+
+	if msg.Hartbeat() {
+		logErr(h.publish.Event(ctx, soqchi.EventHeartbeat, device.ID, msg.At,
+			soqchi.Readings{Voltage: msg.Voltage, Temperature: msg.Temp}))
+
+		// device má stav před touto zprávou - ozvalo se zařízení, které watchdog považoval za ztracené?
+		if health := device.Health(msg.At); health == soqchi.NoHeartbeat || health == soqchi.HeartbeatMissing {
+			logErr(h.resumed(ctx, device, msg))
+		}
 	}
 
-	chats, err := h.storage.AllChats(ctx, msg.DeviceID)
+	if (msg.Hartbeat() || msg.Info()) && msg.HasReadings() {
+		logErr(h.temperature(ctx, device, msg))
+	}
+
+	return nil
+}
+
+// unclaimed zaeviduje zprávu ze zařízení, které není v evidenci, a při jeho prvním ozvání upozorní
+// administrátory, aby ho mohli převzít příkazem /claim
+func (h *deviceMessage) unclaimed(ctx context.Context, msg *soqchi.Message) error {
+	first, err := h.storage.SaveUnclaimed(ctx, msg)
 	if err != nil {
-		return devUplink, fmt.Errorf("can't publish messages: %w", err)
+		return err
+	}
+	if !first || len(h.admins) == 0 {
+		return nil
 	}
+	return h.publish.Event(ctx, soqchi.EventDeviceUnclaimed, msg.DeviceID, msg.At, soqchi.DeviceUnclaimed{Raw: msg.Raw})
+}
 
-	if len(chats) == 0 {
-		return devUplink, nil
+// resumed ukončí upozornění watchdogu na chybějící heartbeat a oznámí, že se zařízení opět ozývá.
+// Pokud watchdog na zařízení dosud neupozornil, nic se neposílá. Skončí-li obě upozornění (dosud
+// neohlášené zařízení i chybějící heartbeat) najednou, oznámí se návrat zařízení jen jednou.
+func (h *deviceMessage) resumed(ctx context.Context, device *soqchi.Device, msg *soqchi.Message) error {
+	states, err := h.storage.AlertStates(ctx, device.ID)
+	if err != nil {
+		return err
 	}
 
-	if msg.Alarm() {
-		err := h.alarm(ctx, device, msg, chats)
-		if err != nil {
-			return devUplink, fmt.Errorf("alarm failed: %w", err)
+	var (
+		resolved []soqchi.AlertState
+		alert    soqchi.Alert
+	)
+	for _, st := range states {
+		if st.Condition != soqchi.AlertNoHeartbeat && st.Condition != soqchi.AlertHeartbeatMissing {
+			continue
+		}
+		if st.Update(false, msg.At, 0) != soqchi.AlertResolved {
+			continue
+		}
+		resolved = append(resolved, st)
+		// chybějící heartbeat má přednost - zařízení, které už hlásilo, se "opět ozývá"
+		if alert.Condition != soqchi.AlertHeartbeatMissing {
+			alert.Condition = st.Condition
 		}
+		if alert.Since.IsZero() || st.Since.Before(alert.Since) {
+			alert.Since = st.Since
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
 	}
 
-	if msg.Info() {
-		err := h.info(ctx, device, msg, chats)
-		if err != nil {
-			return devUplink, fmt.Errorf("info failed: %w", err)
+	// stav se uloží až po úspěšném publikování, jinak by se návrat zařízení už nikdy neoznámil
+	alert.State = soqchi.AlertResolved
+	if err := h.publish.Event(ctx, soqchi.EventDeviceSilent, device.ID, msg.At, soqchi.DeviceSilent{
+		Alert:         alert,
+		LastMessageAt: msg.At,
+		Voltage:       msg.Voltage,
+	}); err != nil {
+		return err
+	}
+	for _, st := range resolved {
+		if err := h.storage.SaveAlertState(ctx, device.ID, st); err != nil {
+			return err
 		}
 	}
-
-	return devUplink, nil
+	return nil
 }
 
-func (h *deviceMessage) alarm(ctx context.Context, device *soqchi.Device, msg *soqchi.Message, chats []int64) error {
+// temperature vyhodnotí teplotu ze zprávy proti limitům zařízení a oznámí, když teplota opustí
+// povolený rozsah nebo se do něj vrátí. Hystereze brání opakovaným zprávám při teplotě kolísající
+// kolem limitu.
+func (h *deviceMessage) temperature(ctx context.Context, device *soqchi.Device, msg *soqchi.Message) error {
+	t := device.Thresholds
+	if t.TempMin == nil && t.TempMax == nil {
+		return nil
+	}
+
+	states, err := alertStates(ctx, h.storage, device.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range temperatureChecks(t, msg.Temp, states) {
+		st := c.state
+		tr := st.Update(c.active, msg.At, 0)
+		if tr != soqchi.AlertFired && tr != soqchi.AlertResolved {
+			continue
+		}
 
-	return h.publish.PlainMessage(ctx, chats,
-		fmt.Sprintf("‼️ %s (%s) - ALARM %s ‼️", device.Name, device.ID, msg.At.Format("2.1. 15:04"),
-		))
+		// stav se uloží až po úspěšném publikování, jinak by se upozornění už nikdy neposlalo
+		if err := h.publish.Event(ctx, soqchi.EventTemperature, device.ID, msg.At, soqchi.Temperature{
+			Alert:       soqchi.Alert{Condition: st.Condition, State: tr, Since: st.Since},
+			Temperature: msg.Temp,
+			Limit:       c.limit,
+		}); err != nil {
+			return err
+		}
+		if err := h.storage.SaveAlertState(ctx, device.ID, st); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (h *deviceMessage) info(ctx context.Context, device *soqchi.Device, msg *soqchi.Message, chats []int64) error {
-	var stateTxt string
-	if msg.DoorOpen() {
-		stateTxt = "🅾️"
-	} else {
-		stateTxt = "✅"
-	}
-	return h.publish.PlainMessage(ctx, chats,
-		fmt.Sprintf("%s %s %s 🌡 %.1f °C 🔋 %.3f V",
-			device.Name,
-			stateTxt,
-			msg.At.Format("2.1. 15:04"),
-			msg.Temp,
-			msg.Voltage))
+// temperatureCheck je vyhodnocení teploty proti jednomu limitu zařízení
+type temperatureCheck struct {
+	// state je dosavadní stav upozornění
+	state  soqchi.AlertState
+	limit  float64
+	active bool
 }
 
-func (p inPayload) temperature() (float64, bool) {
-	if len(p) < 4 {
-		return 0, false
+// temperatureChecks vyhodnotí teplotu temp s hysterezí proti nastaveným limitům t. Příjem zpráv
+// i watchdog sdílejí stavy upozornění states, takže o změně stavu se pošle jen jedna zpráva.
+func temperatureChecks(t soqchi.Thresholds, temp float64, states map[soqchi.AlertCondition]soqchi.AlertState) []temperatureCheck {
+	var checks []temperatureCheck
+	for _, c := range []struct {
+		condition soqchi.AlertCondition
+		limit     *float64
+		eval      func(temp float64, firing bool) (bool, bool)
+	}{
+		{soqchi.AlertTempLow, t.TempMin, t.TemperatureLow},
+		{soqchi.AlertTempHigh, t.TempMax, t.TemperatureHigh},
+	} {
+		st, ok := states[c.condition]
+		if !ok {
+			st = soqchi.AlertState{Condition: c.condition}
+		}
+		active, ok := c.eval(temp, st.Firing)
+		if !ok {
+			continue
+		}
+		checks = append(checks, temperatureCheck{state: st, limit: *c.limit, active: active})
 	}
-	t, err := strconv.Atoi(string(p[1:4]))
+	return checks
+}
+
+// alertStates vrací uložené stavy upozornění zařízení podle podmínky
+func alertStates(ctx context.Context, s storage.Storage, deviceID string) (map[soqchi.AlertCondition]soqchi.AlertState, error) {
+	saved, err := s.AlertStates(ctx, deviceID)
 	if err != nil {
-		log.Printf("temperature %q parse error", string(p[1:4]))
-		return 0, false
+		return nil, err
+	}
+	states := map[soqchi.AlertCondition]soqchi.AlertState{}
+	for _, st := range saved {
+		states[st.Condition] = st
 	}
-	return float64(t) / 10, true
+	return states, nil
 }
 
-func (p inPayload) voltage() (float64, bool) {
-	if len(p) < 4 {
-		return 0, false
+func (h *deviceMessage) alarm(ctx context.Context, device *soqchi.Device, msg *soqchi.Message) error {
+	var data soqchi.DoorAlarm
+	if w, ok := device.ExpectedEntry(msg.At); ok {
+		// vstup v rámci rozvrhu není poplach
+		data.Window = &w
 	}
-	t, err := strconv.Atoi(string(p[4:]))
-	if err != nil {
-		log.Printf("voltage %q parse error", string(p[4:]))
-		return 0, false
+	return h.publish.Event(ctx, soqchi.EventDoorAlarm, device.ID, msg.At, data)
+}
+
+func (h *deviceMessage) info(ctx context.Context, device *soqchi.Device, msg *soqchi.Message) error {
+	t := soqchi.EventDoorClosed
+	if msg.DoorOpen() {
+		t = soqchi.EventDoorOpen
 	}
-	return float64(t) / 1000, true
+	return h.publish.Event(ctx, t, device.ID, msg.At, soqchi.Readings{Voltage: msg.Voltage, Temperature: msg.Temp})
 }
 
 func logErr(err error) {
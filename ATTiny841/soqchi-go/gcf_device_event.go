@@ -0,0 +1,176 @@
+package soqchigfc
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/i18n"
+	"github.com/ISim/Arduino/soqchigfc/notify"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
+	"github.com/ISim/Arduino/soqchigfc/telegram"
+	"log"
+	"time"
+)
+
+// DeviceEvent je GCF spouštěná událostí zařízení z topicu soqchi.EventTopic. Událost převede šablonou
+// na text v jazyce a časové zóně příjemce a doručí ho chatům přihlášeným k zařízení a jeho odběratelům
+// v dalších kanálech.
+func DeviceEvent(ctx context.Context, m pubsub.Message) error {
+	var e soqchi.Event
+	if err := json.Unmarshal(m.Data, &e); err != nil {
+		return fmt.Errorf("can't unmarshal %q as %T: %w", string(m.Data), e, err)
+	}
+
+	store, err := storage.New(ctx)
+	if err != nil {
+		return fmt.Errorf("can't initialize storage: %w", err)
+	}
+
+	n := &notification{
+		storage:  store,
+		notifier: notify.FromEnv(telegram.NewSender()),
+		catalog:  i18n.FromEnv(),
+		admins:   soqchi.AdminChats(),
+	}
+	return n.event(ctx, &e)
+}
+
+// event doručí text události příjemcům. Události, o kterých se nic neposílá (šablona s prázdným
+// výstupem, např. heartbeat), a události neznámé verze, typu či zařízení se jen přeskočí. Chybu vrací
+// jen selhání úložiště, chyby doručení se zalogují - opakování by zprávu poslalo znovu všem příjemcům.
+func (n *notification) event(ctx context.Context, e *soqchi.Event) error {
+	if e.Version > soqchi.EventVersion {
+		log.Printf("%s event version %d of device %s not supported, skipped", e.Type, e.Version, e.DeviceID)
+		return nil
+	}
+
+	if e.Type == soqchi.EventDeviceUnclaimed {
+		// zařízení není v evidenci, o jeho ozvání se dozví jen administrátoři
+		return n.deliverEvent(ctx, e, &soqchi.Device{ID: e.DeviceID, Name: e.DeviceID}, n.admins, nil)
+	}
+
+	device, err := n.storage.Device(ctx, e.DeviceID)
+	if err != nil {
+		return fmt.Errorf("can't retrieve device data id=%s: %w", e.DeviceID, err)
+	}
+	if device == nil {
+		log.Printf("%s event of unknown device %s skipped", e.Type, e.DeviceID)
+		return nil
+	}
+
+	chats, err := n.storage.AllChats(ctx, device.ID)
+	if err != nil {
+		return err
+	}
+	return n.deliverEvent(ctx, e, device, chats, n.subscriptions(ctx, device))
+}
+
+// deliverEvent doručí text události chatům chats a odběratelům subs v dalších kanálech
+func (n *notification) deliverEvent(ctx context.Context, e *soqchi.Event, device *soqchi.Device, chats []int64,
+	subs []soqchi.Subscription) error {
+
+	// text se vytváří v jazyce a časové zóně každého příjemce, příjemci se stejným textem dostanou
+	// zprávu najednou
+	var texts []string
+	recipients := map[string][]soqchi.Subscription{}
+	rendered := map[string]string{}
+	add := func(lang string, loc *time.Location, r ...soqchi.Subscription) {
+		key := n.catalog.Lang(lang) + " " + loc.String()
+		text, ok := rendered[key]
+		if !ok {
+			var err error
+			if text, err = renderEvent(n.catalog, e, device, lang, loc); err != nil {
+				// chyba textu v jednom jazyce nesmí zabránit doručení ostatním příjemcům
+				log.Printf("%s event of device %s can't be rendered (%s): %s", e.Type, device.ID, key, err.Error())
+			}
+			rendered[key] = text
+		}
+		if text == "" {
+			return
+		}
+		if _, ok := recipients[text]; !ok {
+			texts = append(texts, text)
+		}
+		recipients[text] = append(recipients[text], r...)
+	}
+
+	for _, c := range chats {
+		settings, err := n.storage.ChatSettings(ctx, c)
+		if err != nil {
+			log.Printf("settings of chat %d: %s", c, err.Error())
+		}
+		var lang string
+		if settings != nil {
+			lang = settings.Lang
+		}
+		add(lang, settings.Location(device.Location()), telegramRecipient(c))
+	}
+	// odběratelé v dalších kanálech dostávají zprávy ve výchozím jazyce a časové zóně zařízení
+	if len(subs) > 0 {
+		add("", device.Location(), subs...)
+	}
+
+	for _, text := range texts {
+		n.notifier.Send(ctx, recipients[text], deviceNotification(device, text))
+	}
+	return nil
+}
+
+// eventTemplate jsou data šablony události
+type eventTemplate struct {
+	Device *soqchi.Device
+	At     time.Time
+	// Data jsou dekódovaná data události, u neznámého typu události mapa
+	Data interface{}
+}
+
+// renderEvent vrací text zprávy o události v jazyce lang s časy v časové zóně loc. Prázdný text
+// znamená, že se o události nic neposílá.
+func renderEvent(c *i18n.Catalog, e *soqchi.Event, device *soqchi.Device, lang string, loc *time.Location) (string, error) {
+	data := eventData(e.Type)
+	if len(e.Data) > 0 {
+		if err := e.Decode(data); err != nil {
+			return "", err
+		}
+	}
+
+	txt, err := c.Render(lang, string(e.Type), loc, eventTemplate{Device: device, At: e.At, Data: data})
+	if errors.Is(err, i18n.ErrUnknownTemplate) {
+		log.Printf("unknown event type %q of device %s skipped", e.Type, e.DeviceID)
+		return "", nil
+	}
+	return txt, err
+}
+
+// eventData vrací proměnnou pro dekódování dat události typu t. Data neznámého typu se dekódují do
+// mapy, aby je mohla použít šablona doplněná provozovatelem.
+func eventData(t soqchi.EventType) interface{} {
+	switch t {
+	case soqchi.EventDoorAlarm:
+		return &soqchi.DoorAlarm{}
+	case soqchi.EventDoorOpen, soqchi.EventDoorClosed, soqchi.EventHeartbeat:
+		return &soqchi.Readings{}
+	case soqchi.EventDeviceSilent:
+		return &soqchi.DeviceSilent{}
+	case soqchi.EventLowBattery:
+		return &soqchi.LowBattery{}
+	case soqchi.EventTemperature:
+		return &soqchi.Temperature{}
+	case soqchi.EventFramesLost:
+		return &soqchi.FramesLost{}
+	case soqchi.EventAccessChanged:
+		return &soqchi.AccessChanged{}
+	case soqchi.EventScheduleChanged:
+		return &soqchi.ScheduleChanged{}
+	case soqchi.EventLimitsChanged:
+		return &soqchi.LimitsChanged{}
+	case soqchi.EventSubscriptionChanged:
+		return &soqchi.SubscriptionChanged{}
+	case soqchi.EventDeviceUnclaimed:
+		return &soqchi.DeviceUnclaimed{}
+	}
+	return &map[string]interface{}{}
+}
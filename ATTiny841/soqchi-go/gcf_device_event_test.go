@@ -0,0 +1,219 @@
+package soqchigfc
+
+import (
+	"context"
+	"errors"
+	"github.com/ISim/Arduino/soqchigfc/i18n"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/notify"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"testing"
+	"time"
+)
+
+func testCatalog(t *testing.T) *i18n.Catalog {
+	t.Helper()
+	c, err := i18n.New("", i18n.Czech)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDeviceEvent(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddUser(ctx, "ABC", 43, "john")
+	_ = store.SaveChatSettings(ctx, soqchi.ChatSettings{ChatID: 43, Lang: i18n.English, TimeZone: "Europe/London"})
+	_ = store.AddSubscription(ctx, "ABC", soqchi.Subscription{Channel: soqchi.ChannelNtfy, Address: "chata", CreatedAt: time.Now()})
+
+	tn := &testNotifier{}
+	n := &notification{storage: store, notifier: tn, catalog: testCatalog(t)}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	e, _ := soqchi.NewEvent(soqchi.EventDoorAlarm, "ABC", at, soqchi.DoorAlarm{})
+	if err := n.event(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	// česky výchozí chat a odběratelé v dalších kanálech, anglicky v časové zóně chatu
+	if len(tn.sent) != 2 {
+		t.Fatalf("expected messages in 2 languages, got %#v", tn.sent)
+	}
+	cs, en := tn.sent[0], tn.sent[1]
+	if len(cs.recipients) != 2 || cs.recipients[0].Address != "42" || cs.recipients[1].Channel != soqchi.ChannelNtfy {
+		t.Errorf("unexpected recipients %#v", cs.recipients)
+	}
+	if cs.msg.Text != "‼️ chata (ABC) - ALARM 20.2. 10:30 ‼️" || cs.msg.Title != "soqchi - chata" {
+		t.Errorf("unexpected message %#v", cs.msg)
+	}
+	if len(en.recipients) != 1 || en.recipients[0].Address != "43" || en.msg.Text != "‼️ chata (ABC) - ALARM Feb 20, 09:30 ‼️" {
+		t.Errorf("unexpected english message %#v", en)
+	}
+
+	// o heartbeatu, události novější verze ani události neznámého zařízení či typu se nic neposílá
+	tn.sent = nil
+	hb, _ := soqchi.NewEvent(soqchi.EventHeartbeat, "ABC", at, soqchi.Readings{Voltage: 2.9})
+	future, _ := soqchi.NewEvent(soqchi.EventDoorAlarm, "ABC", at, soqchi.DoorAlarm{})
+	future.Version = soqchi.EventVersion + 1
+	unknown, _ := soqchi.NewEvent(soqchi.EventDoorAlarm, "XYZ", at, soqchi.DoorAlarm{})
+	rang, _ := soqchi.NewEvent(soqchi.EventType("door_rang"), "ABC", at, nil)
+	for _, e := range []*soqchi.Event{hb, future, unknown, rang} {
+		if err := n.event(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tn.sent != nil {
+		t.Errorf("expected no notification, got %#v", tn.sent)
+	}
+}
+
+func TestDeviceEventUnclaimed(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	_ = store.SaveChatSettings(ctx, soqchi.ChatSettings{ChatID: 8, Lang: i18n.English, TimeZone: "Europe/London"})
+
+	tn := &testNotifier{}
+	n := &notification{storage: store, notifier: tn, catalog: testCatalog(t), admins: []int64{7, 8}}
+
+	// zařízení není v evidenci, zprávu dostanou jen administrátoři, každý ve svém jazyce
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	e, _ := soqchi.NewEvent(soqchi.EventDeviceUnclaimed, "NEW", at, soqchi.DeviceUnclaimed{Raw: "81"})
+	if err := n.event(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if len(tn.sent) != 2 || tn.sent[0].recipients[0].Address != "7" || tn.sent[1].recipients[0].Address != "8" {
+		t.Fatalf("expected messages to admins, got %#v", tn.sent)
+	}
+	if tn.sent[0].msg.Text != "❓ neznámé zařízení NEW poslalo zprávu 20.2. 10:30 (data 81) - převzít lze příkazem /claim NEW <název>" {
+		t.Errorf("unexpected message %q", tn.sent[0].msg.Text)
+	}
+}
+
+// channelNotifier je notifier jednoho kanálu, zaznamenává adresy a vrací chybu err
+type channelNotifier struct {
+	addresses []string
+	err       error
+}
+
+func (n *channelNotifier) Notify(_ context.Context, to soqchi.Subscription, _ notify.Message) error {
+	n.addresses = append(n.addresses, to.Address)
+	return n.err
+}
+
+func TestDeviceEventDeliveryFailure(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddSubscription(ctx, "ABC", soqchi.Subscription{Channel: soqchi.ChannelNtfy, Address: "chata", CreatedAt: time.Now()})
+
+	tg := &channelNotifier{err: errors.New("bot was blocked by the user")}
+	ntfy := &channelNotifier{}
+	d := notify.NewDispatcher()
+	d.Register(soqchi.ChannelTelegram, tg)
+	d.Register(soqchi.ChannelNtfy, ntfy)
+	n := &notification{storage: store, notifier: d, catalog: testCatalog(t)}
+
+	// chyba doručení se nevrací, jinak by Pub/Sub událost doručil znovu a ntfy by dostal zprávu dvakrát
+	e, _ := soqchi.NewEvent(soqchi.EventDoorAlarm, "ABC", time.Now(), soqchi.DoorAlarm{})
+	if err := n.event(ctx, e); err != nil {
+		t.Errorf("expected delivery failure to be logged only, got %v", err)
+	}
+	if len(tg.addresses) != 1 || len(ntfy.addresses) != 1 || ntfy.addresses[0] != "chata" {
+		t.Errorf("unexpected deliveries %v, %v", tg.addresses, ntfy.addresses)
+	}
+}
+
+func TestRenderEvent(t *testing.T) {
+	catalog := testCatalog(t)
+	device := &soqchi.Device{ID: "ABC", Name: "chata"}
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	since := at.AddDate(0, 0, -3)
+	london, _ := time.LoadLocation("Europe/London")
+
+	tests := []struct {
+		t    soqchi.EventType
+		lang string
+		data interface{}
+		exp  string
+	}{
+		{soqchi.EventDoorClosed, "", soqchi.Readings{Voltage: 2.9, Temperature: 4.5}, "chata ✅ 20.2. 10:30 🌡 4.5 °C 🔋 2.900 V"},
+		{soqchi.EventDoorAlarm, "", soqchi.DoorAlarm{Window: &soqchi.AccessWindow{Weekday: time.Sunday, From: 600, To: 720, Note: "úklid"}},
+			"🔑 chata (ABC) - očekávaný vstup 20.2. 10:30 (ne 10:00-12:00 úklid)"},
+		{soqchi.EventDoorAlarm, i18n.English, soqchi.DoorAlarm{Window: &soqchi.AccessWindow{Weekday: time.Sunday, From: 600, To: 720}},
+			"🔑 chata (ABC) - expected entry Feb 20, 09:30 (10:00-12:00)"},
+		{soqchi.EventHeartbeat, "", soqchi.Readings{Voltage: 2.9}, ""},
+		{soqchi.EventDeviceSilent, "", soqchi.DeviceSilent{
+			Alert:         soqchi.Alert{Condition: soqchi.AlertHeartbeatMissing, State: soqchi.AlertResolved, Since: since},
+			LastMessageAt: at, Voltage: 2.9},
+			"✅ zařízení chata (ABC) se opět ozývá (20.2. 10:30) 🔋 2.900 V"},
+		{soqchi.EventDeviceSilent, "", soqchi.DeviceSilent{
+			Alert:         soqchi.Alert{Condition: soqchi.AlertHeartbeatMissing, State: soqchi.AlertFired, Since: at},
+			LastMessageAt: since},
+			"⚠️ zařízení chata (ABC) se neohlásilo od 17.2. 10:30"},
+		{soqchi.EventDeviceSilent, i18n.English, soqchi.DeviceSilent{
+			Alert: soqchi.Alert{Condition: soqchi.AlertNoHeartbeat, State: soqchi.AlertReminder, Since: since}},
+			"⚠️ device chata (ABC) has not reported yet (since Feb 17)"},
+		{soqchi.EventLowBattery, "", soqchi.LowBattery{
+			Alert:   soqchi.Alert{Condition: soqchi.AlertLowVoltage, State: soqchi.AlertReminder, Since: since},
+			Voltage: 2.4, Limit: 2.5},
+			"⚠️ zařízení chata (ABC) má nízké napětí baterie 2.400 (trvá od 17.2.)"},
+		{soqchi.EventLowBattery, "", soqchi.LowBattery{
+			Alert:   soqchi.Alert{Condition: soqchi.AlertBatteryForecast, State: soqchi.AlertFired, Since: at},
+			Voltage: 2.7, Limit: 2.5, LimitAt: at.AddDate(0, 0, 10), DaysLeft: 10, WarnDays: 14},
+			"🔋 zařízení chata (ABC) - napětí baterie podle trendu klesne pod 2.5 V kolem 2.3. (za 10 dní), připravte výměnu"},
+		{soqchi.EventLowBattery, "", soqchi.LowBattery{
+			Alert:   soqchi.Alert{Condition: soqchi.AlertCriticalVoltage, State: soqchi.AlertResolved, Since: since},
+			Voltage: 2.6},
+			"✅ zařízení chata (ABC) už nemá kriticky nízké napětí baterie (2.600 V)"},
+		{soqchi.EventTemperature, "", soqchi.Temperature{
+			Alert:       soqchi.Alert{Condition: soqchi.AlertTempHigh, State: soqchi.AlertFired, Since: at},
+			Temperature: 31, Limit: 30},
+			"🔥 chata (ABC) - teplota 31.0 °C překročila 30.0 °C (20.2. 10:30)"},
+		{soqchi.EventTemperature, i18n.English, soqchi.Temperature{
+			Alert:       soqchi.Alert{Condition: soqchi.AlertTempLow, State: soqchi.AlertResolved, Since: since},
+			Temperature: 3, Limit: 2},
+			"✅ chata (ABC) - temperature 3.0 °C is above 2.0 °C again (Feb 20, 09:30)"},
+		{soqchi.EventFramesLost, "", soqchi.FramesLost{Lost: 3, Since: since},
+			"⚠️ zařízení chata (ABC) ztratilo od 17.2. 10:30 3 zpráv(y) - zkontrolujte umístění antény"},
+		{soqchi.EventAccessChanged, "", soqchi.AccessChanged{Allowed: true, Until: at.Add(2 * time.Hour), By: "franta"},
+			"🔓 chata (ABC) přístup povolen do 20.2. 12:30 (franta)"},
+		{soqchi.EventAccessChanged, i18n.English, soqchi.AccessChanged{Allowed: false},
+			"🔒 chata (ABC) armed"},
+		{soqchi.EventScheduleChanged, i18n.English, soqchi.ScheduleChanged{
+			Window: &soqchi.AccessWindow{Weekday: time.Saturday, From: 480, To: 600}, Added: true, By: "john"},
+			"🗓 chata (ABC) - expected access window Saturday 8:00-10:00 added (john)"},
+		{soqchi.EventScheduleChanged, "", soqchi.ScheduleChanged{},
+			"🗓 chata (ABC) - rozvrh očekávaného přístupu smazán"},
+		{soqchi.EventLimitsChanged, i18n.English, soqchi.LimitsChanged{Limit: "grace", Value: "1h", Default: true},
+			"📏 chata (ABC) - limit grace set to 1h (default)"},
+		{soqchi.EventSubscriptionChanged, "", soqchi.SubscriptionChanged{Channel: soqchi.ChannelNtfy, Address: "chata",
+			Added: true, By: "franta"},
+			"📬 chata (ABC) - přidán odběr zpráv ntfy chata (franta)"},
+		{soqchi.EventDeviceUnclaimed, i18n.English, soqchi.DeviceUnclaimed{Raw: "81"},
+			"❓ unknown device ABC sent a message Feb 20, 09:30 (data 81) - claim it with /claim ABC <name>"},
+		{soqchi.EventType("door_rang"), "", struct{}{}, ""},
+	}
+	for _, tt := range tests {
+		e, err := soqchi.NewEvent(tt.t, device.ID, at, tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// anglické texty v časové zóně příjemce, české v časové zóně zařízení
+		loc := device.Location()
+		if tt.lang == i18n.English {
+			loc = london
+		}
+		txt, err := renderEvent(catalog, e, device, tt.lang, loc)
+		if err != nil {
+			t.Errorf("%s: %v", tt.t, err)
+			continue
+		}
+		if txt != tt.exp {
+			t.Errorf("%s: expected %q, got %q", tt.t, tt.exp, txt)
+		}
+	}
+}
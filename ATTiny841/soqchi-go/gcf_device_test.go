@@ -1,34 +1,411 @@
 package soqchigfc
 
 import (
+	"context"
+	"errors"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestTemperatureParsing(t *testing.T) {
-	s := &soqchiEvent{
-		data: []byte{0x00, 0x32, 0x36, 0x31, 0x35, 0x38, 0x32, 0x35},
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name                string
+		data                string
+		flags               byte
+		version             int
+		temp, voltage       float64
+		bootCount, doorOpen int
+	}{
+		{"v1", "0032363135383235", 0x00, 0, 26.1, 5.825, 0, 0},
+		{"v1 alarm", "81", 0x81, 0, 0, 0, 0, 0},
+		{"v2", "22ff9c0b860300070120", 0x22, 1, -10, 2.95, 7, 288},
+		{"v2 truncated", "a3ff9c", 0xa3, 1, 0, 0, 0, 0},
 	}
 
-	temp, ok := s.data.temperature()
-	if !ok {
-		t.Fatal("parse error")
+	for _, tc := range tests {
+		msg, err := decodePayload(strings.NewReader(`{"device":"ABC","ts":1645353000,"data":"` + tc.data + `","ack":false}`))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if msg.Flags != tc.flags || msg.Version != tc.version || msg.Temp != tc.temp || msg.Voltage != tc.voltage ||
+			msg.BootCount != tc.bootCount || msg.DoorOpenCount != tc.doorOpen {
+			t.Errorf("%s: unexpected message %+v", tc.name, msg)
+		}
 	}
-	if exp := 26.1; temp != exp {
-		t.Errorf("expected temperature %f, got %f", exp, temp)
+
+	if _, err := decodePayload(strings.NewReader(`{"device":"ABC","ts":1645353000,"data":"","ack":false}`)); err == nil {
+		t.Error("expected error for empty payload")
+	}
+}
+
+type publishedEvent struct {
+	t        soqchi.EventType
+	deviceID string
+	at       time.Time
+	data     interface{}
+}
+
+type testPublisher struct {
+	events []publishedEvent
+	// err je chyba, kterou vrací publikování událostí (nepublikuje se nic)
+	err error
+}
+
+func (p *testPublisher) Event(_ context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, publishedEvent{t: t, deviceID: deviceID, at: at, data: data})
+	return nil
+}
+
+// texts vrací texty zpráv o publikovaných událostech tak, jak je vykreslí DeviceEvent - události,
+// o kterých se nic neposílá (heartbeat), vynechá
+func (p *testPublisher) texts(t *testing.T, store storage.Storage) []string {
+	t.Helper()
+	var texts []string
+	for _, pe := range p.events {
+		e, err := soqchi.NewEvent(pe.t, pe.deviceID, pe.at, pe.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		device, err := store.Device(context.Background(), pe.deviceID)
+		if err != nil || device == nil {
+			t.Fatalf("device %s of %s event not found: %v", pe.deviceID, pe.t, err)
+		}
+		txt, err := renderEvent(testCatalog(t), e, device, "", device.Location())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txt != "" {
+			texts = append(texts, txt)
+		}
+	}
+	return texts
+}
+
+func TestHandleAlarm(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", AccessAllowed: true})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	resp, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Flags: 0x81})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.AccessEnabled {
+		t.Error("expected access enabled in uplink response")
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || texts[0] != "‼️ chata (ABC) - ALARM 20.2. 10:30 ‼️" {
+		t.Fatalf("expected one alarm message, got %q", texts)
+	}
+
+	d, _ := store.Device(ctx, "ABC")
+	if !d.LastMessageAt.Equal(at) {
+		t.Errorf("expected last message at %s, got %s", at, d.LastMessageAt)
+	}
+
+	msgs, _ := store.Messages(ctx, "ABC", at, at.Add(time.Minute))
+	if len(msgs) != 1 || !msgs[0].Alarm() {
+		t.Errorf("expected alarm in message log, got %#v", msgs)
+	}
+}
+
+func TestHandleHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	if _, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Flags: 0x20, Voltage: 2.9, Temp: 4.5}); err != nil {
+		t.Fatal(err)
+	}
+	// heartbeat je událost pro další spotřebitele, zpráva se o něm neposílá
+	if len(pub.events) != 1 || pub.events[0].t != soqchi.EventHeartbeat ||
+		pub.events[0].data != (soqchi.Readings{Voltage: 2.9, Temperature: 4.5}) {
+		t.Errorf("expected heartbeat event, got %#v", pub.events)
+	}
+	if texts := pub.texts(t, store); len(texts) != 0 {
+		t.Errorf("heartbeat should not be notified, got %q", texts)
+	}
+
+	info, _ := store.DeviceInfo(ctx, "ABC")
+	if len(info.HeartBeats) != 1 || info.HeartBeats[0].Voltage != 2.9 {
+		t.Errorf("expected stored heartbeat, got %#v", info.HeartBeats)
+	}
+}
+
+func TestHandleDuplicateFrame(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", AccessAllowed: true})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	for i := 0; i < 3; i++ {
+		resp, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Raw: "a1", Ack: true, Flags: 0xa1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.AccessEnabled {
+			t.Errorf("duplicate %d: expected access enabled in uplink response", i)
+		}
+	}
+
+	if texts := pub.texts(t, store); len(texts) != 1 {
+		t.Errorf("expected one alarm message, got %q", texts)
+	}
+	// stejný frame s jiným obsahem už duplicitou není
+	if _, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Raw: "41", Flags: 0x41}); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || texts[1] != "chata 🅾️ 20.2. 10:30 🌡 0.0 °C 🔋 0.000 V" {
+		t.Errorf("expected info message, got %q", texts)
+	}
+}
+
+func TestDecodePayloadRadioMetadata(t *testing.T) {
+	msg, err := decodePayload(strings.NewReader(`{"device":"ABC","ts":1645353000,"data":"2032363135383235","ack":false,
+		"seqNumber":812,"rssi":-121.5,"snr":9.32,"avgSnr":14.1,"station":"1F2A","linkQuality":"AVERAGE"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SeqNumber == nil || *msg.SeqNumber != 812 || msg.RSSI != -121.5 || msg.SNR != 9.32 ||
+		msg.AvgSNR != 14.1 || msg.Station != "1F2A" || msg.LinkQuality != "AVERAGE" {
+		t.Errorf("unexpected radio metadata %#v", msg)
+	}
+	if key := msg.FrameKey(); key != "1645353000-s812" {
+		t.Errorf("unexpected frame key %s", key)
+	}
+
+	msg, err = decodePayload(strings.NewReader(`{"device":"ABC","ts":1645353000,"data":"2032363135383235","ack":false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SeqNumber != nil || msg.RSSI != 0 {
+		t.Errorf("expected no radio metadata, got %#v", msg)
 	}
 }
 
-func TestVoltageParsing(t *testing.T) {
-	s := &soqchiEvent{
-		data: []byte{0x00, 0x32, 0x36, 0x31, 0x35, 0x38, 0x32, 0x35},
+func TestHandleUnknownDevice(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store, admins: []int64{7}}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	for i := 0; i < 2; i++ {
+		resp, err := dm.handle(ctx, &soqchi.Message{DeviceID: "NEW", At: at.Add(time.Duration(i) * time.Hour), Raw: "81", Ack: true, Flags: 0x81})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.AccessEnabled {
+			t.Errorf("expected default uplink response, got %#v", resp)
+		}
+	}
+
+	if len(pub.events) != 1 || pub.events[0].t != soqchi.EventDeviceUnclaimed || pub.events[0].deviceID != "NEW" {
+		t.Errorf("expected one notification for admins, got %#v", pub.events)
+	}
+
+	unclaimed, _ := store.UnclaimedDevices(ctx)
+	if len(unclaimed) != 1 || unclaimed[0].Count != 2 || !unclaimed[0].FirstSeenAt.Equal(at) || !unclaimed[0].LastSeenAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("unexpected unclaimed devices %#v", unclaimed)
+	}
+}
+
+// eventFailingPublisher simuluje chybu publikování událostí jednoho typu
+type eventFailingPublisher struct {
+	testPublisher
+	fail soqchi.EventType
+}
+
+func (p *eventFailingPublisher) Event(ctx context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error {
+	if t == p.fail {
+		return errors.New("pub/sub unavailable")
+	}
+	return p.testPublisher.Event(ctx, t, deviceID, at, data)
+}
+
+func TestHandlePublishFailure(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", LastHeartbeatAt: at.Add(-time.Hour), LastMessageAt: at.Add(-time.Hour)})
+
+	// poplach se nepublikoval - nepublikuje se nic a opakovaný webhook zprávu zpracuje celou
+	pub := &eventFailingPublisher{fail: soqchi.EventDoorAlarm}
+	dm := &deviceMessage{publish: pub, storage: store}
+	msg := &soqchi.Message{DeviceID: "ABC", At: at, Raw: "a1", Flags: 0xa1, Voltage: 2.9, Temp: 4.5}
+	if _, err := dm.handle(ctx, msg); err == nil {
+		t.Fatal("expected alarm error")
+	}
+	if len(pub.events) != 0 {
+		t.Fatalf("nothing should be published before the alarm, got %#v", pub.events)
+	}
+	pub.fail = ""
+	if _, err := dm.handle(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.events) != 2 || pub.events[0].t != soqchi.EventDoorAlarm || pub.events[1].t != soqchi.EventHeartbeat {
+		t.Fatalf("expected alarm and heartbeat once, got %#v", pub.events)
+	}
+
+	// poplach se publikoval, chyba stavu dveří už zprávu neopakuje
+	pub = &eventFailingPublisher{fail: soqchi.EventDoorOpen}
+	dm.publish = pub
+	msg = &soqchi.Message{DeviceID: "ABC", At: at.Add(time.Minute), Raw: "c1", Flags: 0xc1}
+	for i := 0; i < 2; i++ {
+		if _, err := dm.handle(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(pub.events) != 1 || pub.events[0].t != soqchi.EventDoorAlarm {
+		t.Errorf("expected single alarm, got %#v", pub.events)
+	}
+}
+
+func TestHandleUnknownDevicePublishFailure(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+
+	pub := &testPublisher{err: errors.New("pub/sub unavailable")}
+	dm := &deviceMessage{publish: pub, storage: store, admins: []int64{7}}
+
+	// opakovaný webhook po neúspěšném upozornění se nezahodí jako duplicita a upozornění pošle
+	msg := &soqchi.Message{DeviceID: "NEW", At: time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ), Raw: "81", Flags: 0x81}
+	if _, err := dm.handle(ctx, msg); err == nil {
+		t.Fatal("expected publish error")
+	}
+	pub.err = nil
+	if _, err := dm.handle(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.events) != 1 || pub.events[0].t != soqchi.EventDeviceUnclaimed {
+		t.Errorf("expected notification for admins, got %#v", pub.events)
+	}
+}
+
+func TestHandleAccessExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	store.PutDevice(soqchi.Device{ID: "ABC", AccessAllowed: true, AccessAllowedUntil: at.Add(time.Hour)})
+
+	dm := &deviceMessage{publish: &testPublisher{}, storage: store}
+	for _, tc := range []struct {
+		at  time.Time
+		exp bool
+	}{{at, true}, {at.Add(2 * time.Hour), false}} {
+		resp, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: tc.at, Raw: "81", Ack: true, Flags: 0x81})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.AccessEnabled != tc.exp {
+			t.Errorf("%s: expected access %v, got %v", tc.at, tc.exp, resp.AccessEnabled)
+		}
+	}
+}
+
+func TestHandleExpectedEntry(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata",
+		AccessWindows: soqchi.AccessSchedule{{Weekday: time.Tuesday, From: 540, To: 720, Note: "úklid"}}})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+
+	for _, at := range []time.Time{
+		time.Date(2022, 2, 22, 10, 0, 0, 0, soqchi.TZ),
+		time.Date(2022, 2, 22, 13, 0, 0, 0, soqchi.TZ),
+	} {
+		if _, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Raw: "81", Flags: 0x81}); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	v, ok := s.data.voltage()
-	if !ok {
-		t.Fatal("parse error")
+	texts := pub.texts(t, store)
+	if len(texts) != 2 {
+		t.Fatalf("expected 2 messages, got %q", texts)
+	}
+	if !strings.Contains(texts[0], "očekávaný vstup") || !strings.Contains(texts[0], "út 9:00-12:00 úklid") {
+		t.Errorf("expected softer message inside window, got %q", texts[0])
 	}
-	if exp := 5.825; v != exp {
-		t.Errorf("expected voltage %f, got %f", exp, v)
+	if !strings.Contains(texts[1], "ALARM") {
+		t.Errorf("expected alarm outside window, got %q", texts[1])
 	}
 }
 
+func TestHandleTemperature(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	tmin := 0.0
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Thresholds: soqchi.Thresholds{TempMin: &tmin}})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, soqchi.TZ)
+	// heartbeaty (0x20) i info zprávy (0x40), teplota kolísá kolem limitu, alarm bez dat se nevyhodnocuje
+	for i, m := range []struct {
+		flags byte
+		temp  float64
+	}{{0x20, 2}, {0x40, -0.5}, {0x20, 0.3}, {0x81, 0}, {0x41, -0.2}, {0x20, 0.8}, {0x40, 1.5}, {0x20, 0.5}} {
+		msg := &soqchi.Message{DeviceID: "ABC", At: at.Add(time.Duration(i) * time.Hour), Flags: m.flags, Temp: m.temp}
+		if m.flags != 0x81 {
+			msg.Voltage = 2.9
+		}
+		if _, err := dm.handle(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var alerts []string
+	for _, txt := range pub.texts(t, store) {
+		if strings.Contains(txt, "teplota") {
+			alerts = append(alerts, txt)
+		}
+	}
+	if len(alerts) != 2 || !strings.Contains(alerts[0], "🥶 chata (ABC) - teplota -0.5 °C klesla pod 0.0 °C (20.2. 11:30)") ||
+		!strings.Contains(alerts[1], "✅ chata (ABC) - teplota 1.5 °C je opět nad 0.0 °C") {
+		t.Errorf("expected one alert and one recovery, got %q", alerts)
+	}
+	// nepublikované upozornění se pošle s další zprávou
+	tmax := 30.0
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Thresholds: soqchi.Thresholds{TempMin: &tmin, TempMax: &tmax}})
+	device, _ := store.Device(ctx, "ABC")
+	pub.events, pub.err = nil, errors.New("pub/sub unavailable")
+	msg := &soqchi.Message{DeviceID: "ABC", At: at.Add(10 * time.Hour), Flags: 0x20, Temp: 35, Voltage: 2.9}
+	if err := dm.temperature(ctx, device, msg); err == nil {
+		t.Fatal("expected publish error")
+	}
+	pub.err = nil
+	msg.At = msg.At.Add(time.Hour)
+	if err := dm.temperature(ctx, device, msg); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "🔥 chata (ABC) - teplota 35.0 °C překročila 30.0 °C") {
+		t.Errorf("expected repeated alert, got %q", texts)
+	}
+}
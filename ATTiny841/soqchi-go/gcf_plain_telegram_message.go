@@ -5,10 +5,30 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/i18n"
+	"github.com/ISim/Arduino/soqchigfc/notify"
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
 	"github.com/ISim/Arduino/soqchigfc/telegram"
+	"log"
+	"strconv"
 )
 
+// notificationTitle je titulek zpráv (předmět e-mailu, titulek push notifikace)
+const notificationTitle = "soqchi"
+
+// notification doručí zprávu z fronty chatům ze zprávy a u zpráv týkajících se zařízení i jeho
+// odběratelům v dalších kanálech
+type notification struct {
+	storage  storage.Storage
+	notifier interface {
+		Send(ctx context.Context, recipients []soqchi.Subscription, msg notify.Message)
+	}
+	// catalog jsou šablony textů událostí a admins chaty administrátorů (jen DeviceEvent)
+	catalog *i18n.Catalog
+	admins  []int64
+}
+
 func PlainTelegramMessage(ctx context.Context, m pubsub.Message) error {
 	var msgRequest soqchi.PlainMessage
 	err := json.Unmarshal(m.Data, &msgRequest)
@@ -17,6 +37,74 @@ func PlainTelegramMessage(ctx context.Context, m pubsub.Message) error {
 		return fmt.Errorf("can't unmarshal %q as %T: %w", string(m.Data), msgRequest, err)
 	}
 
-	return telegram.NewSender().Send(msgRequest.Chats, msgRequest.Message)
+	n := &notification{
+		notifier: notify.FromEnv(telegram.NewSender()),
+	}
+	if msgRequest.DeviceID != "" {
+		if n.storage, err = storage.New(ctx); err != nil {
+			return fmt.Errorf("can't initialize storage: %w", err)
+		}
+	}
+	return n.handle(ctx, &msgRequest)
+}
+
+func (n *notification) handle(ctx context.Context, m *soqchi.PlainMessage) error {
+	if m.DeviceID == "" {
+		n.deliver(ctx, m.Chats, nil, m.Message)
+		return nil
+	}
+
+	// chyba úložiště nesmí zabránit doručení zprávy do Telegramu
+	device, err := n.storage.Device(ctx, m.DeviceID)
+	if err != nil {
+		log.Printf("device %s: %s", m.DeviceID, err.Error())
+	}
+	if device == nil {
+		device = &soqchi.Device{ID: m.DeviceID, Name: m.DeviceID}
+	}
+	n.deliver(ctx, m.Chats, device, m.Message)
+	return nil
+}
 
+// deliver doručí text chatům chats a u zpráv týkajících se zařízení device i jeho odběratelům
+// v dalších kanálech. Chyby doručení se jen zalogují (viz notify.Dispatcher.Send).
+func (n *notification) deliver(ctx context.Context, chats []int64, device *soqchi.Device, text string) {
+	recipients := telegramRecipients(chats)
+	if device == nil {
+		n.notifier.Send(ctx, recipients, notify.Message{Title: notificationTitle, Text: text})
+		return
+	}
+	recipients = append(recipients, n.subscriptions(ctx, device)...)
+	n.notifier.Send(ctx, recipients, deviceNotification(device, text))
+}
+
+// subscriptions vrací odběratele zařízení v dalších kanálech. Chyba úložiště se jen zaloguje, aby
+// nezabránila doručení zprávy do Telegramu.
+func (n *notification) subscriptions(ctx context.Context, device *soqchi.Device) []soqchi.Subscription {
+	subs, err := n.storage.Subscriptions(ctx, device.ID)
+	if err != nil {
+		log.Printf("subscriptions of device %s: %s", device.ID, err.Error())
+	}
+	return subs
+}
+
+func telegramRecipients(chats []int64) []soqchi.Subscription {
+	recipients := make([]soqchi.Subscription, 0, len(chats))
+	for _, c := range chats {
+		recipients = append(recipients, telegramRecipient(c))
+	}
+	return recipients
+}
+
+func telegramRecipient(chatID int64) soqchi.Subscription {
+	return soqchi.Subscription{Channel: soqchi.ChannelTelegram, Address: strconv.FormatInt(chatID, 10)}
+}
+
+// deviceNotification vrací zprávu týkající se zařízení s titulkem podle jeho názvu
+func deviceNotification(device *soqchi.Device, text string) notify.Message {
+	return notify.Message{
+		DeviceID: device.ID,
+		Title:    fmt.Sprintf("%s - %s", notificationTitle, device.Name),
+		Text:     text,
+	}
 }
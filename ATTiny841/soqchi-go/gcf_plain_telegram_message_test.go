@@ -0,0 +1,57 @@
+package soqchigfc
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/notify"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"testing"
+	"time"
+)
+
+type testNotifier struct {
+	recipients []soqchi.Subscription
+	msg        notify.Message
+	// sent jsou všechny odeslané zprávy, recipients a msg jsou z poslední
+	sent []sentMessage
+}
+
+type sentMessage struct {
+	recipients []soqchi.Subscription
+	msg        notify.Message
+}
+
+func (n *testNotifier) Send(_ context.Context, recipients []soqchi.Subscription, msg notify.Message) {
+	n.recipients = recipients
+	n.msg = msg
+	n.sent = append(n.sent, sentMessage{recipients: recipients, msg: msg})
+}
+
+func TestNotification(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddSubscription(ctx, "ABC", soqchi.Subscription{Channel: soqchi.ChannelEmail, Address: "babicka@example.com",
+		CreatedAt: time.Now()})
+
+	tn := &testNotifier{}
+	n := &notification{storage: store, notifier: tn}
+
+	if err := n.handle(ctx, &soqchi.PlainMessage{Chats: []int64{42}, Message: "‼️ chata (ABC) - ALARM", DeviceID: "ABC"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tn.recipients) != 2 || tn.recipients[0].Address != "42" || tn.recipients[1].Channel != soqchi.ChannelEmail {
+		t.Errorf("unexpected recipients %#v", tn.recipients)
+	}
+	if tn.msg.Title != "soqchi - chata" || tn.msg.DeviceID != "ABC" {
+		t.Errorf("unexpected message %#v", tn.msg)
+	}
+
+	// zprávy bez zařízení jdou jen do chatů
+	if err := n.handle(ctx, &soqchi.PlainMessage{Chats: []int64{1}, Message: "❓ neznámé zařízení"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tn.recipients) != 1 || tn.recipients[0].Channel != soqchi.ChannelTelegram || tn.msg.Title != "soqchi" {
+		t.Errorf("unexpected recipients %#v", tn.recipients)
+	}
+}
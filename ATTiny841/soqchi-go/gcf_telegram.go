@@ -3,17 +3,19 @@ package soqchigfc
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/ISim/Arduino/soqchigfc/firestore"
+	"github.com/ISim/Arduino/soqchigfc/i18n"
+	"github.com/ISim/Arduino/soqchigfc/pubsub"
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
 	"github.com/ISim/Arduino/soqchigfc/telegram"
-	"github.com/wcharczuk/go-chart/v2"
-	"github.com/wcharczuk/go-chart/v2/drawing"
 	"io"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,12 +29,23 @@ type telegramUpdate struct {
 		FromUser() string
 		ChatID() int64
 		Command() (string, string)
+		CallbackData() string
+		AnswerCallback(text string) error
+		RemoveButtons() error
+		SendText(chatID int64, msg string) error
+		SendButtons(chatID int64, msg string, buttons ...telegram.Button) error
 		SendImage(chatID int64, name string, img io.Reader, size int64) error
 	}
-	storage interface {
-		AddUser(ctx context.Context, deviceID string, chatID int64, username string) error
-		DeviceInfo(ctx context.Context, deviceID string) (*soqchi.DeviceInfo, error)
+	storage storage.Storage
+	publish interface {
+		Event(ctx context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error
 	}
+
+	// admins jsou chaty administrátorů, kteří smí převzít neznámá zařízení do evidence
+	admins []int64
+
+	// catalog jsou šablony textů v jazycích, které si chat může zvolit příkazem /lang
+	catalog *i18n.Catalog
 }
 
 func TelegramHTTPReceiver(w http.ResponseWriter, r *http.Request) {
@@ -54,15 +67,24 @@ func TelegramHTTPReceiver(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	storage, err := firestore.New(ctx)
+	store, err := storage.New(ctx)
 	if err != nil {
-		log.Printf("firestore initialization failed error: %s", err.Error())
+		log.Printf("storage initialization failed error: %s", err.Error())
+		return
+	}
+
+	publish, err := pubsub.NewPublisher()
+	if err != nil {
+		log.Printf("pub/sub initialization failed error: %s", err.Error())
 		return
 	}
 
 	tMsg := &telegramUpdate{
 		botRq:   msg,
-		storage: storage,
+		storage: store,
+		publish: publish,
+		admins:  soqchi.AdminChats(),
+		catalog: i18n.FromEnv(),
 	}
 
 	if err := tMsg.handle(ctx); err != nil {
@@ -72,165 +94,1222 @@ func TelegramHTTPReceiver(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *telegramUpdate) handle(ctx context.Context, ) error {
+	if data := a.botRq.CallbackData(); data != "" {
+		return a.callback(ctx, data)
+	}
+
 	cmd, argLine := a.botRq.Command()
 	_ = argLine
 
 	switch cmd {
 	case "register":
 		return a.cmdRegister(ctx, argLine)
+	case "unregister":
+		return a.cmdUnregister(ctx, argLine)
+	case "devices":
+		return a.cmdDevices(ctx)
+	case "status":
+		return a.cmdStatus(ctx, argLine)
+	case "whoami":
+		return a.cmdWhoami(ctx)
 	case "voltage":
 		return a.cmdVoltageChart(ctx, argLine)
+	case "temp":
+		return a.cmdTempChart(ctx, argLine)
+	case "activity":
+		return a.cmdActivity(ctx, argLine)
+	case "signal":
+		return a.cmdSignal(ctx, argLine)
+	case "unclaimed":
+		return a.cmdUnclaimed(ctx)
+	case "claim":
+		return a.cmdClaim(ctx, argLine)
+	case "arm", "disarm", "allow":
+		return a.cmdAccess(ctx, cmd, argLine)
+	case "schedule":
+		return a.cmdSchedule(ctx, argLine)
+	case "invite":
+		return a.cmdInvite(ctx, argLine)
+	case "join":
+		return a.cmdJoin(ctx, argLine)
+	case "revoke":
+		return a.cmdRevoke(ctx, argLine)
+	case "limits":
+		return a.cmdLimits(ctx, argLine)
+	case "channels":
+		return a.cmdChannels(ctx, argLine)
+	case "lang":
+		return a.cmdLang(ctx, argLine)
 	}
 	return nil
 }
 
+// cmdVoltageChart zašle graf napětí baterie z heartbeatů, argumenty jsou "<deviceID> [7d|30d|90d|all]"
 func (a *telegramUpdate) cmdVoltageChart(ctx context.Context, argLine string) error {
-	deviceID := strings.Trim(argLine, " \n\t\r\"")
-	if deviceID == "" {
+	args := strings.Fields(strings.Trim(argLine, " \n\t\r\""))
+	if len(args) == 0 {
 		// tiše vymlčíme - kdo neví, co zadat, ať nevidí graf
 		return nil
 	}
 
-	info, err := a.storage.DeviceInfo(ctx, strings.Trim(argLine, " \n\t\r\""))
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+	limit := device.Thresholds.WithDefaults().VoltageLow
+	return a.heartbeatChart(ctx, device, args[1:], "stat", func(data soqchi.Heartbeats, w io.Writer) error {
+		return voltageChart(data, limit, w)
+	}, "🔋")
+}
+
+// cmdTempChart zašle graf denních minimálních, maximálních a průměrných teplot z heartbeatů,
+// argumenty jsou "<deviceID> [počet dní|all]"
+func (a *telegramUpdate) cmdTempChart(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return nil
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+	return a.heartbeatChart(ctx, device, args[1:], "temp", temperatureChart, "🌡")
+}
+
+// chartTemplate jsou data šablon odpovědí na příkazy s grafy
+type chartTemplate struct {
+	Device *soqchi.Device
+	Icon   string
+	// Period je zadané období grafu, MaxDays nejdelší období zadané počtem dní
+	Period  string
+	MaxDays int
+	// Days je období grafu aktivity ve dnech, Count počet otevření dveří a Total jejich celková doba
+	Days, Count int
+	Total       string
+}
+
+const (
+	// chartDays je výchozí počet dní v grafech z heartbeatů
+	chartDays = 30
+	// chartMaxDays je nejdelší období zadané počtem dní, delší historii lze zobrazit přes "all"
+	chartMaxDays = 366
+	// chartMaxHeartbeats omezuje počet načtených heartbeatů (a tím čtení z Firestore) pro "all" - při
+	// jednom heartbeatu denně zhruba dva roky
+	chartMaxHeartbeats = 730
+)
+
+// parseChartDays převede období grafu ("7d", "30", "all") na počet dní, 0 znamená celou historii
+func parseChartDays(s string) (int, bool) {
+	if s == "all" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || n <= 0 || n > chartMaxDays {
+		return 0, false
+	}
+	return n, true
+}
+
+// heartbeatChart načte heartbeaty zařízení za období dle args a pošle z nich vykreslený graf
+func (a *telegramUpdate) heartbeatChart(ctx context.Context, device *soqchi.Device, args []string, name string,
+	render func(data soqchi.Heartbeats, w io.Writer) error, icon string) error {
+
+	days := chartDays
+	if len(args) > 0 {
+		var ok bool
+		if days, ok = parseChartDays(args[0]); !ok {
+			return a.reply(ctx, device, "chart.period", chartTemplate{Device: device, Period: args[0]})
+		}
+	}
+
+	now := time.Now()
+	var from time.Time
+	if days > 0 {
+		from = now.AddDate(0, 0, -days)
+	}
+	hbs, err := a.storage.Heartbeats(ctx, device.ID, from, now, chartMaxHeartbeats)
 	if err != nil {
 		return err
 	}
+
 	var png = bytes.NewBuffer(nil)
-	err = voltageChart(info.HeartBeats, png)
+	err = render(hbs, png)
+	if errors.Is(err, errNoChartData) {
+		return a.reply(ctx, device, "chart.nodata", chartTemplate{Device: device, Icon: icon})
+	}
+	if err != nil {
+		return fmt.Errorf("graph creation failed: %w", err)
+	}
+
+	return a.botRq.SendImage(a.botRq.ChatID(), name, png, int64(png.Len()))
+}
+
+// cmdActivity zašle časovou osu otevření dveří a heatmapu otevření podle dne v týdnu a hodiny,
+// argumenty jsou "<deviceID> [počet dní]"
+func (a *telegramUpdate) cmdActivity(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return nil
+	}
+
+	days := chartDays
+	if len(args) > 1 {
+		var ok bool
+		// historie zpráv se čte celá, období je proto vždy omezené
+		if days, ok = parseChartDays(args[1]); !ok || days == 0 {
+			return a.reply(ctx, nil, "activity.period", chartTemplate{Period: args[1], MaxDays: chartMaxDays})
+		}
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+
+	// zprávy před začátkem období určí, zda byly dveře na jeho začátku otevřené
+	now := time.Now()
+	from := now.AddDate(0, 0, -days)
+	msgs, err := a.storage.Messages(ctx, device.ID, from.AddDate(0, 0, -statusDays), now)
+	if err != nil {
+		return err
+	}
+
+	intervals := soqchi.DoorIntervalsFrom(msgs, from)
+	var total time.Duration
+	for _, i := range intervals {
+		total += i.Duration(now)
+	}
+	data := chartTemplate{Device: device, Days: days, Count: len(intervals), Total: formatDuration(total.Round(time.Minute))}
+	if err := a.reply(ctx, device, "activity", data); err != nil || len(intervals) == 0 {
+		return err
+	}
+
+	weekdays, err := a.text(ctx, device, "weekdays", nil)
 	if err != nil {
+		return err
+	}
+
+	loc := device.Location()
+	var png = bytes.NewBuffer(nil)
+	if err := activityTimelineChart(intervals, from, now, loc, png); err != nil {
 		return fmt.Errorf("graph creation failed: %w", err)
 	}
+	if err := a.botRq.SendImage(a.botRq.ChatID(), "activity", png, int64(png.Len())); err != nil {
+		return err
+	}
+
+	png = bytes.NewBuffer(nil)
+	if err := activityHeatmapChart(soqchi.NewActivityHeatmap(intervals, loc), strings.Fields(weekdays), png); err != nil {
+		return fmt.Errorf("graph creation failed: %w", err)
+	}
+	return a.botRq.SendImage(a.botRq.ChatID(), "heatmap", png, int64(png.Len()))
+}
+
+// signalDays je počet dní, ze kterých se počítá souhrn kvality spojení
+const signalDays = 30
+
+// cmdSignal pošle souhrn kvality rádiového spojení zařízení - podle něj lze odlišit slabou
+// baterii od špatně umístěné antény
+func (a *telegramUpdate) cmdSignal(ctx context.Context, argLine string) error {
+	deviceID := strings.Trim(argLine, " \n\t\r\"")
+	if deviceID == "" {
+		return nil
+	}
+
+	device, err := a.subscribedDevice(ctx, deviceID)
+	if err != nil || device == nil {
+		return err
+	}
+
+	now := time.Now()
+	msgs, err := a.storage.Messages(ctx, deviceID, now.AddDate(0, 0, -signalDays), now)
+	if err != nil {
+		return err
+	}
+
+	return a.reply(ctx, device, "signal", signalTemplate{Device: device, Days: signalDays, Signal: soqchi.Signal(msgs)})
+}
+
+// signalTemplate jsou data šablony příkazu /signal
+type signalTemplate struct {
+	Device *soqchi.Device
+	Days   int
+	Signal soqchi.SignalQuality
+}
+
+// cmdUnclaimed vypíše administrátorovi neznámá zařízení, která posílají zprávy
+func (a *telegramUpdate) cmdUnclaimed(ctx context.Context) error {
+	if !soqchi.IsAdmin(a.admins, a.botRq.ChatID()) {
+		return nil
+	}
+
+	devices, err := a.storage.UnclaimedDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return a.reply(ctx, nil, "unclaimed", struct{ Devices []*soqchi.UnclaimedDevice }{devices})
+}
+
+// cmdClaim převezme neznámé zařízení do evidence, argumenty jsou "<deviceID> [název]"
+func (a *telegramUpdate) cmdClaim(ctx context.Context, argLine string) error {
+	if !soqchi.IsAdmin(a.admins, a.botRq.ChatID()) {
+		return nil
+	}
+
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return a.reply(ctx, nil, "claim.usage", nil)
+	}
+	deviceID, name := args[0], args[0]
+	if len(args) > 1 {
+		name = strings.Join(args[1:], " ")
+	}
+
+	claimed, err := a.storage.ClaimDevice(ctx, deviceID, name)
+	if err != nil {
+		return err
+	}
+	data := commandTemplate{Device: &soqchi.Device{ID: deviceID, Name: name}}
+	if !claimed {
+		return a.reply(ctx, nil, "claim.unknown", data)
+	}
+	return a.reply(ctx, nil, "claim.done", data)
+}
+
+// commandTemplate jsou data šablon jednoduchých odpovědí na příkazy
+type commandTemplate struct {
+	Device *soqchi.Device
+	// DeviceID je zadané ID zařízení, pokud se zařízení nenačítá
+	DeviceID string
+	// Value je neplatná hodnota zadaná v příkazu, Error popis chyby
+	Value string
+	Error string
+}
+
+// subscribedDevice vrací zařízení dle ID, pokud je k němu chat přihlášen. Pro neznámé zařízení nebo
+// nepřihlášený chat vrací nil - na takové příkazy se tiše neodpovídá.
+func (a *telegramUpdate) subscribedDevice(ctx context.Context, deviceID string) (*soqchi.Device, error) {
+	device, err := a.storage.Device(ctx, deviceID)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	chats, err := a.storage.AllChats(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chats {
+		if c == a.botRq.ChatID() {
+			return device, nil
+		}
+	}
+	return nil, nil
+}
+
+// cmdAccess obslouží příkazy /arm <device>, /disarm <device> a /allow <device> <doba>, které
+// nastavují AccessAllowed zasílaný zařízení. Změna se oznámí událostí EventAccessChanged.
+func (a *telegramUpdate) cmdAccess(ctx context.Context, cmd, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 || (cmd == "allow" && len(args) < 2) {
+		return a.reply(ctx, nil, "access.usage", nil)
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+
+	now := time.Now()
+	data := soqchi.AccessChanged{By: a.botRq.FromUser()}
+	switch cmd {
+	case "disarm":
+		data.Allowed = true
+	case "allow":
+		d, err := parseDuration(args[1])
+		if err != nil || d <= 0 {
+			return a.reply(ctx, device, "duration.invalid", commandTemplate{Device: device, Value: args[1]})
+		}
+		data.Allowed = true
+		data.Until = now.Add(d)
+	}
+
+	if err := a.storage.SetAccess(ctx, device.ID, data.Allowed, data.Until); err != nil {
+		return err
+	}
+	return a.publish.Event(ctx, soqchi.EventAccessChanged, device.ID, now, data)
+}
+
+// cmdSchedule spravuje týdenní rozvrh oken s očekávaným přístupem:
+//
+//	/schedule <device>                          vypíše rozvrh
+//	/schedule <device> add út 9:00-12:00 [pozn] přidá okno
+//	/schedule <device> del <číslo>              odebere okno dle pořadí ve výpisu
+//	/schedule <device> clear                    smaže celý rozvrh
+func (a *telegramUpdate) cmdSchedule(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return a.reply(ctx, nil, "schedule.usage", nil)
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
 
-	return a.botRq.SendImage(a.botRq.ChatID(), "stat", png, int64(png.Len()))
+	windows := device.AccessWindows
+	data := soqchi.ScheduleChanged{By: a.botRq.FromUser()}
+
+	switch {
+	case len(args) == 1:
+		return a.reply(ctx, device, "schedule", scheduleTemplate{Device: device, Windows: windows})
+
+	case args[1] == "add":
+		w, err := soqchi.ParseAccessWindow(strings.Join(args[2:], " "))
+		if err != nil {
+			return a.reply(ctx, device, "schedule.invalid", commandTemplate{Device: device, Error: err.Error()})
+		}
+		windows = append(windows, w)
+		data.Window, data.Added = &w, true
+
+	case args[1] == "del" && len(args) == 3:
+		i, err := strconv.Atoi(args[2])
+		if err != nil || i < 1 || i > len(windows) {
+			return a.reply(ctx, device, "schedule.unknown", commandTemplate{Device: device, Value: args[2]})
+		}
+		w := windows[i-1]
+		data.Window = &w
+		windows = append(windows[:i-1:i-1], windows[i:]...)
+
+	case args[1] == "clear":
+		windows = nil
+
+	default:
+		return a.reply(ctx, device, "schedule.usage", nil)
+	}
+
+	if err := a.storage.SetAccessWindows(ctx, device.ID, windows); err != nil {
+		return err
+	}
+	return a.publish.Event(ctx, soqchi.EventScheduleChanged, device.ID, time.Now(), data)
 }
 
+// scheduleTemplate jsou data šablony výpisu rozvrhu příkazem /schedule
+type scheduleTemplate struct {
+	Device  *soqchi.Device
+	Windows soqchi.AccessSchedule
+}
+
+// parseDuration rozšiřuje time.ParseDuration o dny, např. "1d"
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// cmdRegister přihlásí chat k odběru zpráv ze zařízení. První přihlášený se stane vlastníkem
+// zařízení, každé další přihlášení musí vlastník (u zařízení bez vlastníka administrátor) schválit.
 func (a *telegramUpdate) cmdRegister(ctx context.Context, argLine string) error {
+	deviceID := strings.Trim(argLine, " \n\t\r\"")
+	chatID := a.botRq.ChatID()
+
+	device, err := a.storage.Device(ctx, deviceID)
+	if err != nil || device == nil {
+		// neznámé zařízení - tiše vymlčíme, ať nejde zkoušet, která ID existují
+		return err
+	}
+
+	ch, err := a.storage.Chat(ctx, deviceID, chatID)
+	if err != nil {
+		return err
+	}
+	if ch != nil {
+		if ch.Pending {
+			return a.reply(ctx, device, "register.pending", registerTemplate{Device: device})
+		}
+		return a.reply(ctx, device, "register.subscribed", registerTemplate{Device: device})
+	}
 
-	return a.storage.AddUser(ctx, strings.Trim(argLine, " \n\t\r\""), a.botRq.ChatID(), a.botRq.FromUser())
+	if device.OwnerChatID == 0 {
+		owner, err := a.storage.ClaimOwnership(ctx, deviceID, chatID, a.botRq.FromUser())
+		if err != nil {
+			return err
+		}
+		if owner {
+			return a.reply(ctx, device, "register.owner", registerTemplate{Device: device})
+		}
+	}
+
+	// vlastníkem se mezitím mohl stát jiný chat
+	if device, err = a.storage.Device(ctx, deviceID); err != nil || device == nil {
+		return err
+	}
+	approvers, err := a.approvers(ctx, device)
+	if err != nil {
+		return err
+	}
+	if len(approvers) == 0 {
+		return a.reply(ctx, device, "register.noapprover", registerTemplate{Device: device})
+	}
+
+	if err := a.storage.AddPendingUser(ctx, deviceID, chatID, a.botRq.FromUser()); err != nil {
+		return err
+	}
+
+	data := registerTemplate{Device: device, Requester: a.botRq.FromUser()}
+	if data.Requester == "" {
+		data.Requester = strconv.FormatInt(chatID, 10)
+	}
+	for _, c := range approvers {
+		logErr(a.sendApproval(ctx, c, chatID, data))
+	}
+	return a.reply(ctx, device, "register.sent", data)
+}
+
+// cmdUnregister odhlásí chat od odběru zpráv ze zařízení, případně zruší jeho žádost o přihlášení
+func (a *telegramUpdate) cmdUnregister(ctx context.Context, argLine string) error {
+	deviceID := strings.Trim(argLine, " \n\t\r\"")
+	if deviceID == "" {
+		return a.reply(ctx, nil, "unregister.usage", nil)
+	}
+
+	ch, err := a.storage.Chat(ctx, deviceID, a.botRq.ChatID())
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		return a.reply(ctx, nil, "unregister.unknown", commandTemplate{DeviceID: deviceID})
+	}
+	if err := a.storage.RemoveUser(ctx, deviceID, a.botRq.ChatID()); err != nil {
+		return err
+	}
+	return a.reply(ctx, nil, "unregister.done", commandTemplate{DeviceID: deviceID})
 }
 
-func roundUnix(t time.Time) float64 {
-	return float64(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, soqchi.TZ).Unix())
+// cmdDevices vypíše zařízení, ke kterým je chat přihlášen
+func (a *telegramUpdate) cmdDevices(ctx context.Context) error {
+	devices, err := a.storage.ChatDevices(ctx, a.botRq.ChatID())
+	if err != nil {
+		return err
+	}
+	return a.reply(ctx, nil, "devices", struct {
+		Devices []*soqchi.Device
+		Now     time.Time
+	}{devices, time.Now()})
 }
 
-func genTicks(min, max, step float64) []chart.Tick {
-	var ticks []chart.Tick
-	tmp := min
-	var format = "%.1f"
-	if step == math.Floor(step) {
-		format = "%.f"
+// statusDays je počet dní historie zpráv, ve kterých se hledá poslední stav dveří a heartbeat
+const statusDays = 30
+
+// cmdStatus pošle aktuální přehled zařízení - stav dveří, poslední heartbeat, zastřežení a stav dle
+// watchdogu. Bez argumentu se použije zařízení, pokud je chat přihlášen právě k jednomu.
+func (a *telegramUpdate) cmdStatus(ctx context.Context, argLine string) error {
+	var device *soqchi.Device
+
+	if deviceID := strings.Trim(argLine, " \n\t\r\""); deviceID != "" {
+		d, err := a.subscribedDevice(ctx, deviceID)
+		if err != nil || d == nil {
+			return err
+		}
+		device = d
+	} else {
+		devices, err := a.storage.ChatDevices(ctx, a.botRq.ChatID())
+		if err != nil {
+			return err
+		}
+		if len(devices) != 1 {
+			return a.reply(ctx, nil, "status.usage", nil)
+		}
+		device = devices[0]
 	}
-	for ; tmp <= max; tmp += step {
-		ticks = append(ticks, chart.Tick{
-			Value: tmp,
-			Label: fmt.Sprintf(format, tmp),
-		})
+
+	now := time.Now()
+	msgs, err := a.storage.Messages(ctx, device.ID, now.AddDate(0, 0, -statusDays), now)
+	if err != nil {
+		return err
 	}
-	return ticks
+
+	data := statusTemplate{Device: device, Now: now, SilentHours: now.Sub(device.LastMessageAt).Hours(),
+		Armed: !device.AccessEnabled(now), Health: device.Health(now).String()}
+	for i := len(msgs) - 1; i >= 0 && (data.LastState == nil || data.LastBeat == nil); i-- {
+		m := &msgs[i]
+		if data.LastState == nil && (m.Alarm() || m.Info()) {
+			data.LastState = m
+		}
+		if data.LastBeat == nil && m.Hartbeat() {
+			data.LastBeat = m
+		}
+	}
+	if device.AccessAllowed && now.Before(device.AccessAllowedUntil) {
+		data.AllowedUntil = device.AccessAllowedUntil
+	}
+
+	f, ok, err := predictBattery(ctx, a.storage, device, now)
+	if err != nil {
+		return err
+	}
+	if ok {
+		data.Forecast = f
+		data.DaysLeft, data.Falling = f.DaysLeft(now)
+	}
+
+	return a.reply(ctx, device, "status", data)
 }
 
-func voltageChart(data soqchi.Heartbeats, w io.Writer) error {
-	var (
-		XOsa, YVolt []float64
-		iMin        int
+// statusTemplate jsou data šablony příkazu /status
+type statusTemplate struct {
+	Device *soqchi.Device
+	Now    time.Time
+	// LastState je poslední zpráva se stavem dveří, LastBeat poslední heartbeat - nil, pokud v historii nejsou
+	LastState, LastBeat *soqchi.LoggedMessage
+	// SilentHours je počet hodin od poslední zprávy
+	SilentHours float64
+	// Armed je true pro zastřežené zařízení, AllowedUntil je konec dočasně povoleného přístupu
+	Armed        bool
+	AllowedUntil time.Time
+	// Forecast je odhad vybití baterie (nil bez odhadu), DaysLeft je počet dní do dosažení limitu,
+	// pokud napětí klesá (Falling)
+	Forecast *soqchi.BatteryForecast
+	DaysLeft int
+	Falling  bool
+	// Health je stav zařízení dle watchdogu (soqchi.Health.String)
+	Health string
+}
+
+// cmdWhoami pošle ID chatu a jeho roli - administrátor, vlastník či odběratel zařízení
+func (a *telegramUpdate) cmdWhoami(ctx context.Context) error {
+	chatID := a.botRq.ChatID()
+	devices, err := a.storage.ChatDevices(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	var owned, subscribed []string
+	for _, d := range devices {
+		if d.OwnerChatID == chatID {
+			owned = append(owned, d.ID)
+		} else {
+			subscribed = append(subscribed, d.ID)
+		}
+	}
+
+	return a.reply(ctx, nil, "whoami", whoamiTemplate{
+		ChatID:     chatID,
+		User:       a.botRq.FromUser(),
+		Admin:      soqchi.IsAdmin(a.admins, chatID),
+		Owned:      strings.Join(owned, ", "),
+		Subscribed: strings.Join(subscribed, ", "),
+	})
+}
+
+// whoamiTemplate jsou data šablony příkazu /whoami, Owned a Subscribed jsou seznamy ID zařízení
+type whoamiTemplate struct {
+	ChatID            int64
+	User              string
+	Admin             bool
+	Owned, Subscribed string
+}
+
+const (
+	callbackApprove = "approve"
+	callbackReject  = "reject"
+)
+
+// registerTemplate jsou data šablon žádosti o přihlášení k zařízení, jejího vyřízení a pozvánek
+type registerTemplate struct {
+	Device    *soqchi.Device
+	Requester string
+	// Code je kód pozvánky, ExpiresAt konec její platnosti
+	Code      string
+	ExpiresAt time.Time
+}
+
+// sendApproval pošle schvalovateli approver žádost chatu chatID o přihlášení s tlačítky pro schválení
+// a zamítnutí
+func (a *telegramUpdate) sendApproval(ctx context.Context, approver, chatID int64, data registerTemplate) error {
+	lang, loc := a.chatLocale(ctx, approver, data.Device.Location())
+	var texts [3]string
+	for i, name := range []string{"register.request", "register.approve", "register.reject"} {
+		var err error
+		if texts[i], err = a.catalog.Render(lang, name, loc, data); err != nil {
+			return err
+		}
+	}
+	return a.botRq.SendButtons(approver, texts[0],
+		telegram.Button{Text: texts[1], Data: approvalData(callbackApprove, data.Device.ID, chatID)},
+		telegram.Button{Text: texts[2], Data: approvalData(callbackReject, data.Device.ID, chatID)},
 	)
+}
+
+// approvalData sestaví data tlačítka pro schválení či zamítnutí žádosti ve tvaru "<akce>:<deviceID>:<chatID>"
+func approvalData(action, deviceID string, chatID int64) string {
+	return fmt.Sprintf("%s:%s:%d", action, deviceID, chatID)
+}
+
+// callback obslouží stisk tlačítka schválení nebo zamítnutí žádosti o přihlášení. Rozhodnout
+// smí jen vlastník zařízení nebo administrátor.
+func (a *telegramUpdate) callback(ctx context.Context, data string) error {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return a.botRq.AnswerCallback("")
+	}
+	action, deviceID := parts[0], parts[1]
+	chatID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return a.botRq.AnswerCallback("")
+	}
+
+	device, err := a.storage.Device(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return a.answer(ctx, "callback.denied")
+	}
+	approvers, err := a.approvers(ctx, device)
+	if err != nil {
+		return err
+	}
+	if !containsChat(approvers, a.botRq.ChatID()) {
+		return a.answer(ctx, "callback.denied")
+	}
+
+	ch, err := a.storage.Chat(ctx, deviceID, chatID)
+	if err != nil {
+		return err
+	}
+	if ch == nil || !ch.Pending {
+		// žádost vyřídil jiný schvalovatel, tlačítka už nemají smysl
+		logErr(a.botRq.RemoveButtons())
+		return a.answer(ctx, "callback.handled")
+	}
 
-	for i, v := range data {
-		if data[iMin].Voltage >= v.Voltage {
-			iMin = i
+	var answer string
+	switch action {
+	case callbackApprove:
+		if _, err := a.storage.ApproveUser(ctx, deviceID, chatID); err != nil {
+			return err
 		}
-		nD := roundUnix(v.At)
+		logErr(a.sendTemplateTo(ctx, chatID, device, "register.approved", registerTemplate{Device: device}))
+		answer = "callback.approved"
+	case callbackReject:
+		if err := a.storage.RemoveUser(ctx, deviceID, chatID); err != nil {
+			return err
+		}
+		logErr(a.sendTemplateTo(ctx, chatID, device, "register.rejected", registerTemplate{Device: device}))
+		answer = "callback.rejected"
+	default:
+		return a.botRq.AnswerCallback("")
+	}
+	// po rozhodnutí se tlačítka odstraní, aby žádost nešlo vyřídit znovu
+	logErr(a.botRq.RemoveButtons())
+	return a.answer(ctx, answer)
+}
 
-		l := len(XOsa)
-		if l > 0 {
-			pD := XOsa[l-1]
-			if nD == pD {
-				YVolt[l-1] = (YVolt[l-1] + v.Voltage) / 2
-				continue
-			}
-			daysWithoutRecod := 0
-			tmpD := pD
-			for tmpD+float64(26*time.Hour) < nD {
-				daysWithoutRecod++
-				tmpD += float64(24 * time.Hour)
+// approvers vrací chaty, které schvalují přihlášení k zařízení - vlastníka, u zařízení bez vlastníka
+// administrátory. Bez administrátorů schvalují chaty přihlášené k zařízení dřív, než mělo vlastníka,
+// jinak by se k takovému zařízení nikdo další přihlásit nemohl.
+func (a *telegramUpdate) approvers(ctx context.Context, device *soqchi.Device) ([]int64, error) {
+	switch {
+	case device.OwnerChatID != 0:
+		return []int64{device.OwnerChatID}, nil
+	case len(a.admins) > 0:
+		return a.admins, nil
+	}
+	return a.storage.AllChats(ctx, device.ID)
+}
+
+// containsChat vrací true, pokud je chatID mezi chats
+func containsChat(chats []int64, chatID int64) bool {
+	for _, c := range chats {
+		if c == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// isManager vrací true, pokud chat smí spravovat přihlášení k zařízení - je jeho vlastníkem nebo administrátorem
+func (a *telegramUpdate) isManager(device *soqchi.Device) bool {
+	return device.OwnerChatID == a.botRq.ChatID() || soqchi.IsAdmin(a.admins, a.botRq.ChatID())
+}
+
+// inviteValidity je výchozí platnost pozvánky
+const inviteValidity = 24 * time.Hour
+
+// cmdInvite vytvoří jednorázovou pozvánku k zařízení, argumenty jsou "<deviceID> [platnost]"
+func (a *telegramUpdate) cmdInvite(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return a.reply(ctx, nil, "invite.usage", nil)
+	}
+
+	device, err := a.storage.Device(ctx, args[0])
+	if err != nil || device == nil || !a.isManager(device) {
+		return err
+	}
+
+	validity := inviteValidity
+	if len(args) > 1 {
+		if validity, err = parseDuration(args[1]); err != nil || validity <= 0 {
+			return a.reply(ctx, device, "duration.invalid", commandTemplate{Device: device, Value: args[1]})
+		}
+	}
+
+	code, err := soqchi.NewInviteCode()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	invite := &soqchi.Invite{
+		Code:      code,
+		DeviceID:  device.ID,
+		CreatedBy: a.botRq.ChatID(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(validity),
+	}
+	if err := a.storage.SaveInvite(ctx, invite); err != nil {
+		return err
+	}
+	return a.reply(ctx, device, "invite.created", registerTemplate{Device: device, Code: code, ExpiresAt: invite.ExpiresAt})
+}
+
+// cmdJoin uplatní pozvánku a přihlásí chat k odběru zpráv ze zařízení bez schvalování vlastníkem
+func (a *telegramUpdate) cmdJoin(ctx context.Context, argLine string) error {
+	code := strings.ToUpper(strings.Trim(argLine, " \n\t\r\""))
+	if code == "" {
+		return a.reply(ctx, nil, "join.usage", nil)
+	}
+
+	invite, err := a.storage.Invite(ctx, code)
+	if err != nil {
+		return err
+	}
+	if invite != nil {
+		// už přihlášený chat pozvánku nespotřebuje
+		ch, err := a.storage.Chat(ctx, invite.DeviceID, a.botRq.ChatID())
+		if err != nil {
+			return err
+		}
+		if ch != nil && !ch.Pending {
+			return a.reply(ctx, nil, "join.subscribed", registerTemplate{Device: &soqchi.Device{ID: invite.DeviceID}})
+		}
+		invite, err = a.storage.RedeemInvite(ctx, code, a.botRq.ChatID(), a.botRq.FromUser(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if invite == nil {
+		return a.reply(ctx, nil, "join.invalid", nil)
+	}
+
+	device, err := a.storage.Device(ctx, invite.DeviceID)
+	if err != nil || device == nil {
+		return err
+	}
+
+	data := registerTemplate{Device: device, Requester: a.botRq.FromUser(), Code: code}
+	if data.Requester == "" {
+		data.Requester = strconv.FormatInt(a.botRq.ChatID(), 10)
+	}
+	logErr(a.sendTemplateTo(ctx, invite.CreatedBy, device, "invite.used", data))
+	return a.reply(ctx, device, "join.done", data)
+}
+
+// cmdRevoke zruší dosud nepoužitou pozvánku. Smí ji zrušit ten, kdo ji vytvořil, vlastník zařízení nebo administrátor.
+func (a *telegramUpdate) cmdRevoke(ctx context.Context, argLine string) error {
+	code := strings.ToUpper(strings.Trim(argLine, " \n\t\r\""))
+	if code == "" {
+		return a.reply(ctx, nil, "revoke.usage", nil)
+	}
+
+	invite, err := a.storage.Invite(ctx, code)
+	if err != nil || invite == nil {
+		return err
+	}
+	if invite.CreatedBy != a.botRq.ChatID() {
+		device, err := a.storage.Device(ctx, invite.DeviceID)
+		if err != nil || device == nil || !a.isManager(device) {
+			return err
+		}
+	}
+
+	revoked, err := a.storage.RevokeInvite(ctx, code, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return a.reply(ctx, nil, "revoke.failed", registerTemplate{Code: code})
+	}
+	return a.reply(ctx, nil, "revoke.done", registerTemplate{Code: code})
+}
+
+// thresholdKeys jsou názvy limitů pro příkaz /limits v pořadí výpisu
+var thresholdKeys = []string{"heartbeat", "grace", "low", "critical", "tmin", "tmax", "hyst"}
+
+// cmdLimits vypíše nebo nastaví limity zařízení, podle kterých ho kontroluje watchdog a hlídá teplotu:
+//
+//	/limits <device>                  vypíše limity
+//	/limits <device> low 3.3          nastaví limit (jen vlastník nebo administrátor)
+//	/limits <device> tmin default     vrátí limit na výchozí hodnotu
+func (a *telegramUpdate) cmdLimits(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) != 1 && len(args) != 3 {
+		return a.reply(ctx, nil, "limits.usage", nil)
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return a.reply(ctx, device, "limits", thresholdsTemplate(device))
+	}
+
+	if !a.isManager(device) {
+		return a.reply(ctx, device, "limits.forbidden", nil)
+	}
+
+	t := device.Thresholds.Copy()
+	if err := setThreshold(&t, args[1], args[2]); err != nil {
+		return a.reply(ctx, device, "limits.invalid", err)
+	}
+	if err := a.storage.SetThresholds(ctx, device.ID, t); err != nil {
+		return err
+	}
+
+	value, isDefault := thresholdValue(t, args[1])
+	return a.publish.Event(ctx, soqchi.EventLimitsChanged, device.ID, time.Now(), soqchi.LimitsChanged{
+		Limit:   args[1],
+		Value:   value,
+		Default: isDefault,
+		By:      a.botRq.FromUser(),
+	})
+}
+
+// cmdChannels spravuje odběry zpráv ze zařízení v dalších kanálech pro ty, kdo nepoužívají Telegram:
+//
+//	/channels <device>                              vypíše odběry
+//	/channels <device> add email babicka@example.com přidá odběr (jen vlastník nebo administrátor)
+//	/channels <device> del <číslo>                  odebere odběr dle pořadí ve výpisu
+func (a *telegramUpdate) cmdChannels(ctx context.Context, argLine string) error {
+	args := strings.Fields(argLine)
+	if len(args) == 0 {
+		return a.reply(ctx, nil, "channels.usage", nil)
+	}
+
+	device, err := a.subscribedDevice(ctx, args[0])
+	if err != nil || device == nil {
+		return err
+	}
+
+	subs, err := a.storage.Subscriptions(ctx, device.ID)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return a.reply(ctx, device, "channels", channelsTemplate{Device: device, Subscriptions: subs, ChatID: a.botRq.ChatID()})
+	}
+
+	if !a.isManager(device) {
+		return a.reply(ctx, device, "channels.forbidden", nil)
+	}
+
+	var data soqchi.SubscriptionChanged
+	switch {
+	case args[1] == "add" && len(args) == 4:
+		sub, err := soqchi.ParseSubscription(args[2], args[3])
+		if err != nil {
+			return a.reply(ctx, device, "channels.invalid", commandTemplate{Device: device, Error: err.Error()})
+		}
+		if sub.Channel == soqchi.ChannelWebhook {
+			// každý webhook má vlastní klíč podpisu, zná ho jen ten, kdo webhook přidal
+			if sub.Secret, err = soqchi.NewWebhookSecret(); err != nil {
+				return err
 			}
-			kV := (v.Voltage - YVolt[l-1]) / float64(daysWithoutRecod+1)
-			for i := 1; i <= daysWithoutRecod; i++ {
-				XOsa = append(XOsa, pD+float64(i*24*int(time.Hour)))
-				YVolt = append(YVolt, float64(i)*kV+YVolt[l-1])
+		}
+		sub.CreatedBy = a.botRq.ChatID()
+		sub.CreatedAt = time.Now()
+		if err := a.storage.AddSubscription(ctx, device.ID, sub); err != nil {
+			return err
+		}
+		if sub.Secret != "" {
+			if err := a.reply(ctx, device, "channels.secret", struct{ Subscription soqchi.Subscription }{sub}); err != nil {
+				return err
 			}
+		}
+		data = soqchi.SubscriptionChanged{Channel: sub.Channel, Address: sub.Address, Added: true}
+
+	case args[1] == "del" && len(args) == 3:
+		i, err := strconv.Atoi(args[2])
+		if err != nil || i < 1 || i > len(subs) {
+			return a.reply(ctx, device, "channels.unknown", commandTemplate{Device: device, Value: args[2]})
+		}
+		sub := subs[i-1]
+		if _, err := a.storage.RemoveSubscription(ctx, device.ID, sub.Channel, sub.Address); err != nil {
+			return err
+		}
+		data = soqchi.SubscriptionChanged{Channel: sub.Channel, Address: sub.Address}
+
+	default:
+		return a.reply(ctx, device, "channels.usage", nil)
+	}
 
+	data.By = a.botRq.FromUser()
+	return a.publish.Event(ctx, soqchi.EventSubscriptionChanged, device.ID, time.Now(), data)
+}
+
+// channelsTemplate jsou data šablony výpisu odběrů zařízení. U webhooků přidaných chatem ChatID se
+// vypíše i klíč podpisu - klíč webhooků přidaných před zavedením podpisů vygenerovala migrace, jinak
+// by se o něm nedozvěděli.
+type channelsTemplate struct {
+	Device        *soqchi.Device
+	Subscriptions []soqchi.Subscription
+	ChatID        int64
+}
+
+// setThreshold nastaví limit key na hodnotu value, "default" vrací limit na výchozí hodnotu
+func setThreshold(t *soqchi.Thresholds, key, value string) error {
+	reset := value == "default"
+	var (
+		d time.Duration
+		f float64
+	)
+	if !reset {
+		var err error
+		switch key {
+		case "heartbeat", "grace":
+			d, err = parseDuration(value)
+		default:
+			f, err = strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		}
+		// ParseFloat přijme i "NaN" a "Inf", se kterými by porovnání limitů nikdy neplatilo
+		if err != nil || d < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return &thresholdError{Reason: "value", Key: key, Value: value}
+		}
+	}
+
+	switch key {
+	case "heartbeat":
+		t.HeartbeatInterval = d
+	case "grace":
+		t.HeartbeatGrace = d
+	case "low":
+		t.VoltageLow = f
+	case "critical":
+		t.VoltageCritical = f
+	case "tmin":
+		t.TempMin = &f
+		if reset {
+			t.TempMin = nil
+		}
+	case "tmax":
+		t.TempMax = &f
+		if reset {
+			t.TempMax = nil
+		}
+	case "hyst":
+		t.TempHysteresis = f
+	default:
+		return &thresholdError{Reason: "unknown", Key: key, Value: value}
+	}
+
+	if !reset && (d == 0 && (key == "heartbeat" || key == "grace") || f <= 0 && (key == "low" || key == "critical" || key == "hyst")) {
+		return &thresholdError{Reason: "positive", Key: key, Value: value}
+	}
+	e := t.WithDefaults()
+	if e.VoltageCritical >= e.VoltageLow {
+		return &thresholdError{Reason: "voltage", Key: key, Value: value, Low: e.VoltageLow, Critical: e.VoltageCritical}
+	}
+	if t.TempMin != nil && t.TempMax != nil && *t.TempMin >= *t.TempMax {
+		return &thresholdError{Reason: "temperature", Key: key, Value: value}
+	}
+	return nil
+}
+
+// thresholdError je chyba nastavení limitu, zároveň data šablony "limits.invalid" s textem pro uživatele
+type thresholdError struct {
+	// Reason je druh chyby: "value" (neplatná hodnota), "unknown" (neznámý limit), "positive" (limit musí
+	// být kladný), "voltage" (kritické napětí není nižší než nízké) nebo "temperature" (tmin není nižší než tmax)
+	Reason        string
+	Key, Value    string
+	Low, Critical float64
+}
+
+func (e *thresholdError) Error() string {
+	return fmt.Sprintf("invalid limit %s %q: %s", e.Key, e.Value, e.Reason)
+}
+
+// thresholdValue vrací hodnotu limitu key s jednotkou a true, jde-li o výchozí hodnotu. Prázdná hodnota
+// znamená, že se limit nekontroluje (tmin, tmax).
+func thresholdValue(t soqchi.Thresholds, key string) (string, bool) {
+	e := t.WithDefaults()
+	var (
+		v     string
+		isSet bool
+	)
+	switch key {
+	case "heartbeat":
+		v, isSet = formatDuration(e.HeartbeatInterval), t.HeartbeatInterval > 0
+	case "grace":
+		v, isSet = formatDuration(e.HeartbeatGrace), t.HeartbeatGrace > 0
+	case "low":
+		v, isSet = fmt.Sprintf("%.2f V", e.VoltageLow), t.VoltageLow > 0
+	case "critical":
+		v, isSet = fmt.Sprintf("%.2f V", e.VoltageCritical), t.VoltageCritical > 0
+	case "tmin":
+		if t.TempMin == nil {
+			return "", false
+		}
+		return fmt.Sprintf("%.1f °C", *t.TempMin), false
+	case "tmax":
+		if t.TempMax == nil {
+			return "", false
 		}
+		return fmt.Sprintf("%.1f °C", *t.TempMax), false
+	case "hyst":
+		v, isSet = fmt.Sprintf("%.1f °C", e.TempHysteresis), t.TempHysteresis > 0
+	}
+	return v, !isSet
+}
+
+// limitValue je hodnota limitu ve výpisu příkazem /limits, prázdná znamená bez kontroly
+type limitValue struct {
+	Key, Value string
+	Default    bool
+}
+
+// thresholdsTemplate vrací data šablony výpisu všech limitů zařízení
+func thresholdsTemplate(device *soqchi.Device) interface{} {
+	limits := make([]limitValue, 0, len(thresholdKeys))
+	for _, key := range thresholdKeys {
+		v, isDefault := thresholdValue(device.Thresholds, key)
+		limits = append(limits, limitValue{Key: key, Value: v, Default: isDefault})
+	}
+	return struct {
+		Device *soqchi.Device
+		Limits []limitValue
+	}{device, limits}
+}
+
+// formatDuration vypíše dobu ve dnech, pokud je dělitelná celými dny, jinak jako time.Duration
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// langTemplate jsou data šablon příkazu /lang
+type langTemplate struct {
+	TimeZone  string
+	Languages string
+}
+
+// cmdLang nastaví jazyk a časovou zónu zpráv o událostech zařízení pro chat, argumenty jsou
+// "<jazyk> [časová zóna]". Bez časové zóny se časy uvádějí v časové zóně zařízení.
+func (a *telegramUpdate) cmdLang(ctx context.Context, argLine string) error {
+	chatID := a.botRq.ChatID()
+	settings, err := a.storage.ChatSettings(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		settings = &soqchi.ChatSettings{ChatID: chatID}
+	}
+
+	args := strings.Fields(argLine)
+	if len(args) == 0 || len(args) > 2 || a.catalog.Lang(args[0]) != args[0] || len(args) == 2 && !isTimeZone(args[1]) {
+		return a.sendTemplate(settings.Lang, "lang.usage", langTemplate{Languages: strings.Join(a.catalog.Languages(), ", ")})
+	}
+
+	settings.Lang = args[0]
+	settings.TimeZone = ""
+	if len(args) == 2 {
+		settings.TimeZone = args[1]
+	}
+	if err := a.storage.SaveChatSettings(ctx, *settings); err != nil {
+		return err
+	}
+	return a.sendTemplate(settings.Lang, "lang.set", langTemplate{TimeZone: settings.TimeZone})
+}
+
+// isTimeZone vrací true pro IANA název časové zóny (např. Europe/Prague)
+func isTimeZone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return err == nil && name != "" && name != "Local"
+}
+
+// sendTemplate pošle do chatu text šablony name v jazyce lang
+func (a *telegramUpdate) sendTemplate(lang, name string, data interface{}) error {
+	txt, err := a.catalog.Render(lang, name, soqchi.TZ, data)
+	if err != nil {
+		return err
+	}
+	return a.botRq.SendText(a.botRq.ChatID(), txt)
+}
+
+// sendTemplateTo pošle chatu chatID text šablony name o zařízení device v jazyce a časové zóně chatu
+func (a *telegramUpdate) sendTemplateTo(ctx context.Context, chatID int64, device *soqchi.Device, name string, data interface{}) error {
+	lang, loc := a.chatLocale(ctx, chatID, device.Location())
+	txt, err := a.catalog.Render(lang, name, loc, data)
+	if err != nil {
+		return err
+	}
+	return a.botRq.SendText(chatID, txt)
+}
 
-		XOsa = append(XOsa, nD)
-		YVolt = append(YVolt, v.Voltage)
-	}
-
-	graph := chart.Chart{
-		Background: chart.Style{
-			Padding: chart.Box{
-				Top:    50,
-				Left:   10,
-				Right:  25,
-				Bottom: 10,
-			},
-			FillColor: drawing.ColorFromHex("eeeeee"),
-		},
-		XAxis: chart.XAxis{
-			Name:         "Time",
-			TickPosition: chart.TickPositionBetweenTicks,
-			ValueFormatter: func(v interface{}) string {
-				vf := v.(float64)
-				t := time.Unix(int64(vf), 0)
-				return t.Format("02.01")
-			},
-		},
-
-		YAxis: chart.YAxis{
-			Name: " ",
-			NameStyle: chart.Style{
-				TextRotationDegrees: 270,
-			},
-			Style: chart.Style{
-				Padding:   chart.NewBox(10, 10, 10, 10),
-				FillColor: drawing.ColorFromHex("efefef"),
-			},
-
-			TickStyle: chart.Style{
-				TextRotationDegrees: 315,
-			},
-
-			Ticks: genTicks(1.5, 3.5, 0.5),
-		},
-
-		Series: []chart.Series{
-
-			chart.ContinuousSeries{
-				Name:    "Voltage",
-				YAxis:   chart.YAxisPrimary,
-				XValues: XOsa,
-				Style: chart.Style{
-					StrokeColor: drawing.ColorFromHex("008800"),
-					FillColor:   drawing.ColorFromHex("CCFFCC"),
-				},
-				YValues: YVolt,
-			},
-			chart.AnnotationSeries{
-				YAxis: chart.YAxisPrimary,
-				Annotations: []chart.Value2{
-					{
-						XValue: roundUnix(data[iMin].At),
-						YValue: data[iMin].Voltage,
-						Label:  fmt.Sprintf("Min %.2fV", data[iMin].Voltage),
-					},
-				},
-			},
-		},
-	}
-	graph.Elements = []chart.Renderable{
-		chart.Legend(&graph),
-	}
-
-	err := graph.Render(chart.PNG, w)
-	return err
+// reply odpoví na příkaz textem šablony name - viz text
+func (a *telegramUpdate) reply(ctx context.Context, device *soqchi.Device, name string, data interface{}) error {
+	txt, err := a.text(ctx, device, name, data)
+	if err != nil {
+		return err
+	}
+	return a.botRq.SendText(a.botRq.ChatID(), txt)
+}
+
+// answer odpoví na stisk tlačítka textem šablony name v jazyce chatu
+func (a *telegramUpdate) answer(ctx context.Context, name string) error {
+	txt, err := a.text(ctx, nil, name, nil)
+	if err != nil {
+		return err
+	}
+	return a.botRq.AnswerCallback(txt)
+}
+
+// text vrací text šablony name v jazyce chatu, který poslal příkaz. Časy jsou v časové zóně chatu,
+// není-li nastavena, pak v časové zóně zařízení device (nil pro odpovědi, které se zařízení netýkají).
+func (a *telegramUpdate) text(ctx context.Context, device *soqchi.Device, name string, data interface{}) (string, error) {
+	def := soqchi.TZ
+	if device != nil {
+		def = device.Location()
+	}
+	lang, loc := a.chatLocale(ctx, a.botRq.ChatID(), def)
+	return a.catalog.Render(lang, name, loc, data)
+}
+
+// chatLocale vrací jazyk a časovou zónu zpráv chatu, bez nastavené časové zóny def. Chyba úložiště
+// se jen zaloguje, zpráva pak bude ve výchozím jazyce.
+func (a *telegramUpdate) chatLocale(ctx context.Context, chatID int64, def *time.Location) (string, *time.Location) {
+	settings, err := a.storage.ChatSettings(ctx, chatID)
+	if err != nil {
+		log.Printf("settings of chat %d: %s", chatID, err.Error())
+	}
+	if settings == nil {
+		return "", def
+	}
+	return settings.Lang, settings.Location(def)
 }
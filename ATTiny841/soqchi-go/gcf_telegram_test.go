@@ -0,0 +1,764 @@
+package soqchigfc
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/i18n"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/telegram"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBot struct {
+	chatID   int64
+	username string
+	cmd      string
+	args     string
+	data     string
+	texts    []string
+	// to jsou chaty, kterým šly zprávy v texts
+	to      []int64
+	buttons map[int64][]telegram.Button
+	answers []string
+	images  int
+	// removed je počet zpráv, ze kterých se odstranila tlačítka
+	removed int
+}
+
+func (b *testBot) FromUser() string          { return b.username }
+func (b *testBot) ChatID() int64             { return b.chatID }
+func (b *testBot) Command() (string, string) { return b.cmd, b.args }
+func (b *testBot) CallbackData() string      { return b.data }
+func (b *testBot) AnswerCallback(text string) error {
+	b.answers = append(b.answers, text)
+	return nil
+}
+func (b *testBot) RemoveButtons() error {
+	b.removed++
+	return nil
+}
+func (b *testBot) SendText(chatID int64, msg string) error {
+	b.texts = append(b.texts, msg)
+	b.to = append(b.to, chatID)
+	return nil
+}
+func (b *testBot) SendButtons(chatID int64, msg string, buttons ...telegram.Button) error {
+	if b.buttons == nil {
+		b.buttons = map[int64][]telegram.Button{}
+	}
+	b.buttons[chatID] = buttons
+	return b.SendText(chatID, msg)
+}
+func (b *testBot) SendImage(_ int64, _ string, _ io.Reader, _ int64) error {
+	b.images++
+	return nil
+}
+
+func TestCmdSignal(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	now := time.Now()
+	for i, seq := range []int{100, 101, 104} {
+		seq := seq
+		_ = store.SaveMessage(ctx, &soqchi.Message{
+			DeviceID:    "ABC",
+			At:          now.Add(time.Duration(i-3) * time.Hour),
+			SeqNumber:   &seq,
+			RSSI:        -120,
+			SNR:         10,
+			Station:     "1F2A",
+			LinkQuality: "GOOD",
+		}, "")
+	}
+
+	bot := &testBot{chatID: 42, cmd: "signal", args: "ABC"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 {
+		t.Fatalf("expected one reply, got %#v", bot.texts)
+	}
+	for _, exp := range []string{"chata", "RSSI -120.0 dBm", "stanice 1F2A", "3 zpráv", "ztraceno 2 zpráv"} {
+		if !strings.Contains(bot.texts[0], exp) {
+			t.Errorf("reply %q does not contain %q", bot.texts[0], exp)
+		}
+	}
+
+	// nepřihlášený chat údaje o signálu nedostane
+	bot = &testBot{chatID: 43, cmd: "signal", args: "ABC"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 0 {
+		t.Errorf("expected no reply for unsubscribed chat, got %#v", bot.texts)
+	}
+}
+
+func TestCmdClaim(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	_, _ = store.SaveUnclaimed(ctx, &soqchi.Message{DeviceID: "NEW", At: time.Now(), Raw: "81"})
+
+	// ostatní uživatelé zařízení převzít nemohou
+	bot := &testBot{chatID: 42, cmd: "claim", args: "NEW chata"}
+	tu := &telegramUpdate{botRq: bot, storage: store, admins: []int64{7}, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "NEW"); d != nil || len(bot.texts) != 0 {
+		t.Fatalf("non-admin must not claim device")
+	}
+
+	bot.chatID = 7
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := store.Device(ctx, "NEW")
+	if d == nil || d.Name != "chata" {
+		t.Fatalf("expected claimed device, got %#v", d)
+	}
+	if unclaimed, _ := store.UnclaimedDevices(ctx); len(unclaimed) != 0 {
+		t.Errorf("claimed device should not stay unclaimed")
+	}
+}
+
+func TestCmdAccess(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddUser(ctx, "ABC", 43, "pepa")
+
+	pub := &testPublisher{}
+	bot := &testBot{chatID: 42, username: "franta"}
+	tu := &telegramUpdate{botRq: bot, storage: store, publish: pub, catalog: testCatalog(t)}
+
+	run := func(cmd, args string) *soqchi.Device {
+		t.Helper()
+		bot.cmd, bot.args = cmd, args
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+		d, _ := store.Device(ctx, "ABC")
+		return d
+	}
+
+	if d := run("disarm", "ABC"); !d.AccessEnabled(time.Now().Add(24 * time.Hour)) {
+		t.Error("expected unlimited access after /disarm")
+	}
+	if d := run("arm", "ABC"); d.AccessEnabled(time.Now()) {
+		t.Error("expected no access after /arm")
+	}
+	d := run("allow", "ABC 2h")
+	if !d.AccessEnabled(time.Now()) || d.AccessEnabled(time.Now().Add(2*time.Hour+time.Minute)) {
+		t.Errorf("expected access for 2 hours, got %#v", d)
+	}
+
+	texts := pub.texts(t, store)
+	if len(texts) != 3 || texts[0] != "🔓 chata (ABC) odstřeženo (franta)" || texts[1] != "🔒 chata (ABC) zastřeženo (franta)" ||
+		!strings.Contains(texts[2], "povolen do") {
+		t.Errorf("expected access changed events, got %q", texts)
+	}
+
+	// nepřihlášený chat přístup měnit nemůže
+	bot.chatID = 99
+	if d := run("arm", "ABC"); !d.AccessAllowed || len(pub.events) != 3 {
+		t.Error("unsubscribed chat must not change access")
+	}
+}
+
+func TestCmdSchedule(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	bot := &testBot{chatID: 42, cmd: "schedule"}
+	tu := &telegramUpdate{botRq: bot, storage: store, publish: pub, catalog: testCatalog(t)}
+
+	for _, args := range []string{"ABC add út 9:00-12:00 úklid", "ABC add so 8-10", "ABC del 1", "ABC"} {
+		bot.args = args
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, _ := store.Device(ctx, "ABC")
+	if len(d.AccessWindows) != 1 || d.AccessWindows[0].Weekday != time.Saturday {
+		t.Errorf("unexpected schedule %#v", d.AccessWindows)
+	}
+	texts := pub.texts(t, store)
+	if len(texts) != 3 || texts[2] != "🗓 chata (ABC) - odebráno okno očekávaného přístupu út 9:00-12:00 úklid" {
+		t.Errorf("unexpected confirmations %#v", texts)
+	}
+	if len(bot.texts) != 1 || !strings.Contains(bot.texts[0], "1. so 8:00-10:00") {
+		t.Errorf("unexpected schedule listing %#v", bot.texts)
+	}
+}
+
+func TestCmdRegisterApproval(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+
+	// neznámé zařízení se tiše ignoruje
+	bot := &testBot{chatID: 42, username: "franta", cmd: "register", args: "XYZ"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 0 {
+		t.Fatalf("unknown device must not be answered, got %#v", bot.texts)
+	}
+
+	// první přihlášený je vlastník
+	bot.args = "ABC"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "ABC"); d.OwnerChatID != 42 {
+		t.Fatalf("expected owner 42, got %d", d.OwnerChatID)
+	}
+
+	// další přihlášení čeká na schválení a zprávy nedostává, žádost dostane vlastník v jeho jazyce
+	_ = store.SaveChatSettings(ctx, soqchi.ChatSettings{ChatID: 42, Lang: i18n.English})
+	bot = &testBot{chatID: 43, username: "pepa", cmd: "register", args: "ABC"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chats, _ := store.AllChats(ctx, "ABC"); len(chats) != 1 || chats[0] != 42 {
+		t.Fatalf("pending chat must not receive messages, got %v", chats)
+	}
+	buttons := bot.buttons[42]
+	if len(buttons) != 2 || buttons[0].Text != "✅ approve" {
+		t.Fatalf("owner should get approve/reject buttons, got %#v", bot.buttons)
+	}
+	if bot.texts[0] != "🙋 pepa asks to subscribe to device chata (ABC)" {
+		t.Errorf("unexpected approval request %q", bot.texts[0])
+	}
+
+	// schválit smí jen vlastník
+	bot = &testBot{chatID: 43, data: buttons[0].Data}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 43); !ch.Pending {
+		t.Fatalf("requester must not approve himself")
+	}
+
+	bot = &testBot{chatID: 42, data: buttons[0].Data}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chats, _ := store.AllChats(ctx, "ABC"); len(chats) != 2 {
+		t.Fatalf("approved chat should receive messages, got %v", chats)
+	}
+	if len(bot.to) != 1 || bot.to[0] != 43 || bot.texts[0] != "✅ přihlášení k zařízení chata (ABC) bylo schváleno" {
+		t.Errorf("requester should be notified, got %v %#v", bot.to, bot.texts)
+	}
+	if bot.removed != 1 {
+		t.Errorf("buttons should be removed after decision")
+	}
+
+	// opakovaný stisk tlačítka už nic nevyřizuje
+	bot = &testBot{chatID: 42, data: buttons[1].Data}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 43); ch == nil || ch.Pending || len(bot.texts) != 0 {
+		t.Errorf("decided request must not be processed again, got %#v %#v", ch, bot.texts)
+	}
+
+	// zamítnutá žádost se smaže
+	_ = store.AddPendingUser(ctx, "ABC", 44, "karel")
+	bot = &testBot{chatID: 42, data: approvalData(callbackReject, "ABC", 44)}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 44); ch != nil {
+		t.Errorf("rejected request should be removed, got %#v", ch)
+	}
+}
+
+func TestCmdUnregisterOwner(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", OwnerChatID: 42})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	bot := &testBot{chatID: 42, cmd: "unregister", args: "ABC"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "ABC"); d.OwnerChatID != 0 {
+		t.Fatalf("unregistered owner must lose ownership, got %d", d.OwnerChatID)
+	}
+
+	// bývalý vlastník nemůže vytvářet pozvánky, zařízení si může převzít další přihlášený
+	bot = &testBot{chatID: 42, cmd: "invite", args: "ABC"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 0 {
+		t.Errorf("former owner must not create invites, got %#v", bot.texts)
+	}
+	bot = &testBot{chatID: 43, username: "pepa", cmd: "register", args: "ABC"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "ABC"); d.OwnerChatID != 43 {
+		t.Errorf("next chat should become owner, got %d", d.OwnerChatID)
+	}
+}
+
+func TestCmdRegisterWithoutOwner(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	// zařízení bez vlastníka s chatem přihlášeným před zavedením vlastníků, bez administrátorů
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	bot := &testBot{chatID: 43, username: "pepa", cmd: "register", args: "ABC"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	buttons := bot.buttons[42]
+	if len(buttons) != 2 {
+		t.Fatalf("subscribed chat should get approve/reject buttons, got %#v", bot.buttons)
+	}
+
+	bot = &testBot{chatID: 42, data: buttons[0].Data}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 43); ch == nil || ch.Pending {
+		t.Errorf("request should be approved, got %#v", ch)
+	}
+}
+
+func TestCmdInvite(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", OwnerChatID: 42})
+
+	// pozvánku vytváří jen vlastník
+	bot := &testBot{chatID: 43, cmd: "invite", args: "ABC"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 0 {
+		t.Fatalf("non-owner must not create invites, got %#v", bot.texts)
+	}
+
+	bot.chatID = 42
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 {
+		t.Fatalf("expected invite reply, got %#v", bot.texts)
+	}
+	i := strings.Index(bot.texts[0], "/join ")
+	code := strings.TrimSuffix(strings.Fields(bot.texts[0][i+len("/join "):])[0], ",")
+
+	bot = &testBot{chatID: 43, username: "pepa", cmd: "join", args: strings.ToLower(code)}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chats, _ := store.AllChats(ctx, "ABC"); len(chats) != 1 || chats[0] != 43 {
+		t.Fatalf("joined chat should receive messages, got %v", chats)
+	}
+	if inv, _ := store.Invite(ctx, code); inv.UsedBy != 43 || inv.UsedByName != "pepa" {
+		t.Errorf("invite usage not recorded: %#v", inv)
+	}
+	if len(bot.to) != 2 || bot.to[0] != 42 || bot.texts[0] != "👋 pepa se pozvánkou "+code+" přihlásil k zařízení chata (ABC)" {
+		t.Errorf("invite creator should be notified, got %v %#v", bot.to, bot.texts)
+	}
+
+	// pozvánka je jednorázová
+	bot = &testBot{chatID: 44, cmd: "join", args: code}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 44); ch != nil {
+		t.Errorf("used invite must not be redeemed again")
+	}
+
+	// zrušená pozvánka nejde použít
+	_ = store.SaveInvite(ctx, &soqchi.Invite{Code: "REVOKED1", DeviceID: "ABC", CreatedBy: 42, ExpiresAt: time.Now().Add(time.Hour)})
+	tu.botRq = &testBot{chatID: 42, cmd: "revoke", args: "REVOKED1"}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tu.botRq = &testBot{chatID: 44, cmd: "join", args: "REVOKED1"}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := store.Chat(ctx, "ABC", 44); ch != nil {
+		t.Errorf("revoked invite must not be redeemed")
+	}
+}
+
+func TestCmdDevicesAndUnregister(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", OwnerChatID: 42, Voltage: 3.1})
+	store.PutDevice(soqchi.Device{ID: "DEF", Name: "garáž", AccessAllowed: true})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddUser(ctx, "DEF", 42, "franta")
+
+	bot := &testBot{chatID: 42, username: "franta", cmd: "devices"}
+	tu := &telegramUpdate{botRq: bot, storage: store, admins: []int64{42}, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"chata (ABC) - 🔒 zastřeženo", "garáž (DEF) - 🔓 odstřeženo", "3.100 V"} {
+		if !strings.Contains(bot.texts[0], exp) {
+			t.Errorf("reply %q does not contain %q", bot.texts[0], exp)
+		}
+	}
+
+	bot.cmd = "whoami"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"chat ID 42", "@franta", "administrátor", "vlastník zařízení ABC", "odběratel zařízení DEF"} {
+		if !strings.Contains(bot.texts[1], exp) {
+			t.Errorf("reply %q does not contain %q", bot.texts[1], exp)
+		}
+	}
+
+	bot.cmd, bot.args = "unregister", "DEF"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if devices, _ := store.ChatDevices(ctx, 42); len(devices) != 1 || devices[0].ID != "ABC" {
+		t.Errorf("expected only ABC after unregister, got %#v", devices)
+	}
+}
+
+func TestCmdStatus(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	// poslední heartbeat a zpráva aktualizují zařízení stejně jako příjem zpráv
+	for i := 10; i > 0; i-- {
+		_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -i), 2.4+0.01*float64(i), 5)
+	}
+	_ = store.SaveHeartbeat(ctx, "ABC", now.Add(-5*time.Hour), 2.4, 4.5)
+	_ = store.SaveTimestamp(ctx, "ABC", now.Add(-3*time.Hour))
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-5 * time.Hour), Flags: 0x20, Voltage: 2.4, Temp: 4.5}, "")
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-3 * time.Hour), Flags: 0x41}, "")
+
+	bot := &testBot{chatID: 42, cmd: "status"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 {
+		t.Fatalf("expected one reply, got %#v", bot.texts)
+	}
+	for _, exp := range []string{"chata (ABC)", "🅾️ otevřeno", "2.400 V 🌡 4.5 °C", "před 3 h", "🔒 zastřeženo", "baterie: pod 2.5 V", "nízké napětí"} {
+		if !strings.Contains(bot.texts[0], exp) {
+			t.Errorf("reply %q does not contain %q", bot.texts[0], exp)
+		}
+	}
+
+	// v jazyce a časové zóně chatu
+	_ = store.SaveChatSettings(ctx, soqchi.ChatSettings{ChatID: 42, Lang: i18n.English, TimeZone: "Europe/London"})
+	london, _ := time.LoadLocation("Europe/London")
+	opened := now.Add(-3 * time.Hour).In(london).Format("Jan 2, 15:04")
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"door: 🅾️ open (" + opened + ")", "3 h ago", "🔒 armed", "battery: below 2.5 V", "⚠️ low battery voltage"} {
+		if !strings.Contains(bot.texts[1], exp) {
+			t.Errorf("reply %q does not contain %q", bot.texts[1], exp)
+		}
+	}
+
+	// nepřihlášený chat nedostane nic
+	bot = &testBot{chatID: 43, cmd: "status", args: "ABC"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 0 {
+		t.Errorf("unsubscribed chat must not get status, got %#v", bot.texts)
+	}
+}
+
+func TestCmdTempChart(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	bot := &testBot{chatID: 42, cmd: "temp", args: "ABC 7"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 || bot.images != 0 {
+		t.Fatalf("expected no-data reply, got %#v", bot.texts)
+	}
+
+	now := time.Now()
+	_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -10), 3, 5)
+	_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -2), 3, -1)
+	_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -1), 3, 2)
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bot.images != 1 {
+		t.Errorf("expected chart image, got texts %#v", bot.texts)
+	}
+}
+
+func TestCmdVoltageRange(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	now := time.Now()
+	_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -200), 3.1, 5)
+	_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -100), 3.0, 5)
+
+	for _, tc := range []struct {
+		args   string
+		images int
+	}{
+		{"ABC 7d", 0},
+		{"ABC 90d", 0},
+		{"ABC all", 1},
+		{"ABC 150", 0},
+		{"ABC 201", 1},
+		{"ABC week", 0},
+	} {
+		bot := &testBot{chatID: 42, cmd: "voltage", args: tc.args}
+		tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if bot.images != tc.images || len(bot.texts)+bot.images != 1 {
+			t.Errorf("%s: expected %d images, got %d, texts %#v", tc.args, tc.images, bot.images, bot.texts)
+		}
+	}
+
+	// nepřihlášený chat graf nedostane
+	bot := &testBot{chatID: 43, cmd: "voltage", args: "ABC all"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bot.images != 0 || len(bot.texts) != 0 {
+		t.Errorf("expected no reply for unsubscribed chat, got %d images, texts %#v", bot.images, bot.texts)
+	}
+}
+
+func TestCmdActivity(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	bot := &testBot{chatID: 42, cmd: "activity", args: "ABC 7"}
+	tu := &telegramUpdate{botRq: bot, storage: store, catalog: testCatalog(t)}
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 || bot.images != 0 {
+		t.Fatalf("expected no-activity reply, got %#v", bot.texts)
+	}
+
+	// otevření před začátkem období se započítá od začátku období
+	now := time.Now()
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-172 * time.Hour), Flags: 0x81}, "")
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-160 * time.Hour), Flags: 0x40}, "")
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-50 * time.Hour), Flags: 0x81}, "")
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-49 * time.Hour), Flags: 0x40}, "")
+	_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-2 * time.Hour), Flags: 0x81}, "")
+
+	bot = &testBot{chatID: 42, cmd: "activity", args: "ABC 7"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if bot.images != 2 || len(bot.texts) != 1 || !strings.Contains(bot.texts[0], "3× otevřeno") {
+		t.Errorf("expected summary and two charts, got %d images, texts %#v", bot.images, bot.texts)
+	}
+}
+
+func TestCmdLimits(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", OwnerChatID: 42})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddUser(ctx, "ABC", 43, "pepa")
+
+	pub := &testPublisher{}
+	bot := &testBot{chatID: 42, cmd: "limits"}
+	tu := &telegramUpdate{botRq: bot, storage: store, publish: pub, catalog: testCatalog(t)}
+
+	for _, args := range []string{"ABC heartbeat 2d", "ABC low 3,3", "ABC critical 3.1", "ABC tmin -5", "ABC tmin x",
+		"ABC critical 3.5", "ABC tmax NaN", "ABC hyst +Inf", "ABC"} {
+		bot.args = args
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, _ := store.Device(ctx, "ABC")
+	th := d.Thresholds
+	if th.HeartbeatInterval != 48*time.Hour || th.VoltageLow != 3.3 || th.VoltageCritical != 3.1 ||
+		th.TempMin == nil || *th.TempMin != -5 || th.TempMax != nil {
+		t.Errorf("unexpected thresholds %#v", th)
+	}
+	if texts := pub.texts(t, store); len(texts) != 4 || texts[1] != "📏 chata (ABC) - limit low nastaven na 3.30 V" {
+		t.Errorf("unexpected confirmations %#v", texts)
+	}
+	if len(bot.texts) != 5 {
+		t.Fatalf("expected 4 errors and listing, got %#v", bot.texts)
+	}
+	for _, exp := range []string{"heartbeat: 2d\n", "grace: 1h (výchozí)", "low: 3.30 V", "tmin: -5.0 °C", "tmax: bez kontroly"} {
+		if !strings.Contains(bot.texts[4], exp) {
+			t.Errorf("listing %q does not contain %q", bot.texts[4], exp)
+		}
+	}
+
+	// návrat na výchozí hodnotu
+	bot.args = "ABC tmin default"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "ABC"); d.Thresholds.TempMin != nil {
+		t.Errorf("expected default tmin, got %v", *d.Thresholds.TempMin)
+	}
+	if texts := pub.texts(t, store); texts[4] != "📏 chata (ABC) - limit tmin nastaven na bez kontroly" {
+		t.Errorf("unexpected confirmation %q", texts[4])
+	}
+
+	// odběratel limity vidí, ale nemůže je měnit
+	bot = &testBot{chatID: 43, cmd: "limits", args: "ABC low 2"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.Device(ctx, "ABC"); d.Thresholds.VoltageLow != 3.3 {
+		t.Errorf("subscriber must not change limits, got %#v", d.Thresholds)
+	}
+}
+
+func TestCmdChannels(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", OwnerChatID: 42})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	_ = store.AddUser(ctx, "ABC", 43, "pepa")
+
+	pub := &testPublisher{}
+	bot := &testBot{chatID: 42, cmd: "channels"}
+	tu := &telegramUpdate{botRq: bot, storage: store, publish: pub, catalog: testCatalog(t)}
+
+	for _, args := range []string{"ABC add email babicka@example.com", "ABC add ntfy chata-alarm", "ABC add sms 123",
+		"ABC add webhook example.com", "ABC add webhook http://169.254.169.254/", "ABC del 1", "ABC del 5", "ABC"} {
+		bot.args = args
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subs, _ := store.Subscriptions(ctx, "ABC")
+	if len(subs) != 1 || subs[0].Channel != soqchi.ChannelNtfy || subs[0].Address != "chata-alarm" || subs[0].CreatedBy != 42 {
+		t.Errorf("unexpected subscriptions %#v", subs)
+	}
+	if texts := pub.texts(t, store); len(texts) != 3 || texts[2] != "📭 chata (ABC) - zrušen odběr zpráv email babicka@example.com" {
+		t.Errorf("unexpected confirmations %#v", texts)
+	}
+	if len(bot.texts) != 5 || !strings.Contains(bot.texts[4], "1. ntfy chata-alarm") {
+		t.Fatalf("expected 4 errors and listing, got %#v", bot.texts)
+	}
+
+	// klíč podpisu webhooku dostane jen chat, který webhook přidal
+	bot.texts = nil
+	bot.args = "ABC add webhook https://example.com/hook"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	subs, _ = store.Subscriptions(ctx, "ABC")
+	if len(subs) != 2 || len(subs[1].Secret) != 64 || len(bot.texts) != 1 || !strings.Contains(bot.texts[0], subs[1].Secret) {
+		t.Errorf("expected webhook secret to be sent to the chat, got %#v, %#v", subs, bot.texts)
+	}
+	if texts := pub.texts(t, store); strings.Contains(texts[3], subs[1].Secret) {
+		t.Errorf("webhook secret must not be published, got %q", texts[3])
+	}
+	bot.texts = nil
+	bot.args = "ABC"
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.texts) != 1 || !strings.Contains(bot.texts[0], "🔑 "+subs[1].Secret) {
+		t.Errorf("listing should show the secret to its creator, got %#v", bot.texts)
+	}
+	_, _ = store.RemoveSubscription(ctx, "ABC", soqchi.ChannelWebhook, "https://example.com/hook")
+
+	// odběratel odběry vidí, ale nemůže je měnit
+	bot = &testBot{chatID: 43, cmd: "channels", args: "ABC del 1"}
+	tu.botRq = bot
+	if err := tu.handle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := store.Subscriptions(ctx, "ABC"); len(subs) != 1 {
+		t.Errorf("subscriber must not change subscriptions, got %#v", subs)
+	}
+}
+
+func TestCmdLang(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	bot := &testBot{chatID: 42, cmd: "lang"}
+	tu := &telegramUpdate{botRq: bot, storage: store, publish: &testPublisher{}, catalog: testCatalog(t)}
+
+	for _, args := range []string{"", "de", "en Mars/Olympus", "en Europe/London", "cs"} {
+		bot.args = args
+		if err := tu.handle(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(bot.texts) != 5 || !strings.Contains(bot.texts[0], "jazyky: cs, en") || !strings.Contains(bot.texts[2], "použití") {
+		t.Errorf("expected usage for invalid arguments, got %#v", bot.texts)
+	}
+	if bot.texts[3] != "🌐 messages will be in English, times in the Europe/London time zone" ||
+		bot.texts[4] != "🌐 zprávy budou česky, časy v časové zóně zařízení" {
+		t.Errorf("unexpected confirmations %#v", bot.texts[3:])
+	}
+	if s, _ := store.ChatSettings(ctx, 42); s == nil || *s != (soqchi.ChatSettings{ChatID: 42, Lang: "cs"}) {
+		t.Errorf("unexpected settings %#v", s)
+	}
+}
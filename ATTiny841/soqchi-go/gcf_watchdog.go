@@ -4,22 +4,40 @@ import (
 	gps "cloud.google.com/go/pubsub"
 	"context"
 	"fmt"
-	"github.com/ISim/Arduino/soqchigfc/firestore"
 	"github.com/ISim/Arduino/soqchigfc/pubsub"
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
 	"log"
+	"os"
+	"strconv"
 	"time"
 )
 
+const (
+	// envBatteryWarnDays je název proměnné prostředí s počtem dní, kolik předem watchdog upozorní
+	// na odhadovaný pokles napětí baterie pod limit
+	envBatteryWarnDays = "BATTERY_WARN_DAYS"
+	// defaultBatteryWarnDays se použije, pokud proměnná prostředí není nastavena
+	defaultBatteryWarnDays = 14
+	// batteryTrendDays je počet dní heartbeatů, ze kterých se počítá trend napětí baterie
+	batteryTrendDays = 90
+	// envAlertReminder je název proměnné prostředí s intervalem připomínek trvajících upozornění
+	// (např. "1d"), nenastavená znamená bez připomínek
+	envAlertReminder = "ALERT_REMINDER"
+)
+
 type watchdog struct {
 	ctx     context.Context
-	storage interface {
-		AllDevices(ctx context.Context) ([]*soqchi.Device, error)
-		AllChats(ctx context.Context, deviceID string) ([]int64, error)
-	}
+	storage storage.Storage
 	publish interface {
-		PlainMessage(ctx context.Context, chats []int64, msg string) error
+		Event(ctx context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error
 	}
+
+	// batteryWarnDays je počet dní, kolik předem se upozorní na odhadovaný pokles napětí pod limit
+	batteryWarnDays int
+
+	// remind je interval připomínek trvajících upozornění, 0 znamená bez připomínek
+	remind time.Duration
 }
 
 func Watchdog(ctx context.Context, m gps.Message) error {
@@ -27,9 +45,9 @@ func Watchdog(ctx context.Context, m gps.Message) error {
 	// irrelevantni - je nám jedno, co je v payloadu
 	_ = m
 
-	c, err := firestore.New(ctx)
+	c, err := storage.New(ctx)
 	if err != nil {
-		return fmt.Errorf("can't initialize firestore client: %w", err)
+		return fmt.Errorf("can't initialize storage: %w", err)
 	}
 
 	pub, err := pubsub.NewPublisher()
@@ -38,70 +56,105 @@ func Watchdog(ctx context.Context, m gps.Message) error {
 	}
 
 	w := &watchdog{
-		ctx:     ctx,
-		storage: c,
-		publish: pub,
+		ctx:             ctx,
+		storage:         c,
+		publish:         pub,
+		batteryWarnDays: defaultBatteryWarnDays,
+	}
+	if v, err := strconv.Atoi(os.Getenv(envBatteryWarnDays)); err == nil {
+		w.batteryWarnDays = v
+	}
+	if v, err := parseDuration(os.Getenv(envAlertReminder)); err == nil {
+		w.remind = v
 	}
 
 	return w.handle()
 }
 
 func (w *watchdog) handle() error {
-	limit := time.Now().Add(-25 * time.Hour)
+	now := time.Now()
 
 	devices, err := w.storage.AllDevices(w.ctx)
 	if err != nil {
 		return fmt.Errorf("can' retrieve devides list: %w", err)
 	}
 
+	// chyba u jednoho zařízení nesmí zastavit upozornění pro ostatní a jen se zaloguje - opakované
+	// spuštění by znovu poslalo upozornění bez uloženého stavu (např. ztracené zprávy) všem zařízením,
+	// pravidla se stejně vyhodnotí při příštím běhu
 	for _, device := range devices {
-
-		withChat := func(f func(ctx context.Context, device *soqchi.Device, chats []int64) error) error {
-			chats, err := w.storage.AllChats(w.ctx, device.ID)
-			if err != nil {
-				return err
-			}
-			log.Printf("device: %s, chats: %#v", device.ID, chats)
-			return f(w.ctx, device, chats)
-		}
-
-		switch {
-		case device.LastHeartbeatAt.IsZero():
-			err = withChat(w.noHeartbeat)
-		case device.LastHeartbeatAt.Before(limit):
-			err = withChat(w.heartbeatMissing)
-		case device.Voltage < soqchi.VoltageLimit:
-			err = withChat(w.lowVoltage)
+		for _, err := range w.device(w.ctx, device, now) {
+			log.Printf("watchdog device %s: %s", device.ID, err.Error())
 		}
+	}
+	return nil
+}
 
+// device vyhodnotí všechna pravidla pro zařízení a pošle upozornění. Vrací chyby jednotlivých
+// pravidel a upozornění - chyba jednoho pravidla nebrání vyhodnocení ostatních.
+func (w *watchdog) device(ctx context.Context, device *soqchi.Device, now time.Time) []error {
+	var (
+		findings []finding
+		errs     []error
+	)
+	for _, r := range w.rules() {
+		f, err := r.check(ctx, device, now)
 		if err != nil {
-			return fmt.Errorf("can't publish heartbeat missing event for device %s: %w", device.ID, err)
+			errs = append(errs, fmt.Errorf("rule %s: %w", r.name, err))
+			continue
 		}
+		findings = append(findings, f...)
 	}
-
-	return nil
+	if len(findings) == 0 {
+		return errs
+	}
+	return append(errs, w.notify(ctx, device, findings, now)...)
 }
 
-func (w *watchdog) noHeartbeat(ctx context.Context, device *soqchi.Device, chats []int64) error {
-	return w.publish.PlainMessage(ctx, chats, fmt.Sprintf("⚠️ zařízení %s (%s) se dosud neohlásilo",
-		device.Name,
-		device.ID,
-	))
-}
+// notify aktualizuje stavy upozornění podle nálezů a publikuje události jen o změnách stavu, případně
+// připomínky trvajících podmínek. Jednorázové nálezy se publikují vždy, když platí.
+func (w *watchdog) notify(ctx context.Context, device *soqchi.Device, findings []finding, now time.Time) []error {
+	states, err := alertStates(ctx, w.storage, device.ID)
+	if err != nil {
+		return []error{err}
+	}
 
-func (w *watchdog) heartbeatMissing(ctx context.Context, device *soqchi.Device, chats []int64) error {
-	return w.publish.PlainMessage(ctx, chats, fmt.Sprintf("⚠️ zařízení %s (%s) se neohlásilo od %s",
-		device.Name,
-		device.ID,
-		device.LastMessageAt.Format("2.1. 15:04"),
-	))
-}
+	var errs []error
+	for _, f := range findings {
+		if f.once {
+			if f.active {
+				if err := w.publish.Event(ctx, f.event, device.ID, now, f.data(soqchi.Alert{State: soqchi.AlertFired})); err != nil {
+					// bez uloženého času vyhodnocení se upozornění pošle při příštím běhu
+					errs = append(errs, err)
+					continue
+				}
+			}
+			if err := w.storage.SaveAlertState(ctx, device.ID, soqchi.AlertState{Condition: f.condition, NotifiedAt: now}); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		st, ok := states[f.condition]
+		if !ok {
+			st = soqchi.AlertState{Condition: f.condition}
+		}
 
-func (w *watchdog) lowVoltage(ctx context.Context, device *soqchi.Device, chats []int64) error {
+		tr := st.Update(f.active, now, w.remind)
+		if tr == soqchi.AlertUnchanged {
+			continue
+		}
 
-	return w.publish.PlainMessage(ctx, chats, fmt.Sprintf("⚠️ zařízení %s (%s) má nízké napětí baterie %.3f",
-		device.Name,
-		device.ID,
-		device.Voltage,
-	))
+		// stav se uloží až po úspěšném publikování, jinak by se změna stavu už nikdy neoznámila
+		a := soqchi.Alert{Condition: f.condition, State: tr, Since: st.Since}
+		if err := w.publish.Event(ctx, f.event, device.ID, now, f.data(a)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := w.storage.SaveAlertState(ctx, device.ID, st); err != nil {
+			// bez uloženého stavu se zpráva pošle znovu při příštím běhu
+			errs = append(errs, err)
+		}
+	}
+	return errs
 }
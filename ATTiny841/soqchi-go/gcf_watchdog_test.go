@@ -0,0 +1,326 @@
+package soqchigfc
+
+import (
+	"context"
+	"errors"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	store.PutDevice(soqchi.Device{ID: "OK", Name: "ok", Voltage: 3, LastHeartbeatAt: time.Now().Add(-time.Hour)})
+	store.PutDevice(soqchi.Device{ID: "NEW", Name: "new"})
+	store.PutDevice(soqchi.Device{ID: "LOW", Name: "low", Voltage: 2.1, LastHeartbeatAt: time.Now().Add(-time.Hour)})
+	for _, id := range []string{"OK", "NEW", "LOW"} {
+		_ = store.AddUser(ctx, id, 42, "franta")
+	}
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 {
+		t.Errorf("expected 2 warnings, got %q", texts)
+	}
+}
+
+func TestWatchdogBatteryForecast(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Voltage: 2.7, LastHeartbeatAt: now.Add(-time.Hour)})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	// napětí klesá o 20 mV denně, limitu 2.5 V dosáhne zhruba za 10 dní
+	for i := 20; i > 0; i-- {
+		_ = store.SaveHeartbeat(ctx, "ABC", now.AddDate(0, 0, -i), 2.7+0.02*float64(i), 5)
+	}
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub, batteryWarnDays: 7}
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 0 {
+		t.Errorf("forecast beyond warning period must not warn, got %q", texts)
+	}
+
+	w.batteryWarnDays = defaultBatteryWarnDays
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "🔋 zařízení chata (ABC)") {
+		t.Errorf("expected battery forecast warning, got %q", texts)
+	}
+}
+
+func TestWatchdogThresholds(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	tmax := 30.0
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.SaveHeartbeat(ctx, "ABC", now.Add(-30*time.Hour), 3.3, 35)
+	// heartbeat jednou za dva dny, lithiový článek a hlídaná maximální teplota
+	_ = store.SetThresholds(ctx, "ABC", soqchi.Thresholds{HeartbeatInterval: 48 * time.Hour, VoltageLow: 3.4,
+		VoltageCritical: 3.2, TempMax: &tmax})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || !strings.Contains(texts[0], "nízké napětí baterie 3.300") ||
+		!strings.Contains(texts[1], "teplota 35.0 °C překročila 30.0 °C") {
+		t.Errorf("expected low voltage and temperature warnings, got %q", texts)
+	}
+}
+
+func TestWatchdogTemperature(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	tmin := 2.0
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.SetThresholds(ctx, "ABC", soqchi.Thresholds{TempMin: &tmin})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	// mráz oznámený už při příjmu heartbeatu watchdog nehlásí znovu
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+	if _, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: now.Add(-2 * time.Hour), Raw: "20", Flags: 0x20,
+		Voltage: 2.9, Temp: -3}); err != nil {
+		t.Fatal(err)
+	}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "klesla pod 2.0 °C") {
+		t.Fatalf("expected one frost warning, got %q", texts)
+	}
+
+	// po změně limitu watchdog vyhodnotí poslední heartbeat znovu, s hysterezí
+	tmin = -2.5
+	_ = store.SetThresholds(ctx, "ABC", soqchi.Thresholds{TempMin: &tmin})
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 {
+		t.Fatalf("temperature within hysteresis must not resolve, got %q", texts[1:])
+	}
+	tmin = -4
+	_ = store.SetThresholds(ctx, "ABC", soqchi.Thresholds{TempMin: &tmin})
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || !strings.Contains(texts[1], "je opět nad -4.0 °C") {
+		t.Fatalf("expected resolved frost warning, got %q", texts)
+	}
+}
+
+func TestWatchdogFramesLost(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Voltage: 3, LastHeartbeatAt: now.Add(-time.Hour)})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	save := func(at time.Time, seq int) {
+		_ = store.SaveMessage(ctx, &soqchi.Message{DeviceID: "ABC", At: at, Raw: "20", SeqNumber: &seq}, "")
+	}
+	save(now.Add(-3*time.Hour), 10)
+	save(now.Add(-2*time.Hour), 13)
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "2 zpráv(y)") {
+		t.Fatalf("expected lost frames warning, got %q", texts)
+	}
+
+	// další běh už hlásí jen mezery od minulé kontroly
+	save(now.Add(time.Hour), 15)
+	device, _ := store.Device(ctx, "ABC")
+	if errs := w.device(ctx, device, now.Add(2*time.Hour)); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || !strings.Contains(texts[1], "1 zpráv(y)") {
+		t.Fatalf("expected only the new gap, got %q", texts)
+	}
+}
+
+func TestWatchdogAlertStates(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Voltage: 3, LastHeartbeatAt: now.Add(-30 * time.Hour),
+		LastMessageAt: now.Add(-30 * time.Hour)})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	for i := 0; i < 2; i++ {
+		if err := w.handle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// trvající podmínka se hlásí jen jednou
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "se neohlásilo od") {
+		t.Fatalf("expected one missing heartbeat warning, got %q", texts)
+	}
+
+	// připomínka
+	states, _ := store.AlertStates(ctx, "ABC")
+	for _, st := range states {
+		if st.Firing {
+			st.NotifiedAt = now.Add(-24 * time.Hour)
+			_ = store.SaveAlertState(ctx, "ABC", st)
+		}
+	}
+	w.remind = 24 * time.Hour
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || !strings.Contains(texts[1], "trvá od") {
+		t.Fatalf("expected reminder, got %q", texts)
+	}
+
+	// zařízení se ozvalo heartbeatem - oznámí se hned, ne až při dalším běhu watchdogu
+	dm := &deviceMessage{publish: pub, storage: store}
+	if _, err := dm.handle(ctx, &soqchi.Message{DeviceID: "ABC", At: now, Raw: "20", Flags: 0x20, Voltage: 2.9, Temp: 4.5}); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 3 || !strings.Contains(texts[2], "✅ zařízení chata (ABC) se opět ozývá") {
+		t.Fatalf("expected recovery message, got %q", texts)
+	}
+
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 3 {
+		t.Errorf("resolved condition must not be reported again, got %q", texts[3:])
+	}
+}
+
+func TestWatchdogPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata", Voltage: 3, LastHeartbeatAt: now.Add(-30 * time.Hour),
+		LastMessageAt: now.Add(-30 * time.Hour)})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+
+	// nepublikované upozornění se neuloží, takže ho další běh pošle znovu
+	pub := &testPublisher{err: errors.New("pub/sub unavailable")}
+	w := &watchdog{ctx: ctx, storage: store, publish: pub}
+	_ = w.handle()
+	states, _ := store.AlertStates(ctx, "ABC")
+	for _, st := range states {
+		if st.Condition != soqchi.AlertFramesLost {
+			t.Fatalf("unpublished alert must not be saved, got %#v", st)
+		}
+	}
+
+	pub.err = nil
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "se neohlásilo od") {
+		t.Fatalf("expected missing heartbeat warning, got %q", texts)
+	}
+
+	// stejně tak návrat zařízení
+	pub.err = errors.New("pub/sub unavailable")
+	dm := &deviceMessage{publish: pub, storage: store}
+	msg := &soqchi.Message{DeviceID: "ABC", At: now, Raw: "20", Flags: 0x20, Voltage: 2.9, Temp: 4.5}
+	_ = dm.resumed(ctx, &soqchi.Device{ID: "ABC", Name: "chata"}, msg)
+	pub.err = nil
+	if err := dm.resumed(ctx, &soqchi.Device{ID: "ABC", Name: "chata"}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 2 || !strings.Contains(texts[1], "se opět ozývá") {
+		t.Errorf("expected recovery message, got %q", texts)
+	}
+}
+
+func TestResumedOnce(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	store.PutDevice(soqchi.Device{ID: "ABC", Name: "chata"})
+	_ = store.AddUser(ctx, "ABC", 42, "franta")
+	for _, c := range []soqchi.AlertCondition{soqchi.AlertNoHeartbeat, soqchi.AlertHeartbeatMissing} {
+		_ = store.SaveAlertState(ctx, "ABC", soqchi.AlertState{Condition: c, Firing: true, Since: now.Add(-time.Hour)})
+	}
+
+	// obě podmínky skončí stejnou zprávou - návrat zařízení se oznámí jednou
+	pub := &testPublisher{}
+	dm := &deviceMessage{publish: pub, storage: store}
+	msg := &soqchi.Message{DeviceID: "ABC", At: now, Raw: "20", Flags: 0x20, Voltage: 2.9, Temp: 4.5}
+	if err := dm.resumed(ctx, &soqchi.Device{ID: "ABC", Name: "chata"}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if texts := pub.texts(t, store); len(texts) != 1 || !strings.Contains(texts[0], "se opět ozývá") {
+		t.Errorf("expected single recovery message, got %q", texts)
+	}
+	states, _ := store.AlertStates(ctx, "ABC")
+	for _, st := range states {
+		if st.Firing {
+			t.Errorf("condition %s must be resolved", st.Condition)
+		}
+	}
+}
+
+// failingStorage simuluje chybu úložiště při čtení zpráv jednoho zařízení
+type failingStorage struct {
+	storage.Storage
+	deviceID string
+}
+
+func (s *failingStorage) Messages(ctx context.Context, deviceID string, from, to time.Time) ([]soqchi.LoggedMessage, error) {
+	if deviceID == s.deviceID {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.Storage.Messages(ctx, deviceID, from, to)
+}
+
+func TestWatchdogRules(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now()
+	// zařízení se neozývá a naposledy hlásilo nízké napětí - hlásí se obojí
+	store.PutDevice(soqchi.Device{ID: "BAD", Name: "sklep", Voltage: 2.4, LastHeartbeatAt: now.Add(-48 * time.Hour),
+		LastMessageAt: now.Add(-48 * time.Hour)})
+	store.PutDevice(soqchi.Device{ID: "LOW", Name: "chata", Voltage: 2.4, LastHeartbeatAt: now.Add(-time.Hour)})
+	for _, id := range []string{"BAD", "LOW"} {
+		_ = store.AddUser(ctx, id, 42, "franta")
+	}
+
+	pub := &testPublisher{}
+	w := &watchdog{ctx: ctx, storage: &failingStorage{Storage: store, deviceID: "BAD"}, publish: pub}
+	// chyba zařízení se jen zaloguje, běh se neopakuje
+	if err := w.handle(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := pub.texts(t, store)
+	all := strings.Join(msgs, "\n")
+	for _, exp := range []string{"sklep (BAD) se neohlásilo od", "sklep (BAD) má nízké napětí", "chata (LOW) má nízké napětí"} {
+		if !strings.Contains(all, exp) {
+			t.Errorf("messages %q do not contain %q", all, exp)
+		}
+	}
+	if len(msgs) != 3 {
+		t.Errorf("expected 3 warnings, got %q", msgs)
+	}
+}
@@ -11,6 +11,7 @@ require (
 	firebase.google.com/go v3.13.0+incompatible
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
 	github.com/wcharczuk/go-chart/v2 v2.1.0
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410 // indirect
@@ -0,0 +1,277 @@
+package i18n
+
+// czech je vestavěná česká sada šablon. Šablony událostí se jmenují podle typu události
+// (soqchi.EventType), dostávají zařízení (.Device), čas události (.At) a data události (.Data).
+// Šablony odpovědí na příkazy se jmenují podle příkazu (např. "status", "claim.usage").
+const czech = `
+{{- define "format.datetime"}}2.1. 15:04{{end}}
+{{- define "format.date"}}2.1.{{end}}
+
+{{- define "device"}}{{.Device.Name}} ({{.Device.ID}}){{end}}
+{{- define "reminder"}}{{if .Reminder}} (trvá od {{date .Since}}){{end}}{{end}}
+
+{{- define "door_alarm" -}}
+{{with .Data.Window -}}
+🔑 {{template "device" $}} - očekávaný vstup {{datetime $.At}} ({{.}})
+{{- else -}}
+‼️ {{template "device" .}} - ALARM {{datetime .At}} ‼️
+{{- end}}
+{{- end}}
+
+{{- define "door_open"}}{{.Device.Name}} 🅾️ {{datetime .At}} 🌡 {{printf "%.1f" .Data.Temperature}} °C 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}
+{{- define "door_closed"}}{{.Device.Name}} ✅ {{datetime .At}} 🌡 {{printf "%.1f" .Data.Temperature}} °C 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}
+{{- define "heartbeat"}}{{end}}
+
+{{- define "device_silent" -}}
+{{if eq .Data.Condition "no_heartbeat" -}}
+  {{if .Data.Resolved -}}
+    ✅ zařízení {{template "device" .}} se poprvé ohlásilo{{template "silent.voltage" .}}
+  {{- else -}}
+    ⚠️ zařízení {{template "device" .}} se dosud neohlásilo{{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ zařízení {{template "device" .}} se opět ozývá{{template "silent.voltage" .}}
+  {{- else -}}
+    ⚠️ zařízení {{template "device" .}} se neohlásilo od {{datetime .Data.LastMessageAt}}{{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+{{- define "silent.voltage"}}{{if .Data.Voltage}} ({{datetime .At}}) 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}{{end}}
+
+{{- define "low_battery" -}}
+{{if eq .Data.Condition "critical_voltage" -}}
+  {{if .Data.Resolved -}}
+    ✅ zařízení {{template "device" .}} už nemá kriticky nízké napětí baterie ({{printf "%.3f" .Data.Voltage}} V)
+  {{- else -}}
+    ‼️ zařízení {{template "device" .}} má kriticky nízké napětí baterie {{printf "%.3f" .Data.Voltage}} V - hrozí výpadek, vyměňte baterii{{template "reminder" .Data}}
+  {{- end}}
+{{- else if eq .Data.Condition "battery_forecast" -}}
+  {{if .Data.Resolved -}}
+    ✅ zařízení {{template "device" .}} - napětí baterie podle trendu v příštích {{.Data.WarnDays}} dnech pod limit neklesne
+  {{- else -}}
+    🔋 zařízení {{template "device" .}} - napětí baterie podle trendu klesne pod {{printf "%.1f" .Data.Limit}} V kolem {{date .Data.LimitAt}} (za {{.Data.DaysLeft}} dní), připravte výměnu{{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ zařízení {{template "device" .}} má opět dostatečné napětí baterie {{printf "%.3f" .Data.Voltage}} V
+  {{- else -}}
+    ⚠️ zařízení {{template "device" .}} má nízké napětí baterie {{printf "%.3f" .Data.Voltage}}{{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "temperature" -}}
+{{if eq .Data.Condition "temp_low" -}}
+  {{if .Data.Resolved -}}
+    ✅ {{template "device" .}} - teplota {{printf "%.1f" .Data.Temperature}} °C je opět nad {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}})
+  {{- else -}}
+    🥶 {{template "device" .}} - teplota {{printf "%.1f" .Data.Temperature}} °C klesla pod {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}}){{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ {{template "device" .}} - teplota {{printf "%.1f" .Data.Temperature}} °C je opět pod {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}})
+  {{- else -}}
+    🔥 {{template "device" .}} - teplota {{printf "%.1f" .Data.Temperature}} °C překročila {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}}){{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "frames_lost" -}}
+⚠️ zařízení {{template "device" .}} ztratilo od {{datetime .Data.Since}} {{.Data.Lost}} zpráv(y) - zkontrolujte umístění antény
+{{- end}}
+
+{{- define "access_changed" -}}
+{{if not .Data.Allowed -}}
+  🔒 {{template "device" .}} zastřeženo
+{{- else if .Data.Until.IsZero -}}
+  🔓 {{template "device" .}} odstřeženo
+{{- else -}}
+  🔓 {{template "device" .}} přístup povolen do {{datetime .Data.Until}}
+{{- end}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "schedule_changed" -}}
+{{with .Data.Window -}}
+  🗓 {{template "device" $}} - {{if $.Data.Added}}přidáno{{else}}odebráno{{end}} okno očekávaného přístupu {{.}}
+{{- else -}}
+  🗓 {{template "device" .}} - rozvrh očekávaného přístupu smazán
+{{- end}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "limits_changed" -}}
+📏 {{template "device" .}} - limit {{.Data.Limit}} nastaven na {{with .Data.Value}}{{.}}{{else}}bez kontroly{{end}}
+{{- if .Data.Default}} (výchozí){{end}}{{with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "subscription_changed" -}}
+{{if .Data.Added}}📬 {{template "device" .}} - přidán{{else}}📭 {{template "device" .}} - zrušen{{end}} odběr zpráv {{.Data.Channel}} {{.Data.Address}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "device_unclaimed" -}}
+❓ neznámé zařízení {{.Device.ID}} poslalo zprávu {{datetime .At}} (data {{.Data.Raw}}) - převzít lze příkazem /claim {{.Device.ID}} <název>
+{{- end}}
+
+{{- define "register.request"}}🙋 {{.Requester}} žádá o přihlášení k zařízení {{template "device" .}}{{end}}
+{{- define "register.approve"}}✅ schválit{{end}}
+{{- define "register.reject"}}❌ zamítnout{{end}}
+{{- define "register.approved"}}✅ přihlášení k zařízení {{template "device" .}} bylo schváleno{{end}}
+{{- define "register.rejected"}}❌ žádost o přihlášení k zařízení {{.Device.ID}} byla zamítnuta{{end}}
+{{- define "invite.used"}}👋 {{.Requester}} se pozvánkou {{.Code}} přihlásil k zařízení {{template "device" .}}{{end}}
+
+{{- define "register.pending"}}žádost o přihlášení k zařízení {{.Device.ID}} čeká na schválení{{end}}
+{{- define "register.subscribed"}}k zařízení {{template "device" .}} je chat už přihlášen{{end}}
+{{- define "register.owner"}}✅ jste vlastníkem zařízení {{template "device" .}}, další přihlášení budete schvalovat vy{{end}}
+{{- define "register.noapprover"}}zařízení {{.Device.ID}} nemá vlastníka, který by přihlášení schválil{{end}}
+{{- define "register.sent"}}žádost o přihlášení k zařízení {{.Device.ID}} byla odeslána ke schválení{{end}}
+{{- define "unregister.usage"}}použití: /unregister <deviceID>{{end}}
+{{- define "unregister.unknown"}}k zařízení {{.DeviceID}} není chat přihlášen{{end}}
+{{- define "unregister.done"}}👋 odhlášeno od odběru zpráv ze zařízení {{.DeviceID}}{{end}}
+{{- define "callback.denied"}}⛔ žádost může vyřídit jen vlastník zařízení{{end}}
+{{- define "callback.handled"}}žádost už byla vyřízena{{end}}
+{{- define "callback.approved"}}schváleno{{end}}
+{{- define "callback.rejected"}}zamítnuto{{end}}
+
+{{- define "invite.usage"}}použití: /invite <deviceID> [platnost, např. 2h nebo 3d]{{end}}
+{{- define "invite.created" -}}
+🎟 pozvánka k zařízení {{template "device" .}} platí do {{datetime .ExpiresAt}}
+připojit se lze příkazem /join {{.Code}}, zrušit ji lze příkazem /revoke {{.Code}}
+{{- end}}
+{{- define "join.usage"}}použití: /join <kód pozvánky>{{end}}
+{{- define "join.subscribed"}}k zařízení {{.Device.ID}} je chat už přihlášen{{end}}
+{{- define "join.invalid"}}pozvánka neexistuje, už byla použita nebo jí vypršela platnost{{end}}
+{{- define "join.done"}}✅ přihlášeno k odběru zpráv ze zařízení {{template "device" .}}{{end}}
+{{- define "revoke.usage"}}použití: /revoke <kód pozvánky>{{end}}
+{{- define "revoke.failed"}}pozvánku {{.Code}} už nelze zrušit{{end}}
+{{- define "revoke.done"}}🗑 pozvánka {{.Code}} zrušena{{end}}
+
+{{- define "devices" -}}
+{{range .Devices -}}
+{{.Name}} ({{.ID}}) - {{if .AccessEnabled $.Now}}🔓 odstřeženo{{else}}🔒 zastřeženo{{end}}, {{if .LastMessageAt.IsZero}}dosud bez zprávy{{else}}poslední zpráva {{datetime .LastMessageAt}}{{end}}, 🔋 {{printf "%.3f" .Voltage}} V
+{{else -}}
+chat není přihlášen k žádnému zařízení, přihlásit se lze příkazem /register <deviceID>
+{{- end}}
+{{- end}}
+
+{{- define "status.usage"}}použití: /status <deviceID>{{end}}
+{{- define "status" -}}
+📟 {{template "device" .}}
+dveře: {{with .LastState}}{{if .DoorOpen}}🅾️ otevřeno{{else}}✅ zavřeno{{end}} ({{datetime .At}}){{else}}stav neznámý{{end}}
+heartbeat: {{with .LastBeat}}{{datetime .At}} 🔋 {{printf "%.3f" .Voltage}} V 🌡 {{printf "%.1f" .Temp}} °C
+{{- else}}{{if .Device.LastHeartbeatAt.IsZero}}žádný{{else}}{{datetime .Device.LastHeartbeatAt}} 🔋 {{printf "%.3f" .Device.Voltage}} V{{end}}{{end}}
+poslední zpráva: {{if .Device.LastMessageAt.IsZero}}žádná{{else}}před {{printf "%.0f" .SilentHours}} h{{end}}
+přístup: {{if .Armed}}🔒 zastřeženo{{else if not .AllowedUntil.IsZero}}🔓 povolen do {{datetime .AllowedUntil}}{{else}}🔓 odstřeženo{{end}}
+{{with .Forecast}}baterie: {{if $.Falling}}pod {{printf "%.1f" .Limit}} V kolem {{date .LimitAt}} (za {{$.DaysLeft}} dní){{else}}napětí neklesá{{end}}
+{{end -}}
+watchdog: {{if eq .Health "healthy"}}✅{{else}}⚠️{{end}} {{template "health" .Health}}
+{{- end}}
+{{- define "health" -}}
+{{if eq . "no_heartbeat"}}dosud se neohlásilo
+{{- else if eq . "heartbeat_missing"}}chybí heartbeat
+{{- else if eq . "low_voltage"}}nízké napětí baterie
+{{- else if eq . "critical_voltage"}}kriticky nízké napětí baterie
+{{- else}}v pořádku{{end}}
+{{- end}}
+
+{{- define "whoami" -}}
+🪪 chat ID {{.ChatID}}{{with .User}}, uživatel @{{.}}{{end}}
+role: {{if .Admin}}administrátor{{if or .Owned .Subscribed}}; {{end}}{{end}}
+{{- with .Owned}}vlastník zařízení {{.}}{{if $.Subscribed}}; {{end}}{{end}}
+{{- with .Subscribed}}odběratel zařízení {{.}}{{end}}
+{{- if not (or .Admin .Owned .Subscribed)}}bez přihlášení k zařízení{{end}}
+{{- end}}
+
+{{- define "signal" -}}
+{{if not .Signal.Last -}}
+📶 {{template "device" .}} - za posledních {{.Days}} dní nejsou k dispozici žádná data o signálu
+{{- else -}}
+📶 {{template "device" .}}
+{{with .Signal.Last}}poslední zpráva {{datetime .At}}: RSSI {{printf "%.1f" .RSSI}} dBm, SNR {{printf "%.1f" .SNR}} dB, stanice {{.Station}}, kvalita {{.LinkQuality}}{{end}}
+{{with .Signal}}za {{$.Days}} dní: {{.Messages}} zpráv, RSSI průměr {{printf "%.1f" .AvgRSSI}} dBm (min {{printf "%.1f" .MinRSSI}} dBm), SNR průměr {{printf "%.1f" .AvgSNR}} dB, ztraceno {{.LostFrames}} zpráv{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "chart.period"}}neplatné období {{printf "%q" .Period}}, zadejte např. 7d, 30d, 90d nebo all{{end}}
+{{- define "chart.nodata"}}{{.Icon}} {{template "device" .}} - za zvolené období není dost heartbeatů pro graf{{end}}
+{{- define "activity.period"}}neplatné období {{printf "%q" .Period}}, zadejte počet dní 1 až {{.MaxDays}}{{end}}
+{{- define "activity" -}}
+{{if .Count -}}
+🚪 {{template "device" .}} - za posledních {{.Days}} dní {{.Count}}× otevřeno, celkem {{.Total}}
+{{- else -}}
+🚪 {{template "device" .}} - za posledních {{.Days}} dní nebyly dveře otevřené
+{{- end}}
+{{- end}}
+{{- define "weekdays"}}ne po út st čt pá so{{end}}
+
+{{- define "unclaimed" -}}
+{{range .Devices -}}
+❓ {{.ID}} - poprvé {{datetime .FirstSeenAt}}, naposledy {{datetime .LastSeenAt}}, zpráv {{.Count}}
+{{else -}}
+žádná neznámá zařízení
+{{- end}}
+{{- end}}
+{{- define "claim.usage"}}použití: /claim <deviceID> [název]{{end}}
+{{- define "claim.unknown"}}zařízení {{.Device.ID}} mezi neznámými není{{end}}
+{{- define "claim.done"}}✅ zařízení {{template "device" .}} převzato do evidence, přihlásit se k němu lze příkazem /register {{.Device.ID}}{{end}}
+
+{{- define "access.usage"}}použití: /arm <deviceID>, /disarm <deviceID>, /allow <deviceID> <doba, např. 2h>{{end}}
+{{- define "duration.invalid"}}neplatná doba {{printf "%q" .Value}}, použijte např. 30m, 2h nebo 1d{{end}}
+
+{{- define "schedule.usage"}}použití: /schedule <deviceID> [add <den> <od>-<do> [poznámka] | del <číslo> | clear]{{end}}
+{{- define "schedule.invalid"}}neplatné okno: {{.Error}}{{end}}
+{{- define "schedule.unknown"}}okno {{printf "%q" .Value}} neexistuje{{end}}
+{{- define "schedule" -}}
+{{if not .Windows -}}
+🗓 {{template "device" .}} nemá rozvrh očekávaného přístupu
+{{- else -}}
+🗓 {{template "device" .}} - očekávaný přístup ({{.Device.Location}}):
+{{range $i, $w := .Windows}}{{inc $i}}. {{$w}}
+{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "limits.usage" -}}
+použití: /limits <deviceID> [<limit> <hodnota>|default], limity: heartbeat, grace (doba, např. 24h), low, critical (napětí ve V), tmin, tmax, hyst (teplota a její hystereze ve °C)
+{{- end}}
+{{- define "limits.forbidden"}}limity může měnit jen vlastník zařízení nebo administrátor{{end}}
+{{- define "limits.invalid" -}}
+{{if eq .Reason "unknown"}}neznámý limit {{printf "%q" .Key}}
+{{- else if eq .Reason "positive"}}limit {{.Key}} musí být kladný
+{{- else if eq .Reason "voltage"}}kritické napětí {{printf "%.2f" .Critical}} V musí být nižší než limit nízkého napětí {{printf "%.2f" .Low}} V
+{{- else if eq .Reason "temperature"}}minimální teplota musí být nižší než maximální
+{{- else}}neplatná hodnota {{printf "%q" .Value}} limitu {{.Key}}{{end}}
+{{template "limits.usage"}}
+{{- end}}
+{{- define "limits" -}}
+📏 {{template "device" .}} - limity:
+{{range .Limits}}{{.Key}}: {{with .Value}}{{.}}{{else}}bez kontroly{{end}}{{if .Default}} (výchozí){{end}}
+{{end}}
+{{- end}}
+
+{{- define "channels.usage" -}}
+použití: /channels <deviceID> [add <kanál> <adresa> | del <číslo>], kanály: email (e-mailová adresa), webhook (URL), ntfy (téma nebo URL tématu)
+{{- end}}
+{{- define "channels.forbidden"}}odběry může měnit jen vlastník zařízení nebo administrátor{{end}}
+{{- define "channels.invalid" -}}
+neplatný odběr: {{.Error}}
+{{template "channels.usage"}}
+{{- end}}
+{{- define "channels.unknown"}}odběr {{printf "%q" .Value}} neexistuje{{end}}
+{{- define "channels.secret"}}🔑 klíč podpisu webhooku {{.Subscription.Address}} (hlavička X-Soqchi-Signature): {{.Subscription.Secret}}{{end}}
+{{- define "channels" -}}
+{{if not .Subscriptions -}}
+📬 {{template "device" .}} nemá odběry zpráv mimo Telegram
+{{- else -}}
+📬 {{template "device" .}} - odběry zpráv mimo Telegram:
+{{range $i, $s := .Subscriptions}}{{inc $i}}. {{$s}}{{if and $s.Secret (eq $s.CreatedBy $.ChatID)}} 🔑 {{$s.Secret}}{{end}}
+{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "lang.set"}}🌐 zprávy budou česky, časy {{with .TimeZone}}v zóně {{.}}{{else}}v časové zóně zařízení{{end}}{{end}}
+{{- define "lang.usage"}}použití: /lang <jazyk> [časová zóna], např. /lang cs Europe/Prague
+jazyky: {{.Languages}}{{end}}
+`
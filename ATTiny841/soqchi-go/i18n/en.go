@@ -0,0 +1,275 @@
+package i18n
+
+// english je vestavěná anglická sada šablon, zároveň základ sad jazyků, které nejsou vestavěné
+const english = `
+{{- define "format.datetime"}}Jan 2, 15:04{{end}}
+{{- define "format.date"}}Jan 2{{end}}
+
+{{- define "device"}}{{.Device.Name}} ({{.Device.ID}}){{end}}
+{{- define "reminder"}}{{if .Reminder}} (since {{date .Since}}){{end}}{{end}}
+
+{{- define "door_alarm" -}}
+{{with .Data.Window -}}
+🔑 {{template "device" $}} - expected entry {{datetime $.At}} ({{.Hours}}{{with .Note}} {{.}}{{end}})
+{{- else -}}
+‼️ {{template "device" .}} - ALARM {{datetime .At}} ‼️
+{{- end}}
+{{- end}}
+
+{{- define "door_open"}}{{.Device.Name}} 🅾️ {{datetime .At}} 🌡 {{printf "%.1f" .Data.Temperature}} °C 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}
+{{- define "door_closed"}}{{.Device.Name}} ✅ {{datetime .At}} 🌡 {{printf "%.1f" .Data.Temperature}} °C 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}
+{{- define "heartbeat"}}{{end}}
+
+{{- define "device_silent" -}}
+{{if eq .Data.Condition "no_heartbeat" -}}
+  {{if .Data.Resolved -}}
+    ✅ device {{template "device" .}} reported for the first time{{template "silent.voltage" .}}
+  {{- else -}}
+    ⚠️ device {{template "device" .}} has not reported yet{{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ device {{template "device" .}} is reporting again{{template "silent.voltage" .}}
+  {{- else -}}
+    ⚠️ device {{template "device" .}} has not reported since {{datetime .Data.LastMessageAt}}{{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+{{- define "silent.voltage"}}{{if .Data.Voltage}} ({{datetime .At}}) 🔋 {{printf "%.3f" .Data.Voltage}} V{{end}}{{end}}
+
+{{- define "low_battery" -}}
+{{if eq .Data.Condition "critical_voltage" -}}
+  {{if .Data.Resolved -}}
+    ✅ device {{template "device" .}} no longer has a critically low battery ({{printf "%.3f" .Data.Voltage}} V)
+  {{- else -}}
+    ‼️ device {{template "device" .}} has a critically low battery {{printf "%.3f" .Data.Voltage}} V - outage imminent, replace the battery{{template "reminder" .Data}}
+  {{- end}}
+{{- else if eq .Data.Condition "battery_forecast" -}}
+  {{if .Data.Resolved -}}
+    ✅ device {{template "device" .}} - battery voltage is not expected to drop below the limit in the next {{.Data.WarnDays}} days
+  {{- else -}}
+    🔋 device {{template "device" .}} - battery voltage is expected to drop below {{printf "%.1f" .Data.Limit}} V around {{date .Data.LimitAt}} (in {{.Data.DaysLeft}} days), prepare a replacement{{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ device {{template "device" .}} has sufficient battery voltage again {{printf "%.3f" .Data.Voltage}} V
+  {{- else -}}
+    ⚠️ device {{template "device" .}} has a low battery voltage {{printf "%.3f" .Data.Voltage}} V{{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "temperature" -}}
+{{if eq .Data.Condition "temp_low" -}}
+  {{if .Data.Resolved -}}
+    ✅ {{template "device" .}} - temperature {{printf "%.1f" .Data.Temperature}} °C is above {{printf "%.1f" .Data.Limit}} °C again ({{datetime .At}})
+  {{- else -}}
+    🥶 {{template "device" .}} - temperature {{printf "%.1f" .Data.Temperature}} °C dropped below {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}}){{template "reminder" .Data}}
+  {{- end}}
+{{- else -}}
+  {{if .Data.Resolved -}}
+    ✅ {{template "device" .}} - temperature {{printf "%.1f" .Data.Temperature}} °C is below {{printf "%.1f" .Data.Limit}} °C again ({{datetime .At}})
+  {{- else -}}
+    🔥 {{template "device" .}} - temperature {{printf "%.1f" .Data.Temperature}} °C exceeded {{printf "%.1f" .Data.Limit}} °C ({{datetime .At}}){{template "reminder" .Data}}
+  {{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "frames_lost" -}}
+⚠️ device {{template "device" .}} lost {{.Data.Lost}} message(s) since {{datetime .Data.Since}} - check the antenna placement
+{{- end}}
+
+{{- define "access_changed" -}}
+{{if not .Data.Allowed -}}
+  🔒 {{template "device" .}} armed
+{{- else if .Data.Until.IsZero -}}
+  🔓 {{template "device" .}} disarmed
+{{- else -}}
+  🔓 {{template "device" .}} access allowed until {{datetime .Data.Until}}
+{{- end}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "schedule_changed" -}}
+{{with .Data.Window -}}
+  🗓 {{template "device" $}} - expected access window {{.Weekday}} {{.Hours}}{{with .Note}} {{.}}{{end}} {{if $.Data.Added}}added{{else}}removed{{end}}
+{{- else -}}
+  🗓 {{template "device" .}} - expected access schedule cleared
+{{- end}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "limits_changed" -}}
+📏 {{template "device" .}} - limit {{.Data.Limit}} set to {{with .Data.Value}}{{.}}{{else}}not checked{{end}}
+{{- if .Data.Default}} (default){{end}}{{with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "subscription_changed" -}}
+{{if .Data.Added}}📬 {{template "device" .}} - added{{else}}📭 {{template "device" .}} - removed{{end}} message subscription {{.Data.Channel}} {{.Data.Address}}
+{{- with .Data.By}} ({{.}}){{end}}
+{{- end}}
+
+{{- define "device_unclaimed" -}}
+❓ unknown device {{.Device.ID}} sent a message {{datetime .At}} (data {{.Data.Raw}}) - claim it with /claim {{.Device.ID}} <name>
+{{- end}}
+
+{{- define "register.request"}}🙋 {{.Requester}} asks to subscribe to device {{template "device" .}}{{end}}
+{{- define "register.approve"}}✅ approve{{end}}
+{{- define "register.reject"}}❌ reject{{end}}
+{{- define "register.approved"}}✅ subscription to device {{template "device" .}} was approved{{end}}
+{{- define "register.rejected"}}❌ request to subscribe to device {{.Device.ID}} was rejected{{end}}
+{{- define "invite.used"}}👋 {{.Requester}} subscribed to device {{template "device" .}} with invite {{.Code}}{{end}}
+
+{{- define "register.pending"}}request to subscribe to device {{.Device.ID}} is waiting for approval{{end}}
+{{- define "register.subscribed"}}the chat is already subscribed to device {{template "device" .}}{{end}}
+{{- define "register.owner"}}✅ you are the owner of device {{template "device" .}}, you will approve further subscriptions{{end}}
+{{- define "register.noapprover"}}device {{.Device.ID}} has no owner who could approve the subscription{{end}}
+{{- define "register.sent"}}request to subscribe to device {{.Device.ID}} was sent for approval{{end}}
+{{- define "unregister.usage"}}usage: /unregister <deviceID>{{end}}
+{{- define "unregister.unknown"}}the chat is not subscribed to device {{.DeviceID}}{{end}}
+{{- define "unregister.done"}}👋 unsubscribed from messages of device {{.DeviceID}}{{end}}
+{{- define "callback.denied"}}⛔ only the owner of the device can handle the request{{end}}
+{{- define "callback.handled"}}the request has already been handled{{end}}
+{{- define "callback.approved"}}approved{{end}}
+{{- define "callback.rejected"}}rejected{{end}}
+
+{{- define "invite.usage"}}usage: /invite <deviceID> [validity, e.g. 2h or 3d]{{end}}
+{{- define "invite.created" -}}
+🎟 invite to device {{template "device" .}} is valid until {{datetime .ExpiresAt}}
+join with /join {{.Code}}, revoke it with /revoke {{.Code}}
+{{- end}}
+{{- define "join.usage"}}usage: /join <invite code>{{end}}
+{{- define "join.subscribed"}}the chat is already subscribed to device {{.Device.ID}}{{end}}
+{{- define "join.invalid"}}the invite does not exist, has already been used or has expired{{end}}
+{{- define "join.done"}}✅ subscribed to messages of device {{template "device" .}}{{end}}
+{{- define "revoke.usage"}}usage: /revoke <invite code>{{end}}
+{{- define "revoke.failed"}}invite {{.Code}} can no longer be revoked{{end}}
+{{- define "revoke.done"}}🗑 invite {{.Code}} revoked{{end}}
+
+{{- define "devices" -}}
+{{range .Devices -}}
+{{.Name}} ({{.ID}}) - {{if .AccessEnabled $.Now}}🔓 disarmed{{else}}🔒 armed{{end}}, {{if .LastMessageAt.IsZero}}no message yet{{else}}last message {{datetime .LastMessageAt}}{{end}}, 🔋 {{printf "%.3f" .Voltage}} V
+{{else -}}
+the chat is not subscribed to any device, subscribe with /register <deviceID>
+{{- end}}
+{{- end}}
+
+{{- define "status.usage"}}usage: /status <deviceID>{{end}}
+{{- define "status" -}}
+📟 {{template "device" .}}
+door: {{with .LastState}}{{if .DoorOpen}}🅾️ open{{else}}✅ closed{{end}} ({{datetime .At}}){{else}}unknown{{end}}
+heartbeat: {{with .LastBeat}}{{datetime .At}} 🔋 {{printf "%.3f" .Voltage}} V 🌡 {{printf "%.1f" .Temp}} °C
+{{- else}}{{if .Device.LastHeartbeatAt.IsZero}}none{{else}}{{datetime .Device.LastHeartbeatAt}} 🔋 {{printf "%.3f" .Device.Voltage}} V{{end}}{{end}}
+last message: {{if .Device.LastMessageAt.IsZero}}none{{else}}{{printf "%.0f" .SilentHours}} h ago{{end}}
+access: {{if .Armed}}🔒 armed{{else if not .AllowedUntil.IsZero}}🔓 allowed until {{datetime .AllowedUntil}}{{else}}🔓 disarmed{{end}}
+{{with .Forecast}}battery: {{if $.Falling}}below {{printf "%.1f" .Limit}} V around {{date .LimitAt}} (in {{$.DaysLeft}} days){{else}}voltage is not falling{{end}}
+{{end -}}
+watchdog: {{if eq .Health "healthy"}}✅{{else}}⚠️{{end}} {{template "health" .Health}}
+{{- end}}
+{{- define "health" -}}
+{{if eq . "no_heartbeat"}}not reported yet
+{{- else if eq . "heartbeat_missing"}}heartbeat missing
+{{- else if eq . "low_voltage"}}low battery voltage
+{{- else if eq . "critical_voltage"}}critically low battery voltage
+{{- else}}OK{{end}}
+{{- end}}
+
+{{- define "whoami" -}}
+🪪 chat ID {{.ChatID}}{{with .User}}, user @{{.}}{{end}}
+role: {{if .Admin}}administrator{{if or .Owned .Subscribed}}; {{end}}{{end}}
+{{- with .Owned}}owner of device {{.}}{{if $.Subscribed}}; {{end}}{{end}}
+{{- with .Subscribed}}subscriber of device {{.}}{{end}}
+{{- if not (or .Admin .Owned .Subscribed)}}not subscribed to any device{{end}}
+{{- end}}
+
+{{- define "signal" -}}
+{{if not .Signal.Last -}}
+📶 {{template "device" .}} - no signal data in the last {{.Days}} days
+{{- else -}}
+📶 {{template "device" .}}
+{{with .Signal.Last}}last message {{datetime .At}}: RSSI {{printf "%.1f" .RSSI}} dBm, SNR {{printf "%.1f" .SNR}} dB, station {{.Station}}, quality {{.LinkQuality}}{{end}}
+{{with .Signal}}{{$.Days}} days: {{.Messages}} messages, average RSSI {{printf "%.1f" .AvgRSSI}} dBm (min {{printf "%.1f" .MinRSSI}} dBm), average SNR {{printf "%.1f" .AvgSNR}} dB, {{.LostFrames}} messages lost{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "chart.period"}}invalid period {{printf "%q" .Period}}, use e.g. 7d, 30d, 90d or all{{end}}
+{{- define "chart.nodata"}}{{.Icon}} {{template "device" .}} - not enough heartbeats in the period for a chart{{end}}
+{{- define "activity.period"}}invalid period {{printf "%q" .Period}}, use 1 to {{.MaxDays}} days{{end}}
+{{- define "activity" -}}
+{{if .Count -}}
+🚪 {{template "device" .}} - opened {{.Count}}× in the last {{.Days}} days, {{.Total}} in total
+{{- else -}}
+🚪 {{template "device" .}} - the door was not opened in the last {{.Days}} days
+{{- end}}
+{{- end}}
+{{- define "weekdays"}}Sun Mon Tue Wed Thu Fri Sat{{end}}
+
+{{- define "unclaimed" -}}
+{{range .Devices -}}
+❓ {{.ID}} - first {{datetime .FirstSeenAt}}, last {{datetime .LastSeenAt}}, {{.Count}} messages
+{{else -}}
+no unknown devices
+{{- end}}
+{{- end}}
+{{- define "claim.usage"}}usage: /claim <deviceID> [name]{{end}}
+{{- define "claim.unknown"}}device {{.Device.ID}} is not among unknown devices{{end}}
+{{- define "claim.done"}}✅ device {{template "device" .}} claimed, subscribe to it with /register {{.Device.ID}}{{end}}
+
+{{- define "access.usage"}}usage: /arm <deviceID>, /disarm <deviceID>, /allow <deviceID> <duration, e.g. 2h>{{end}}
+{{- define "duration.invalid"}}invalid duration {{printf "%q" .Value}}, use e.g. 30m, 2h or 1d{{end}}
+
+{{- define "schedule.usage"}}usage: /schedule <deviceID> [add <day> <from>-<to> [note] | del <number> | clear]{{end}}
+{{- define "schedule.invalid"}}invalid window: {{.Error}}{{end}}
+{{- define "schedule.unknown"}}window {{printf "%q" .Value}} does not exist{{end}}
+{{- define "schedule" -}}
+{{if not .Windows -}}
+🗓 {{template "device" .}} has no expected access schedule
+{{- else -}}
+🗓 {{template "device" .}} - expected access ({{.Device.Location}}):
+{{range $i, $w := .Windows}}{{inc $i}}. {{$w.Weekday}} {{$w.Hours}}{{with $w.Note}} {{.}}{{end}}
+{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "limits.usage" -}}
+usage: /limits <deviceID> [<limit> <value>|default], limits: heartbeat, grace (duration, e.g. 24h), low, critical (voltage in V), tmin, tmax, hyst (temperature and its hysteresis in °C)
+{{- end}}
+{{- define "limits.forbidden"}}only the owner of the device or an administrator can change the limits{{end}}
+{{- define "limits.invalid" -}}
+{{if eq .Reason "unknown"}}unknown limit {{printf "%q" .Key}}
+{{- else if eq .Reason "positive"}}limit {{.Key}} must be positive
+{{- else if eq .Reason "voltage"}}critical voltage {{printf "%.2f" .Critical}} V must be lower than the low voltage limit {{printf "%.2f" .Low}} V
+{{- else if eq .Reason "temperature"}}minimum temperature must be lower than the maximum one
+{{- else}}invalid value {{printf "%q" .Value}} of limit {{.Key}}{{end}}
+{{template "limits.usage"}}
+{{- end}}
+{{- define "limits" -}}
+📏 {{template "device" .}} - limits:
+{{range .Limits}}{{.Key}}: {{with .Value}}{{.}}{{else}}not checked{{end}}{{if .Default}} (default){{end}}
+{{end}}
+{{- end}}
+
+{{- define "channels.usage" -}}
+usage: /channels <deviceID> [add <channel> <address> | del <number>], channels: email (e-mail address), webhook (URL), ntfy (topic or topic URL)
+{{- end}}
+{{- define "channels.forbidden"}}only the owner of the device or an administrator can change the subscriptions{{end}}
+{{- define "channels.invalid" -}}
+invalid subscription: {{.Error}}
+{{template "channels.usage"}}
+{{- end}}
+{{- define "channels.unknown"}}subscription {{printf "%q" .Value}} does not exist{{end}}
+{{- define "channels.secret"}}🔑 signing key of webhook {{.Subscription.Address}} (header X-Soqchi-Signature): {{.Subscription.Secret}}{{end}}
+{{- define "channels" -}}
+{{if not .Subscriptions -}}
+📬 {{template "device" .}} has no message subscriptions outside Telegram
+{{- else -}}
+📬 {{template "device" .}} - message subscriptions outside Telegram:
+{{range $i, $s := .Subscriptions}}{{inc $i}}. {{$s}}{{if and $s.Secret (eq $s.CreatedBy $.ChatID)}} 🔑 {{$s.Secret}}{{end}}
+{{end}}
+{{- end}}
+{{- end}}
+
+{{- define "lang.set"}}🌐 messages will be in English, times in {{with .TimeZone}}the {{.}} time zone{{else}}the time zone of the device{{end}}{{end}}
+{{- define "lang.usage"}}usage: /lang <language> [time zone], e.g. /lang en Europe/London
+languages: {{.Languages}}{{end}}
+`
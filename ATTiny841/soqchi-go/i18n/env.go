@@ -0,0 +1,28 @@
+package i18n
+
+import (
+	"log"
+	"os"
+)
+
+const (
+	// EnvTemplatesDir je adresář se šablonami, které přepíší či doplní vestavěné (<adresář>/<jazyk>/*.tmpl)
+	EnvTemplatesDir = "TEMPLATES_DIR"
+	// EnvDefaultLang je výchozí jazyk zpráv pro příjemce, kteří si jazyk nenastavili
+	EnvDefaultLang = "DEFAULT_LANG"
+)
+
+// FromEnv vrací šablony dle proměnných prostředí TEMPLATES_DIR a DEFAULT_LANG (výchozí čeština).
+// Pro výchozí jazyk bez šablon se chyba zaloguje a výchozím jazykem je čeština.
+func FromEnv() *Catalog {
+	lang := os.Getenv(EnvDefaultLang)
+	if lang == "" {
+		lang = Czech
+	}
+	c, err := New(os.Getenv(EnvTemplatesDir), lang)
+	if err != nil {
+		log.Printf("message templates: %s, using %s", err.Error(), Czech)
+		c, _ = New(os.Getenv(EnvTemplatesDir), Czech)
+	}
+	return c
+}
@@ -0,0 +1,212 @@
+// Package i18n vytváří texty zpráv pro uživatele ze šablon text/template. Šablony jsou rozdělené do
+// sad podle jazyka, vestavěné jsou čeština a angličtina. Provozovatel může šablony přepsat nebo
+// přidat další jazyk bez překompilování - soubory <adresář>/<jazyk>/*.tmpl se načtou po vestavěných.
+package i18n
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Czech a English jsou jazyky vestavěných sad šablon
+const (
+	Czech   = "cs"
+	English = "en"
+)
+
+// Šablony formátu času a data, jejich výstupem je layout pro time.Format (např. "2.1. 15:04").
+// Používají je funkce šablon datetime a date.
+const (
+	formatDateTime = "format.datetime"
+	formatDate     = "format.date"
+)
+
+// ErrUnknownTemplate vrací Render pro šablonu, která v sadě není
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// builtin jsou vestavěné sady šablon podle jazyka
+var builtin = map[string]string{
+	Czech:   czech,
+	English: english,
+}
+
+// Catalog jsou sady šablon pro všechny jazyky
+type Catalog struct {
+	lang    string
+	bundles map[string]*bundle
+}
+
+type bundle struct {
+	t *template.Template
+	// dateTime a date jsou layouty času a data dle šablon formatDateTime a formatDate
+	dateTime string
+	date     string
+	// builtin jsou vestavěné šablony, na které se přejde, když selže šablona přepsaná provozovatelem
+	builtin *bundle
+}
+
+// templateFile je soubor se šablonami provozovatele
+type templateFile struct {
+	name string
+	src  string
+}
+
+// New načte vestavěné sady šablon a přepíše je šablonami ze souborů dir/<jazyk>/*.tmpl (prázdný dir
+// znamená jen vestavěné šablony). Sada jazyka, který není vestavěný, začíná jako kopie anglické.
+// lang je výchozí jazyk, pro jazyky bez sady šablon. Soubory, které nejde načíst nebo zpracovat, se
+// jen zalogují a přeskočí - chyba v šablonách provozovatele nesmí zastavit doručování zpráv.
+func New(dir, lang string) (*Catalog, error) {
+	overrides := map[string][]templateFile{}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*", "*.tmpl"))
+		if err != nil {
+			log.Printf("can't list templates in %s: %s", dir, err.Error())
+		}
+		for _, f := range files {
+			src, err := ioutil.ReadFile(f)
+			if err != nil {
+				log.Printf("can't read template %s: %s", f, err.Error())
+				continue
+			}
+			l := filepath.Base(filepath.Dir(f))
+			overrides[l] = append(overrides[l], templateFile{name: f, src: string(src)})
+		}
+	}
+
+	c := &Catalog{lang: lang, bundles: map[string]*bundle{}}
+	for l, src := range builtin {
+		b, err := newBundle(l, src)
+		if err != nil {
+			return nil, err
+		}
+		c.bundles[l] = b
+	}
+	for l, files := range overrides {
+		base, ok := c.bundles[l]
+		if !ok {
+			base = c.bundles[English]
+		}
+		c.bundles[l] = base.override(l, files)
+	}
+
+	if _, ok := c.bundles[lang]; !ok {
+		return nil, fmt.Errorf("no templates for default language %q", lang)
+	}
+	return c, nil
+}
+
+// newBundle zpracuje vestavěné šablony jazyka lang
+func newBundle(lang, src string) (*bundle, error) {
+	b := &bundle{}
+	b.t = template.New(lang).Funcs(b.funcs(time.UTC))
+	if _, err := b.t.Parse(src); err != nil {
+		return nil, fmt.Errorf("templates %s: %w", lang, err)
+	}
+	if err := b.formats(); err != nil {
+		return nil, fmt.Errorf("templates %s: %w", lang, err)
+	}
+	return b, nil
+}
+
+// override vrací sadu, ve které šablony ze souborů files přepíší šablony b. Soubor, který nejde
+// zpracovat, se přeskočí. Pokud po přepsání nejdou vyhodnotit formáty času, zůstane sada b.
+func (b *bundle) override(lang string, files []templateFile) *bundle {
+	o := &bundle{t: b.t, builtin: b}
+	for _, f := range files {
+		t, err := o.t.Clone()
+		if err == nil {
+			_, err = t.Parse(f.src)
+		}
+		if err != nil {
+			log.Printf("template %s skipped: %s", f.name, err.Error())
+			continue
+		}
+		o.t = t
+	}
+	if err := o.formats(); err != nil {
+		log.Printf("templates %s: %s, using built-in templates", lang, err.Error())
+		return b
+	}
+	return o
+}
+
+// formats vyhodnotí layouty času a data ze šablon formatDateTime a formatDate
+func (b *bundle) formats() error {
+	for name, layout := range map[string]*string{formatDateTime: &b.dateTime, formatDate: &b.date} {
+		var buf bytes.Buffer
+		if err := b.t.ExecuteTemplate(&buf, name, nil); err != nil {
+			return err
+		}
+		*layout = strings.TrimSpace(buf.String())
+	}
+	return nil
+}
+
+// funcs vrací funkce šablon, časy převádí do časové zóny loc. inc slouží k číslování výpisů od 1.
+func (b *bundle) funcs(loc *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"datetime": func(t time.Time) string { return t.In(loc).Format(b.dateTime) },
+		"date":     func(t time.Time) string { return t.In(loc).Format(b.date) },
+		"inc":      func(i int) int { return i + 1 },
+	}
+}
+
+// Lang vrací jazyk, který se použije pro lang - jazyk bez sady šablon nahradí výchozím
+func (c *Catalog) Lang(lang string) string {
+	if _, ok := c.bundles[lang]; ok {
+		return lang
+	}
+	return c.lang
+}
+
+// Languages vrací seřazené jazyky, pro které jsou šablony
+func (c *Catalog) Languages() []string {
+	langs := make([]string, 0, len(c.bundles))
+	for l := range c.bundles {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Render vrací text šablony name v jazyce lang s časy v časové zóně loc. Okolní bílé znaky se
+// odstraní, takže šablona s prázdným výstupem znamená, že se nic neposílá. Selže-li šablona
+// přepsaná provozovatelem, použije se vestavěná.
+func (c *Catalog) Render(lang, name string, loc *time.Location, data interface{}) (string, error) {
+	l := c.Lang(lang)
+	b := c.bundles[l]
+	txt, err := b.render(name, loc, data)
+	if err != nil && b.builtin != nil && !errors.Is(err, ErrUnknownTemplate) {
+		log.Printf("template %s (%s) failed, using built-in one: %s", name, l, err.Error())
+		return b.builtin.render(name, loc, data)
+	}
+	if errors.Is(err, ErrUnknownTemplate) {
+		return "", fmt.Errorf("%w (%s)", err, l)
+	}
+	return txt, err
+}
+
+func (b *bundle) render(name string, loc *time.Location, data interface{}) (string, error) {
+	if b.t.Lookup(name) == nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+
+	// funkce šablon závisí na časové zóně příjemce, proto se nastavují v kopii sady
+	t, err := b.t.Clone()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Funcs(b.funcs(loc)).ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
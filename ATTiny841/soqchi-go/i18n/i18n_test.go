@@ -0,0 +1,79 @@
+package i18n
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOverride(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cs/custom.tmpl", `{{define "frames_lost"}}ztraceno {{.}}{{end}}{{define "format.date"}}2. 1. 2006{{end}}`)
+	write("de/de.tmpl", `{{define "frames_lost"}}verloren {{date .}}{{end}}{{define "format.date"}}02.01.2006{{end}}`)
+
+	c, err := New(dir, Czech)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if langs := c.Languages(); !reflect.DeepEqual(langs, []string{"cs", "de", "en"}) {
+		t.Errorf("unexpected languages %v", langs)
+	}
+
+	if txt, err := c.Render(Czech, "frames_lost", time.UTC, 3); err != nil || txt != "ztraceno 3" {
+		t.Errorf("expected overridden template, got %q, %v", txt, err)
+	}
+	// nová sada vychází z anglické, časy jsou v časové zóně příjemce
+	at := time.Date(2022, 2, 20, 23, 30, 0, 0, time.UTC)
+	prague, _ := time.LoadLocation("Europe/Prague")
+	if txt, err := c.Render("de", "frames_lost", prague, at); err != nil || txt != "verloren 21.02.2022" {
+		t.Errorf("unexpected german text %q, %v", txt, err)
+	}
+	if txt, err := c.Render("de", "lang.usage", time.UTC, map[string]string{"Languages": "de"}); err != nil || txt == "" {
+		t.Errorf("expected english template in new language, got %q, %v", txt, err)
+	}
+	// nepodporovaný jazyk nahradí výchozí
+	if c.Lang("xx") != Czech {
+		t.Errorf("expected default language for unknown one, got %s", c.Lang("xx"))
+	}
+	if _, err := c.Render("xx", "door_rang", time.UTC, nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("expected unknown template error, got %v", err)
+	}
+
+	// nezpracovatelný soubor se přeskočí, šablona, která selže, se nahradí vestavěnou
+	write("en/broken.tmpl", `{{define "frames_lost"}}{{.Lost{{end}}`)
+	write("en/runtime.tmpl", `{{define "lang.set"}}{{.Missing}}{{end}}`)
+	c, err = New(dir, Czech)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := struct {
+		Lost  int
+		Since time.Time
+	}{3, at}
+	if txt, err := c.Render(English, "frames_lost", time.UTC, map[string]interface{}{
+		"Device": map[string]string{"Name": "chata", "ID": "ABC"}, "Data": data}); err != nil ||
+		txt != "⚠️ device chata (ABC) lost 3 message(s) since Feb 20, 23:30 - check the antenna placement" {
+		t.Errorf("expected built-in template instead of broken one, got %q, %v", txt, err)
+	}
+	if txt, err := c.Render(English, "lang.set", time.UTC, struct{ TimeZone string }{}); err != nil ||
+		txt != "🌐 messages will be in English, times in the time zone of the device" {
+		t.Errorf("expected built-in template instead of failing one, got %q, %v", txt, err)
+	}
+	if _, err := New("", "de"); err == nil {
+		t.Error("expected error for default language without templates")
+	}
+}
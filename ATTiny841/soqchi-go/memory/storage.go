@@ -0,0 +1,544 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"sort"
+	"sync"
+	"time"
+)
+
+// heartbeatLimit odpovídá počtu posledních heartbeatů, které vrací firestore.Client.DeviceInfo
+const heartbeatLimit = 60
+
+// frameRetention odpovídá době, po kterou firestore drží evidenci framů (TTL ExpireAt)
+const frameRetention = 7 * 24 * time.Hour
+
+// Client je úložiště držené v paměti procesu. Chová se stejně jako firestore.Client, takže
+// je vhodné pro testy a pro běh bez Google Cloudu. Je bezpečné pro souběžné použití.
+type Client struct {
+	mu         sync.RWMutex
+	devices    map[string]*soqchi.Device
+	chats      map[string]map[int64]Chat
+	heartbeats map[string]soqchi.Heartbeats
+	messages   map[string][]soqchi.LoggedMessage
+	frames     map[string]time.Time
+	unclaimed  map[string]*soqchi.UnclaimedDevice
+	invites    map[string]soqchi.Invite
+	alerts     map[string]map[soqchi.AlertCondition]soqchi.AlertState
+	subs       map[string][]soqchi.Subscription
+	settings   map[int64]soqchi.ChatSettings
+}
+
+type Chat struct {
+	Username  string
+	CreatedAt time.Time
+	Pending   bool
+}
+
+func New() *Client {
+	return &Client{
+		devices:    map[string]*soqchi.Device{},
+		chats:      map[string]map[int64]Chat{},
+		heartbeats: map[string]soqchi.Heartbeats{},
+		messages:   map[string][]soqchi.LoggedMessage{},
+		frames:     map[string]time.Time{},
+		unclaimed:  map[string]*soqchi.UnclaimedDevice{},
+		invites:    map[string]soqchi.Invite{},
+		alerts:     map[string]map[soqchi.AlertCondition]soqchi.AlertState{},
+		subs:       map[string][]soqchi.Subscription{},
+		settings:   map[int64]soqchi.ChatSettings{},
+	}
+}
+
+// PutDevice založí nebo přepíše zařízení - obdoba ručního vložení dokumentu do kolekce "devices"
+func (c *Client) PutDevice(d soqchi.Device) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices[d.ID] = &d
+}
+
+func (c *Client) AddUser(_ context.Context, deviceID string, chatID int64, username string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addUser(deviceID, chatID, username, false)
+	return nil
+}
+
+func (c *Client) AddPendingUser(_ context.Context, deviceID string, chatID int64, username string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addUser(deviceID, chatID, username, true)
+	return nil
+}
+
+func (c *Client) addUser(deviceID string, chatID int64, username string, pending bool) {
+	if _, ok := c.devices[deviceID]; !ok {
+		return
+	}
+	if c.chats[deviceID] == nil {
+		c.chats[deviceID] = map[int64]Chat{}
+	}
+	c.chats[deviceID][chatID] = Chat{
+		Username:  username,
+		CreatedAt: time.Now(),
+		Pending:   pending,
+	}
+}
+
+func (c *Client) ApproveUser(_ context.Context, deviceID string, chatID int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.chats[deviceID][chatID]
+	if !ok || !ch.Pending {
+		return false, nil
+	}
+	ch.Pending = false
+	c.chats[deviceID][chatID] = ch
+	return true, nil
+}
+
+func (c *Client) RemoveUser(_ context.Context, deviceID string, chatID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.chats[deviceID], chatID)
+	if d, ok := c.devices[deviceID]; ok && d.OwnerChatID == chatID {
+		d.OwnerChatID = 0
+	}
+	return nil
+}
+
+func (c *Client) ClaimOwnership(_ context.Context, deviceID string, chatID int64, username string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return false, fmt.Errorf("device %s not found", deviceID)
+	}
+	if d.OwnerChatID != 0 {
+		return false, nil
+	}
+	for _, ch := range c.chats[deviceID] {
+		if !ch.Pending {
+			return false, nil
+		}
+	}
+	d.OwnerChatID = chatID
+	c.addUser(deviceID, chatID, username, false)
+	return true, nil
+}
+
+func (c *Client) SaveInvite(_ context.Context, invite *soqchi.Invite) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.invites[invite.Code]; ok {
+		return fmt.Errorf("invite %s already exists", invite.Code)
+	}
+	c.invites[invite.Code] = *invite
+	return nil
+}
+
+func (c *Client) Invite(_ context.Context, code string) (*soqchi.Invite, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inv, ok := c.invites[code]
+	if !ok {
+		return nil, nil
+	}
+	return &inv, nil
+}
+
+func (c *Client) RedeemInvite(_ context.Context, code string, chatID int64, username string, at time.Time) (*soqchi.Invite, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inv, ok := c.invites[code]
+	if !ok || !inv.Valid(at) {
+		return nil, nil
+	}
+	inv.UsedBy, inv.UsedByName, inv.UsedAt = chatID, username, at
+	c.invites[code] = inv
+	c.addUser(inv.DeviceID, chatID, username, false)
+	return &inv, nil
+}
+
+func (c *Client) RevokeInvite(_ context.Context, code string, at time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inv, ok := c.invites[code]
+	if !ok || !inv.UsedAt.IsZero() || !inv.RevokedAt.IsZero() {
+		return false, nil
+	}
+	inv.RevokedAt = at
+	c.invites[code] = inv
+	return true, nil
+}
+
+func (c *Client) Chat(_ context.Context, deviceID string, chatID int64) (*soqchi.Chat, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ch, ok := c.chats[deviceID][chatID]
+	if !ok {
+		return nil, nil
+	}
+	return &soqchi.Chat{ID: chatID, Username: ch.Username, CreatedAt: ch.CreatedAt, Pending: ch.Pending}, nil
+}
+
+func (c *Client) Device(_ context.Context, deviceID string) (*soqchi.Device, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return nil, nil
+	}
+	return copyDevice(d), nil
+}
+
+func (c *Client) AllDevices(_ context.Context) ([]*soqchi.Device, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []*soqchi.Device
+	for _, d := range c.devices {
+		result = append(result, copyDevice(d))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (c *Client) SetAccess(_ context.Context, deviceID string, allowed bool, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.AccessAllowed = allowed
+	d.AccessAllowedUntil = until
+	return nil
+}
+
+func (c *Client) SetAccessWindows(_ context.Context, deviceID string, windows soqchi.AccessSchedule) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.AccessWindows = append(soqchi.AccessSchedule(nil), windows...)
+	return nil
+}
+
+func (c *Client) SetThresholds(_ context.Context, deviceID string, t soqchi.Thresholds) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.Thresholds = t.Copy()
+	return nil
+}
+
+func (c *Client) ChatDevices(_ context.Context, chatID int64) ([]*soqchi.Device, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []*soqchi.Device
+	for id, d := range c.devices {
+		if ch, ok := c.chats[id][chatID]; ok && !ch.Pending {
+			result = append(result, copyDevice(d))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (c *Client) AllChats(_ context.Context, deviceID string) ([]int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var chats []int64
+	for id, ch := range c.chats[deviceID] {
+		if !ch.Pending {
+			chats = append(chats, id)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i] < chats[j] })
+	return chats, nil
+}
+
+func (c *Client) SaveHeartbeat(_ context.Context, deviceID string, t time.Time, voltage, temperature float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.LastMessageAt = t
+	d.LastHeartbeatAt = t
+	d.Voltage = voltage
+
+	hbs := c.heartbeats[deviceID]
+	// heartbeat se stejným časem přepíše předchozí - stejně jako dokument se stejným ID ve Firestore
+	for i := range hbs {
+		if hbs[i].At.Equal(t) {
+			hbs[i] = soqchi.Heartbeat{At: t, Voltage: voltage, Temperature: temperature}
+			return nil
+		}
+	}
+	hbs = append(hbs, soqchi.Heartbeat{At: t, Voltage: voltage, Temperature: temperature})
+	sort.Slice(hbs, func(i, j int) bool { return hbs[i].At.Before(hbs[j].At) })
+	c.heartbeats[deviceID] = hbs
+	return nil
+}
+
+func (c *Client) SaveTimestamp(_ context.Context, deviceID string, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.LastMessageAt = t
+	return nil
+}
+
+func (c *Client) RegisterFrame(_ context.Context, deviceID, key string, at time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// starší framy už duplicitou být nemohou, evidence by jinak rostla donekonečna
+	for k, t := range c.frames {
+		if t.Before(at.Add(-frameRetention)) {
+			delete(c.frames, k)
+		}
+	}
+
+	k := deviceID + "/" + key
+	if _, ok := c.frames[k]; ok {
+		return false, nil
+	}
+	c.frames[k] = at
+	return true, nil
+}
+
+func (c *Client) ReleaseFrame(_ context.Context, deviceID, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.frames, deviceID+"/"+key)
+	return nil
+}
+
+func (c *Client) SaveUnclaimed(_ context.Context, msg *soqchi.Message) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, ok := c.unclaimed[msg.DeviceID]
+	if !ok {
+		u = &soqchi.UnclaimedDevice{ID: msg.DeviceID, FirstSeenAt: msg.At}
+		c.unclaimed[msg.DeviceID] = u
+	}
+	u.LastSeenAt = msg.At
+	u.LastRaw = msg.Raw
+	u.Count++
+	return u.FirstSeenAt.Equal(msg.At), nil
+}
+
+func (c *Client) UnclaimedDevices(_ context.Context) ([]*soqchi.UnclaimedDevice, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []*soqchi.UnclaimedDevice
+	for _, u := range c.unclaimed {
+		ud := *u
+		result = append(result, &ud)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeenAt.After(result[j].LastSeenAt) })
+	return result, nil
+}
+
+func (c *Client) ClaimDevice(_ context.Context, deviceID, name string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, ok := c.unclaimed[deviceID]
+	if !ok {
+		return false, nil
+	}
+	if _, exists := c.devices[deviceID]; exists {
+		return false, fmt.Errorf("device %s already exists", deviceID)
+	}
+	c.devices[deviceID] = &soqchi.Device{ID: deviceID, Name: name, LastMessageAt: u.LastSeenAt}
+	delete(c.unclaimed, deviceID)
+	return true, nil
+}
+
+func (c *Client) SaveMessage(_ context.Context, msg *soqchi.Message, downlink string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lm := soqchi.LoggedMessage{Message: *msg, Downlink: downlink}
+	msgs := c.messages[msg.DeviceID]
+	for i := range msgs {
+		if msgs[i].At.Equal(msg.At) {
+			msgs[i] = lm
+			return nil
+		}
+	}
+	msgs = append(msgs, lm)
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].At.Before(msgs[j].At) })
+	c.messages[msg.DeviceID] = msgs
+	return nil
+}
+
+func (c *Client) Messages(_ context.Context, deviceID string, from, to time.Time) ([]soqchi.LoggedMessage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []soqchi.LoggedMessage
+	for _, m := range c.messages[deviceID] {
+		if !m.At.Before(from) && m.At.Before(to) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func (c *Client) Heartbeats(_ context.Context, deviceID string, from, to time.Time, limit int) (soqchi.Heartbeats, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result soqchi.Heartbeats
+	for _, h := range c.heartbeats[deviceID] {
+		if !h.At.Before(from) && h.At.Before(to) {
+			result = append(result, h)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result, nil
+}
+
+func (c *Client) DeviceInfo(_ context.Context, deviceID string) (*soqchi.DeviceInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	hbs := c.heartbeats[deviceID]
+	if len(hbs) > heartbeatLimit {
+		hbs = hbs[len(hbs)-heartbeatLimit:]
+	}
+	var inf = soqchi.DeviceInfo{HeartBeats: soqchi.Heartbeats{}}
+	inf.HeartBeats = append(inf.HeartBeats, hbs...)
+	return &inf, nil
+}
+
+func copyDevice(d *soqchi.Device) *soqchi.Device {
+	dev := *d
+	dev.AccessWindows = append(soqchi.AccessSchedule(nil), d.AccessWindows...)
+	dev.Thresholds = d.Thresholds.Copy()
+	return &dev
+}
+
+func (c *Client) AlertStates(_ context.Context, deviceID string) ([]soqchi.AlertState, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var states []soqchi.AlertState
+	for _, st := range c.alerts[deviceID] {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Condition < states[j].Condition })
+	return states, nil
+}
+
+func (c *Client) SaveAlertState(_ context.Context, deviceID string, state soqchi.AlertState) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.devices[deviceID]; !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	if c.alerts[deviceID] == nil {
+		c.alerts[deviceID] = map[soqchi.AlertCondition]soqchi.AlertState{}
+	}
+	c.alerts[deviceID][state.Condition] = state
+	return nil
+}
+
+func (c *Client) AddSubscription(_ context.Context, deviceID string, sub soqchi.Subscription) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.devices[deviceID]; !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	for i, s := range c.subs[deviceID] {
+		if s.Channel == sub.Channel && s.Address == sub.Address {
+			c.subs[deviceID][i] = sub
+			return nil
+		}
+	}
+	c.subs[deviceID] = append(c.subs[deviceID], sub)
+	return nil
+}
+
+func (c *Client) RemoveSubscription(_ context.Context, deviceID string, channel soqchi.Channel, address string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subs := c.subs[deviceID]
+	for i, s := range subs {
+		if s.Channel == channel && s.Address == address {
+			c.subs[deviceID] = append(subs[:i:i], subs[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) Subscriptions(_ context.Context, deviceID string) ([]soqchi.Subscription, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	subs := append([]soqchi.Subscription(nil), c.subs[deviceID]...)
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (c *Client) ChatSettings(_ context.Context, chatID int64) (*soqchi.ChatSettings, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok := c.settings[chatID]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (c *Client) SaveChatSettings(_ context.Context, s soqchi.ChatSettings) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settings[s.ChatID] = s
+	return nil
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"net"
+	"net/smtp"
+	"os"
+)
+
+const (
+	// EnvSMTPAddr je adresa SMTP serveru (host:port), bez ní se e-maily neposílají
+	EnvSMTPAddr = "SMTP_ADDR"
+	// EnvSMTPFrom je adresa odesílatele e-mailů
+	EnvSMTPFrom = "SMTP_FROM"
+	// EnvSMTPUser a EnvSMTPPassword jsou přihlašovací údaje k SMTP serveru, bez nich se nepřihlašuje
+	EnvSMTPUser     = "SMTP_USER"
+	EnvSMTPPassword = "SMTP_PASSWORD"
+	// EnvNtfyServer je výchozí ntfy server pro odběry zadané jen názvem tématu
+	EnvNtfyServer = "NTFY_SERVER"
+	// EnvNtfyToken je přístupový token k ntfy serveru
+	EnvNtfyToken = "NTFY_TOKEN"
+
+	defaultNtfyServer = "https://ntfy.sh"
+)
+
+// FromEnv vrací dispatcher s kanály nastavenými proměnnými prostředí. Telegram, webhook a ntfy jsou
+// k dispozici vždy, e-mail jen při nastavení SMTP_ADDR a SMTP_FROM.
+func FromEnv(telegram interface {
+	Send(chats []int64, msg string) error
+}) *Dispatcher {
+	d := NewDispatcher()
+	d.Register(soqchi.ChannelTelegram, &Telegram{Sender: telegram})
+	d.Register(soqchi.ChannelWebhook, &Webhook{})
+
+	ntfy := &Ntfy{Server: os.Getenv(EnvNtfyServer), Token: os.Getenv(EnvNtfyToken)}
+	if ntfy.Server == "" {
+		ntfy.Server = defaultNtfyServer
+	}
+	d.Register(soqchi.ChannelNtfy, ntfy)
+
+	if addr, from := os.Getenv(EnvSMTPAddr), os.Getenv(EnvSMTPFrom); addr != "" && from != "" {
+		s := &SMTP{Addr: addr, From: from}
+		if user := os.Getenv(EnvSMTPUser); user != "" {
+			host, _, _ := net.SplitHostPort(addr)
+			s.Auth = smtp.PlainAuth("", user, os.Getenv(EnvSMTPPassword), host)
+		}
+		d.Register(soqchi.ChannelEmail, s)
+	}
+	return d
+}
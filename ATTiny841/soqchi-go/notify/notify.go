@@ -0,0 +1,106 @@
+// Package notify doručuje zprávy příjemcům v různých kanálech - do Telegramu, e-mailem přes SMTP,
+// obecným JSON webhookem a HTTP pushem ve stylu ntfy. Dispatcher rozešle zprávu každému příjemci
+// kanálem, který si zvolil.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// httpTimeout je výchozí timeout HTTP kanálů (webhook, ntfy)
+const httpTimeout = 10 * time.Second
+
+// ErrNonPublicAddress vrací HTTP kanály při pokusu o spojení s adresou z vnitřní sítě
+var ErrNonPublicAddress = errors.New("non-public address")
+
+// operatorClient je výchozí HTTP klient pro servery nastavené provozovatelem (NTFY_SERVER)
+var operatorClient = &http.Client{Timeout: httpTimeout}
+
+// publicClient je výchozí HTTP klient pro URL zadané uživateli. Připojí se jen na veřejné adresy -
+// kontroluje až adresu, na kterou se jméno přeložilo (i při přesměrování), a nepoužívá proxy.
+var publicClient = &http.Client{
+	Timeout: httpTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: httpTimeout,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !soqchi.IsPublicIP(ip) {
+					return fmt.Errorf("%w %s", ErrNonPublicAddress, host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: httpTimeout,
+	},
+}
+
+// Message je zpráva pro příjemce
+type Message struct {
+	// DeviceID je zařízení, kterého se zpráva týká, u obecných zpráv je prázdné
+	DeviceID string
+	// Title je krátký titulek zprávy - předmět e-mailu, titulek push notifikace
+	Title string
+	Text  string
+}
+
+// Notifier doručí zprávu jednomu příjemci. Tvar adresy odběru určuje kanál - ID chatu, e-mailová
+// adresa, URL...
+type Notifier interface {
+	Notify(ctx context.Context, to soqchi.Subscription, msg Message) error
+}
+
+// Dispatcher rozesílá zprávy přes notifiery registrované pro jednotlivé kanály
+type Dispatcher struct {
+	notifiers map[soqchi.Channel]Notifier
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{notifiers: map[soqchi.Channel]Notifier{}}
+}
+
+// Register nastaví notifier pro kanál
+func (d *Dispatcher) Register(channel soqchi.Channel, n Notifier) {
+	d.notifiers[channel] = n
+}
+
+// Send doručí zprávu všem příjemcům. Chyba doručení jednomu příjemci nebrání doručení ostatním a jen
+// se zaloguje - opakování celého rozeslání by ostatním příjemcům poslalo zprávu znovu.
+func (d *Dispatcher) Send(ctx context.Context, recipients []soqchi.Subscription, msg Message) {
+	for _, r := range recipients {
+		var err error
+		if n, ok := d.notifiers[r.Channel]; ok {
+			err = n.Notify(ctx, r, msg)
+		} else {
+			err = fmt.Errorf("channel %q is not configured", r.Channel)
+		}
+		if err != nil {
+			log.Printf("notification to %s failed: %s", r, err.Error())
+		}
+	}
+}
+
+// do odešle HTTP požadavek a za chybu považuje i odpověď mimo 2xx
+func do(c *http.Client, rq *http.Request) error {
+	resp, err := c.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s responded %s", rq.Method, rq.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordedRequest je požadavek zachycený testovacím HTTP serverem
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func recordingServer(t *testing.T, status int) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var rqs []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rqs = append(rqs, recordedRequest{path: r.URL.Path, header: r.Header, body: body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &rqs
+}
+
+func TestWebhook(t *testing.T) {
+	srv, rqs := recordingServer(t, http.StatusNoContent)
+	w := &Webhook{Client: srv.Client()}
+
+	msg := Message{DeviceID: "ABC", Title: "soqchi - chata", Text: "‼️ chata (ABC) - ALARM"}
+	to := soqchi.Subscription{Channel: soqchi.ChannelWebhook, Address: srv.URL + "/hook", Secret: "tajne"}
+	if err := w.Notify(context.Background(), to, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(*rqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*rqs))
+	}
+	rq := (*rqs)[0]
+	if rq.path != "/hook" || rq.header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %s %v", rq.path, rq.header)
+	}
+	if sig := rq.header.Get(hWebhookSignature); sig != "sha256="+Signature("tajne", rq.body) {
+		t.Errorf("invalid signature %q", sig)
+	}
+
+	var p WebhookPayload
+	if err := json.Unmarshal(rq.body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.DeviceID != "ABC" || p.Title != msg.Title || p.Message != msg.Text || p.SentAt.IsZero() {
+		t.Errorf("unexpected payload %#v", p)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	srv, _ := recordingServer(t, http.StatusInternalServerError)
+	w := &Webhook{Client: srv.Client()}
+	if err := w.Notify(context.Background(), soqchi.Subscription{Address: srv.URL}, Message{Text: "test"}); err == nil {
+		t.Error("expected error for status 500")
+	}
+}
+
+func TestNonPublicAddress(t *testing.T) {
+	// testovací server poslouchá na loopbacku, výchozí klient se na něj nesmí připojit
+	srv, rqs := recordingServer(t, http.StatusOK)
+	to := soqchi.Subscription{Address: srv.URL + "/hook"}
+	if err := (&Webhook{}).Notify(context.Background(), to, Message{Text: "test"}); !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("expected non-public address error, got %v", err)
+	}
+	if err := (&Ntfy{Server: "https://ntfy.example.com"}).Notify(context.Background(), to, Message{Text: "test"}); !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("expected non-public address error, got %v", err)
+	}
+	if len(*rqs) != 0 {
+		t.Errorf("unexpected requests %v", *rqs)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	srv, rqs := recordingServer(t, http.StatusOK)
+	n := &Ntfy{Client: srv.Client(), Server: srv.URL + "/", Token: "tk"}
+
+	msg := Message{Title: "soqchi - chata", Text: "🔥 chata (ABC) - teplota 31.0 °C překročila 30.0 °C"}
+	if err := n.Notify(context.Background(), soqchi.Subscription{Address: "chata-alarm"}, msg); err != nil {
+		t.Fatal(err)
+	}
+	// celá URL tématu na jiném serveru
+	if err := n.Notify(context.Background(), soqchi.Subscription{Address: srv.URL + "/jiny"}, Message{Title: "Teplota ve sklepě", Text: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*rqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(*rqs))
+	}
+	rq := (*rqs)[0]
+	if rq.path != "/chata-alarm" || string(rq.body) != msg.Text {
+		t.Errorf("unexpected request %s %q", rq.path, rq.body)
+	}
+	if rq.header.Get("Authorization") != "Bearer tk" || rq.header.Get("Title") != msg.Title {
+		t.Errorf("unexpected headers %v", rq.header)
+	}
+
+	rq = (*rqs)[1]
+	title, err := new(mime.WordDecoder).DecodeHeader(rq.header.Get("Title"))
+	if rq.path != "/jiny" || err != nil || title != "Teplota ve sklepě" {
+		t.Errorf("unexpected request %s, title %q (%v)", rq.path, title, err)
+	}
+}
+
+// testNotifier zaznamenává adresy, kterým doručil zprávu
+type testNotifier struct {
+	addresses []string
+	err       error
+}
+
+func (n *testNotifier) Notify(_ context.Context, to soqchi.Subscription, _ Message) error {
+	n.addresses = append(n.addresses, to.Address)
+	return n.err
+}
+
+func TestDispatcher(t *testing.T) {
+	tg := &testNotifier{}
+	mail := &testNotifier{err: errors.New("mailbox full")}
+	d := NewDispatcher()
+	d.Register(soqchi.ChannelTelegram, tg)
+	d.Register(soqchi.ChannelEmail, mail)
+
+	d.Send(context.Background(), []soqchi.Subscription{
+		{Channel: soqchi.ChannelEmail, Address: "babicka@example.com"},
+		{Channel: soqchi.ChannelNtfy, Address: "chata"},
+		{Channel: soqchi.ChannelTelegram, Address: "42"},
+	}, Message{Text: "test"})
+
+	// chyba e-mailu ani nenastavený kanál nebrání doručení dalším příjemcům
+	if len(tg.addresses) != 1 || tg.addresses[0] != "42" {
+		t.Errorf("unexpected telegram recipients %v", tg.addresses)
+	}
+	if len(mail.addresses) != 1 {
+		t.Errorf("unexpected e-mail recipients %v", mail.addresses)
+	}
+}
+
+// testSender zaznamenává chaty, kterým telegram bot poslal zprávu
+type testSender struct {
+	chats []int64
+}
+
+func (s *testSender) Send(chats []int64, _ string) error {
+	s.chats = append(s.chats, chats...)
+	return nil
+}
+
+func TestTelegram(t *testing.T) {
+	s := &testSender{}
+	tg := &Telegram{Sender: s}
+	if err := tg.Notify(context.Background(), soqchi.Subscription{Address: "-1001"}, Message{Text: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tg.Notify(context.Background(), soqchi.Subscription{Address: "franta"}, Message{Text: "test"}); err == nil {
+		t.Error("expected error for invalid chat ID")
+	}
+	if len(s.chats) != 1 || s.chats[0] != -1001 {
+		t.Errorf("unexpected chats %v", s.chats)
+	}
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Ntfy doručuje zprávy HTTP pushem ve stylu ntfy (https://ntfy.sh) - text zprávy se pošle POSTem na
+// URL tématu. Adresou je název tématu na serveru Server nebo celá URL tématu na jiném serveru.
+type Ntfy struct {
+	// Client je HTTP klient, nil znamená výchozího klienta - pro témata na jiných serverech takového,
+	// který se připojí jen na veřejné adresy
+	Client *http.Client
+	// Server je URL výchozího serveru, např. https://ntfy.sh
+	Server string
+	// Token je přístupový token k serveru, prázdný znamená bez přihlášení
+	Token string
+}
+
+func (n *Ntfy) Notify(ctx context.Context, to soqchi.Subscription, msg Message) error {
+	u, c := to.Address, publicClient
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		u, c = strings.TrimSuffix(n.Server, "/")+"/"+to.Address, operatorClient
+	}
+	if n.Client != nil {
+		c = n.Client
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(msg.Text))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if msg.Title != "" {
+		// hlavičky HTTP jsou ASCII, ntfy proto přijímá titulek kódovaný dle RFC 2047
+		rq.Header.Set("Title", mime.QEncoding.Encode("utf-8", msg.Title))
+	}
+	if n.Token != "" {
+		rq.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return do(c, rq)
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMail je e-mail přijatý testovacím SMTP serverem
+type smtpMail struct {
+	from, to, data string
+}
+
+// fakeSMTP spustí minimální SMTP server, který přijme jedno spojení a pošle přijatý e-mail do kanálu
+func fakeSMTP(t *testing.T) (string, <-chan smtpMail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	mails := make(chan smtpMail, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tc := textproto.NewConn(conn)
+		var m smtpMail
+		_ = tc.PrintfLine("220 localhost ESMTP test")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				_ = tc.PrintfLine("250 localhost")
+			case "MAIL":
+				m.from = strings.TrimPrefix(line, "MAIL FROM:")
+				_ = tc.PrintfLine("250 OK")
+			case "RCPT":
+				m.to = strings.TrimPrefix(line, "RCPT TO:")
+				_ = tc.PrintfLine("250 OK")
+			case "DATA":
+				_ = tc.PrintfLine("354 end with .")
+				data, err := tc.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				m.data = string(data)
+				_ = tc.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tc.PrintfLine("221 bye")
+				mails <- m
+				return
+			default:
+				_ = tc.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func TestSMTP(t *testing.T) {
+	addr, mails := fakeSMTP(t)
+	s := &SMTP{Addr: addr, From: "soqchi@example.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.Notify(ctx, soqchi.Subscription{Address: "babicka@example.com"}, Message{DeviceID: "ABC", Title: "soqchi - chata", Text: "‼️ chata (ABC) - ALARM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m smtpMail
+	select {
+	case m = <-mails:
+	case <-ctx.Done():
+		t.Fatal("mail not received")
+	}
+	if m.from != "<soqchi@example.com>" || m.to != "<babicka@example.com>" {
+		t.Errorf("unexpected envelope %q -> %q", m.from, m.to)
+	}
+
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(m.data)))
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Get("Subject") != "soqchi - chata" || h.Get("To") != "babicka@example.com" {
+		t.Errorf("unexpected headers %v", h)
+	}
+	if !strings.HasPrefix(h.Get("Content-Type"), "text/plain; charset=utf-8") {
+		t.Errorf("unexpected content type %q", h.Get("Content-Type"))
+	}
+	if !strings.Contains(m.data, "‼️ chata (ABC) - ALARM") {
+		t.Errorf("body not found in %q", m.data)
+	}
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := &SMTP{Addr: addr, From: "soqchi@example.com"}
+	if err := s.Notify(context.Background(), soqchi.Subscription{Address: "babicka@example.com"}, Message{Text: "test"}); err == nil {
+		t.Error("expected error for unreachable server")
+	}
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"strconv"
+)
+
+// Telegram doručuje zprávy do Telegram chatů, adresou je ID chatu
+type Telegram struct {
+	Sender interface {
+		Send(chats []int64, msg string) error
+	}
+}
+
+func (t *Telegram) Notify(_ context.Context, to soqchi.Subscription, msg Message) error {
+	chatID, err := strconv.ParseInt(to.Address, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID %q", to.Address)
+	}
+	return t.Sender.Send([]int64{chatID}, msg.Text)
+}
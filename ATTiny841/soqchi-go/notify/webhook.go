@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"net/http"
+	"time"
+)
+
+// hWebhookSignature je hlavička s HMAC-SHA256 podpisem těla požadavku webhooku
+const hWebhookSignature = "X-Soqchi-Signature"
+
+// Webhook doručuje zprávy jako JSON POST, adresou je URL webhooku. Tělo se podepisuje klíčem odběru
+// (Subscription.Secret) v hlavičce X-Soqchi-Signature ("sha256=<hex>"), odběr bez klíče bez podpisu.
+type Webhook struct {
+	// Client je HTTP klient, nil znamená klienta, který se připojí jen na veřejné adresy
+	Client *http.Client
+}
+
+// WebhookPayload je tělo požadavku webhooku
+type WebhookPayload struct {
+	DeviceID string    `json:"deviceID,omitempty"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, to soqchi.Subscription, msg Message) error {
+	raw, err := json.Marshal(WebhookPayload{
+		DeviceID: msg.DeviceID,
+		Title:    msg.Title,
+		Message:  msg.Text,
+		SentAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("can't marshal webhook payload: %w", err)
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, to.Address, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+	if to.Secret != "" {
+		rq.Header.Set(hWebhookSignature, "sha256="+Signature(to.Secret, raw))
+	}
+
+	c := publicClient
+	if w.Client != nil {
+		c = w.Client
+	}
+	return do(c, rq)
+}
+
+// Signature vrací hexadecimální HMAC-SHA256 podpis těla body klíčem secret
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
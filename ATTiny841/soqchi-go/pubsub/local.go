@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Handler zpracuje data zprávy doručené do topicu
+type Handler func(ctx context.Context, data []byte) error
+
+type envelope struct {
+	topic string
+	data  []byte
+}
+
+// Queue je fronta zpráv uvnitř procesu, která nahrazuje Google Pub/Sub při provozu mimo cloud.
+// Zprávy se zpracovávají postupně v jedné gorutině spuštěné metodou Run.
+type Queue struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	// closeMu je oddělený od mu, aby publikování čekající na místo ve frontě neblokovalo Run
+	closeMu sync.RWMutex
+	closed  bool
+	ch      chan envelope
+	done    chan struct{}
+}
+
+var (
+	localQueue *Queue
+)
+
+// NewQueue vytvoří frontu pro size čekajících zpráv
+func NewQueue(size int) *Queue {
+	return &Queue{
+		handlers: map[string]Handler{},
+		ch:       make(chan envelope, size),
+		done:     make(chan struct{}),
+	}
+}
+
+// UseQueue přesměruje publikování přes NewPublisher do fronty q místo Google Pub/Sub
+func UseQueue(q *Queue) {
+	localQueue = q
+}
+
+// Subscribe zaregistruje handler pro zprávy do topicu
+func (q *Queue) Subscribe(topic string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[topic] = h
+}
+
+func (q *Queue) publish(ctx context.Context, topic string, data []byte) error {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.closed {
+		return fmt.Errorf("queue closed")
+	}
+	select {
+	case q.ch <- envelope{topic: topic, data: data}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run zpracovává zprávy z fronty, dokud není fronta uzavřena metodou Close
+func (q *Queue) Run(ctx context.Context) {
+	defer close(q.done)
+
+	for e := range q.ch {
+		q.mu.RLock()
+		h, ok := q.handlers[e.topic]
+		q.mu.RUnlock()
+
+		if !ok {
+			log.Printf("no subscriber for topic %q, message dropped", e.topic)
+			continue
+		}
+		if err := h(ctx, e.data); err != nil {
+			log.Printf("message processing for topic %q failed: %s", e.topic, err.Error())
+		}
+	}
+}
+
+// Close odmítne další zprávy a počká, až Run zpracuje všechny čekající, nejdéle však do konce ctx
+func (q *Queue) Close(ctx context.Context) error {
+	q.closeMu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+	q.closeMu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
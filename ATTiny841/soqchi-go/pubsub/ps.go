@@ -8,6 +8,7 @@ import (
 	"github.com/ISim/Arduino/soqchigfc/soqchi"
 	"os"
 	"sync"
+	"time"
 )
 
 var (
@@ -17,9 +18,14 @@ var (
 )
 
 type PubSub struct {
+	queue *Queue
 }
 
 func NewPublisher() (*PubSub, error) {
+	if localQueue != nil {
+		return &PubSub{queue: localQueue}, nil
+	}
+
 	onceClient.Do(func() {
 		client, clientInitError = pubsub.NewClient(context.Background(), os.Getenv("GOOGLE_CLOUD_PROJECT"))
 	})
@@ -30,23 +36,49 @@ func NewPublisher() (*PubSub, error) {
 }
 
 func (p *PubSub) PlainMessage(ctx context.Context, chats []int64, msg string) error {
-	raw, err := json.Marshal(soqchi.PlainMessage{
+	return p.plainMessage(ctx, soqchi.PlainMessage{
 		Chats:   chats,
 		Message: msg,
 	})
+}
 
+// Event publikuje událost zařízení typu t s daty data v obálce soqchi.Event
+func (p *PubSub) Event(ctx context.Context, t soqchi.EventType, deviceID string, at time.Time, data interface{}) error {
+	e, err := soqchi.NewEvent(t, deviceID, at, data)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(e)
 	if err != nil {
 		return fmt.Errorf("can't marshal data for pub/sub: %w", err)
 	}
 
-	res := client.Topic(soqchi.PlainMessageTopic).Publish(ctx, &pubsub.Message{
-		Data: raw,
-	})
+	return p.publish(ctx, soqchi.EventTopic, raw)
+}
+
+func (p *PubSub) plainMessage(ctx context.Context, m soqchi.PlainMessage) error {
+	raw, err := json.Marshal(m)
 
-	_, err = res.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("can't marshal data for pub/sub: %w", err)
+	}
+
+	return p.publish(ctx, soqchi.PlainMessageTopic, raw)
+}
+
+func (p *PubSub) publish(ctx context.Context, topic string, raw []byte) error {
+	var err error
+	if p.queue != nil {
+		err = p.queue.publish(ctx, topic, raw)
+	} else {
+		res := client.Topic(topic).Publish(ctx, &pubsub.Message{
+			Data: raw,
+		})
+		_, err = res.Get(ctx)
+	}
 
 	if err != nil {
-		return fmt.Errorf("publish to %q failed: %w", soqchi.PlainMessageTopic, err)
+		return fmt.Errorf("publish to %q failed: %w", topic, err)
 	}
 	return nil
 }
@@ -0,0 +1,83 @@
+package soqchi
+
+import "time"
+
+// DoorInterval je doba, kdy byly dveře otevřené - od alarmu po info zprávu se zavřenými dveřmi
+type DoorInterval struct {
+	From time.Time
+	// To je čas zavření, nulový čas znamená, že zavření dosud nepřišlo
+	To time.Time
+}
+
+// Duration vrací délku otevření, u dosud otevřených dveří do času now
+func (i DoorInterval) Duration(now time.Time) time.Duration {
+	if i.To.IsZero() {
+		return now.Sub(i.From)
+	}
+	return i.To.Sub(i.From)
+}
+
+// DoorIntervals sestaví intervaly otevřených dveří ze zpráv msgs (seřazených od nejstarší). Otevření
+// začíná alarmem (nebo info zprávou s otevřenými dveřmi, pokud se alarm ztratil) a končí nejbližší
+// info zprávou se zavřenými dveřmi.
+func DoorIntervals(msgs []LoggedMessage) []DoorInterval {
+	var (
+		result []DoorInterval
+		open   bool
+	)
+	for i := range msgs {
+		m := &msgs[i]
+		switch {
+		case !open && (m.Alarm() || (m.Info() && m.DoorOpen())):
+			result = append(result, DoorInterval{From: m.At})
+			open = true
+		case open && m.Info() && !m.DoorOpen():
+			result[len(result)-1].To = m.At
+			open = false
+		}
+	}
+	return result
+}
+
+// DoorIntervalsFrom sestaví intervaly otevřených dveří jako DoorIntervals, ale vrací jen ty, které
+// zasahují do období od from. Zprávy před from slouží jen ke zjištění, zda byly dveře v čase from
+// otevřené - takový interval začíná v from.
+func DoorIntervalsFrom(msgs []LoggedMessage, from time.Time) []DoorInterval {
+	var result []DoorInterval
+	for _, i := range DoorIntervals(msgs) {
+		if !i.To.IsZero() && !i.To.After(from) {
+			continue
+		}
+		if i.From.Before(from) {
+			i.From = from
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+// ActivityHeatmap je počet otevření dveří podle dne v týdnu (index dle time.Weekday) a hodiny
+type ActivityHeatmap [7][24]int
+
+// NewActivityHeatmap spočítá otevření dveří podle dne v týdnu a hodiny v časové zóně loc
+func NewActivityHeatmap(intervals []DoorInterval, loc *time.Location) ActivityHeatmap {
+	var h ActivityHeatmap
+	for _, i := range intervals {
+		t := i.From.In(loc)
+		h[t.Weekday()][t.Hour()]++
+	}
+	return h
+}
+
+// Max vrací nejvyšší počet otevření v jedné hodině
+func (h *ActivityHeatmap) Max() int {
+	var max int
+	for _, day := range h {
+		for _, n := range day {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
@@ -0,0 +1,56 @@
+package soqchi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDoorIntervals(t *testing.T) {
+	at := time.Date(2022, 2, 21, 22, 0, 0, 0, TZ) // pondělí
+	msg := func(min int, flags byte) LoggedMessage {
+		return LoggedMessage{Message: Message{At: at.Add(time.Duration(min) * time.Minute), Flags: flags}}
+	}
+
+	intervals := DoorIntervals([]LoggedMessage{
+		msg(0, flgHartbeat),
+		msg(10, flgAlarm|flgDoorOpen),
+		msg(12, flgAlarm|flgDoorOpen), // opakovaný alarm interval nezačíná znovu
+		msg(40, flgInfo),              // zavřeno
+		msg(50, flgInfo),
+		msg(130, flgInfo|flgDoorOpen), // ztracený alarm, otevření z info zprávy
+	})
+
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 intervals, got %#v", intervals)
+	}
+	if !intervals[0].From.Equal(at.Add(10*time.Minute)) || intervals[0].Duration(at) != 30*time.Minute {
+		t.Errorf("unexpected first interval %#v", intervals[0])
+	}
+	if !intervals[1].To.IsZero() || intervals[1].Duration(at.Add(3*time.Hour)) != 50*time.Minute {
+		t.Errorf("expected open second interval, got %#v", intervals[1])
+	}
+
+	h := NewActivityHeatmap(intervals, TZ)
+	if h[time.Monday][22] != 1 || h[time.Tuesday][0] != 1 || h.Max() != 1 {
+		t.Errorf("unexpected heatmap %v", h)
+	}
+}
+
+func TestDoorIntervalsFrom(t *testing.T) {
+	at := time.Date(2022, 2, 21, 22, 0, 0, 0, TZ)
+	msg := func(min int, flags byte) LoggedMessage {
+		return LoggedMessage{Message: Message{At: at.Add(time.Duration(min) * time.Minute), Flags: flags}}
+	}
+	msgs := []LoggedMessage{
+		msg(0, flgAlarm|flgDoorOpen),
+		msg(10, flgInfo), // zavřeno před začátkem období
+		msg(20, flgAlarm|flgDoorOpen),
+		msg(40, flgInfo), // otevřeno před začátkem období, zavřeno v něm
+	}
+
+	from := at.Add(30 * time.Minute)
+	intervals := DoorIntervalsFrom(msgs, from)
+	if len(intervals) != 1 || !intervals[0].From.Equal(from) || intervals[0].Duration(at) != 10*time.Minute {
+		t.Errorf("expected interval clipped to window start, got %#v", intervals)
+	}
+}
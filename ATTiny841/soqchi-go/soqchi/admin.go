@@ -0,0 +1,32 @@
+package soqchi
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvAdminChats je název proměnné prostředí s čárkou oddělenými ID chatů administrátorů, kterým
+// chodí upozornění na neznámá zařízení a kteří je mohou převzít do evidence
+const EnvAdminChats = "ADMIN_CHATS"
+
+// AdminChats vrací ID chatů administrátorů z proměnné prostředí ADMIN_CHATS
+func AdminChats() []int64 {
+	var chats []int64
+	for _, s := range strings.Split(os.Getenv(EnvAdminChats), ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			chats = append(chats, id)
+		}
+	}
+	return chats
+}
+
+// IsAdmin vrací true, pokud je chatID mezi chaty administrátorů
+func IsAdmin(admins []int64, chatID int64) bool {
+	for _, id := range admins {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
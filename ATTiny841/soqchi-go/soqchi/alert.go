@@ -0,0 +1,97 @@
+package soqchi
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlertCondition je podmínka zařízení, na kterou se upozorňuje (watchdog, teplota z příchozích zpráv)
+type AlertCondition string
+
+const (
+	AlertNoHeartbeat      AlertCondition = "no_heartbeat"
+	AlertHeartbeatMissing AlertCondition = "heartbeat_missing"
+	AlertLowVoltage       AlertCondition = "low_voltage"
+	AlertCriticalVoltage  AlertCondition = "critical_voltage"
+	AlertTempLow          AlertCondition = "temp_low"
+	AlertTempHigh         AlertCondition = "temp_high"
+	AlertBatteryForecast  AlertCondition = "battery_forecast"
+	// AlertFramesLost nemá trvající stav - upozornění na ztracené zprávy je jednorázové a NotifiedAt
+	// je čas, do kterého už byly ztracené zprávy vyhodnoceny
+	AlertFramesLost AlertCondition = "frames_lost"
+)
+
+// AlertTransition je změna stavu upozornění, o které se posílá zpráva
+type AlertTransition int
+
+const (
+	// AlertUnchanged - stav se nezměnil, nic se neposílá
+	AlertUnchanged AlertTransition = iota
+	// AlertFired - podmínka začala platit
+	AlertFired
+	// AlertReminder - podmínka stále platí a uplynul interval připomínky
+	AlertReminder
+	// AlertResolved - podmínka přestala platit
+	AlertResolved
+)
+
+var alertTransitionNames = [...]string{"unchanged", "fired", "reminder", "resolved"}
+
+func (t AlertTransition) String() string {
+	if t < 0 || int(t) >= len(alertTransitionNames) {
+		return fmt.Sprintf("AlertTransition(%d)", int(t))
+	}
+	return alertTransitionNames[t]
+}
+
+// MarshalText kóduje změnu stavu v datech událostí jménem, např. "fired"
+func (t AlertTransition) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *AlertTransition) UnmarshalText(b []byte) error {
+	for i, n := range alertTransitionNames {
+		if n == string(b) {
+			*t = AlertTransition(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown alert transition %q", string(b))
+}
+
+// alertReminderSlack je tolerance intervalu připomínek - watchdog spouštěný plánovačem jednou
+// denně neběží přesně po 24 hodinách
+const alertReminderSlack = 10 * time.Minute
+
+// AlertState je stav upozornění na jednu podmínku zařízení (ok → firing → resolved)
+type AlertState struct {
+	Condition AlertCondition
+	// Firing je true, dokud podmínka platí
+	Firing bool
+	// Since je čas, kdy podmínka začala platit
+	Since time.Time
+	// NotifiedAt je čas posledního upozornění (i připomínky)
+	NotifiedAt time.Time
+	// ResolvedAt je čas, kdy podmínka naposledy přestala platit
+	ResolvedAt time.Time
+}
+
+// Update aktualizuje stav podle toho, zda podmínka v čase now platí, a vrací změnu, o které je třeba
+// poslat zprávu. Kladný remind je interval připomínek trvající podmínky, 0 znamená bez připomínek.
+func (s *AlertState) Update(active bool, now time.Time, remind time.Duration) AlertTransition {
+	switch {
+	case active && !s.Firing:
+		s.Firing = true
+		s.Since = now
+		s.NotifiedAt = now
+		return AlertFired
+	case active && remind > 0 && now.Sub(s.NotifiedAt) >= remind-alertReminderSlack:
+		s.NotifiedAt = now
+		return AlertReminder
+	case !active && s.Firing:
+		s.Firing = false
+		s.ResolvedAt = now
+		return AlertResolved
+	}
+	return AlertUnchanged
+}
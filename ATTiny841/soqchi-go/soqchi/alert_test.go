@@ -0,0 +1,37 @@
+package soqchi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertStateUpdate(t *testing.T) {
+	now := time.Date(2022, 2, 20, 8, 0, 0, 0, TZ)
+	day := 24 * time.Hour
+	s := AlertState{Condition: AlertLowVoltage}
+
+	steps := []struct {
+		at     time.Time
+		active bool
+		remind time.Duration
+		exp    AlertTransition
+	}{
+		{now, false, 0, AlertUnchanged},
+		{now.Add(day), true, 0, AlertFired},
+		{now.Add(2 * day), true, 0, AlertUnchanged},
+		// plánovač nespouští watchdog přesně po 24 hodinách
+		{now.Add(3*day - time.Minute), true, day, AlertReminder},
+		{now.Add(3*day + time.Hour), true, day, AlertUnchanged},
+		{now.Add(4 * day), false, day, AlertResolved},
+		{now.Add(5 * day), false, day, AlertUnchanged},
+		{now.Add(6 * day), true, day, AlertFired},
+	}
+	for i, st := range steps {
+		if tr := s.Update(st.active, st.at, st.remind); tr != st.exp {
+			t.Errorf("step %d: expected transition %d, got %d", i, st.exp, tr)
+		}
+	}
+	if !s.Firing || !s.Since.Equal(now.Add(6*day)) || !s.ResolvedAt.Equal(now.Add(4*day)) {
+		t.Errorf("unexpected state %#v", s)
+	}
+}
@@ -0,0 +1,139 @@
+package soqchi
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// batteryMinSamples je nejmenší počet heartbeatů, ze kterých se trend napětí počítá
+	batteryMinSamples = 5
+	// batteryMinSpan je nejkratší období heartbeatů, ze kterého má trend smysl
+	batteryMinSpan = 3 * 24 * time.Hour
+	// batteryMinTempStdDev - při menším rozptylu teplot se korekce na teplotu nepoužije, regrese by byla nestabilní
+	batteryMinTempStdDev = 1.0
+)
+
+// BatteryForecast je odhad vývoje napětí baterie z lineární regrese přes historii heartbeatů.
+// Napětí baterie závisí i na teplotě, proto se při dostatečném rozptylu teplot regrese počítá jako
+// V = Intercept + Slope*dny + TempCoef*teplota a odhad se promítá pro průměrnou teplotu.
+type BatteryForecast struct {
+	// Start je čas prvního heartbeatu, od kterého se počítají dny
+	Start time.Time
+	// Intercept je napětí v čase Start při teplotě 0 °C (bez teplotní korekce přímo napětí)
+	Intercept float64
+	// Slope je změna napětí ve V za den, vybíjení je záporné
+	Slope float64
+	// TempCoef je změna napětí ve V na °C, 0 pokud se teplotní korekce nepoužila
+	TempCoef float64
+	// Temperature je teplota, pro kterou se odhad promítá (průměr z heartbeatů)
+	Temperature float64
+	// Limit je napětí, pro které se odhaduje LimitAt
+	Limit float64
+	// LimitAt je odhadovaný čas poklesu napětí pod Limit, nulový pokud napětí neklesá
+	LimitAt time.Time
+}
+
+// Voltage vrací odhadované napětí v čase at
+func (f *BatteryForecast) Voltage(at time.Time) float64 {
+	return f.Intercept + f.Slope*at.Sub(f.Start).Hours()/24 + f.TempCoef*f.Temperature
+}
+
+// DaysLeft vrací počet dní od now do odhadovaného poklesu pod limit, false pokud napětí neklesá
+func (f *BatteryForecast) DaysLeft(now time.Time) (int, bool) {
+	if f.LimitAt.IsZero() {
+		return 0, false
+	}
+	days := int(math.Ceil(f.LimitAt.Sub(now).Hours() / 24))
+	if days < 0 {
+		days = 0
+	}
+	return days, true
+}
+
+// PredictBattery spočítá trend napětí z heartbeatů data (seřazených od nejstaršího) a odhadne, kdy
+// napětí klesne pod limit. Pokud je heartbeatů málo nebo pokrývají příliš krátké období, vrací false.
+func PredictBattery(data Heartbeats, limit float64) (*BatteryForecast, bool) {
+	if len(data) < batteryMinSamples || data[len(data)-1].At.Sub(data[0].At) < batteryMinSpan {
+		return nil, false
+	}
+
+	f := &BatteryForecast{Start: data[0].At, Limit: limit}
+	n := float64(len(data))
+
+	var meanT float64
+	for _, h := range data {
+		meanT += h.Temperature
+	}
+	meanT /= n
+	var varT float64
+	for _, h := range data {
+		varT += (h.Temperature - meanT) * (h.Temperature - meanT)
+	}
+	f.Temperature = meanT
+
+	// normální rovnice metody nejmenších čtverců pro V = a + b*x + c*T
+	var sx, st, sv, sxx, stt, sxt, sxv, stv float64
+	for _, h := range data {
+		x := h.At.Sub(f.Start).Hours() / 24
+		sx += x
+		st += h.Temperature
+		sv += h.Voltage
+		sxx += x * x
+		stt += h.Temperature * h.Temperature
+		sxt += x * h.Temperature
+		sxv += x * h.Voltage
+		stv += h.Temperature * h.Voltage
+	}
+
+	solved := false
+	if math.Sqrt(varT/n) >= batteryMinTempStdDev {
+		f.Intercept, f.Slope, f.TempCoef, solved = solve3(
+			[3][4]float64{
+				{n, sx, st, sv},
+				{sx, sxx, sxt, sxv},
+				{st, sxt, stt, stv},
+			})
+	}
+	if !solved {
+		det := n*sxx - sx*sx
+		if det == 0 {
+			return nil, false
+		}
+		f.TempCoef = 0
+		f.Slope = (n*sxv - sx*sv) / det
+		f.Intercept = (sv - f.Slope*sx) / n
+	}
+
+	if f.Slope < 0 {
+		days := (limit - f.Intercept - f.TempCoef*f.Temperature) / f.Slope
+		f.LimitAt = f.Start.Add(time.Duration(days * 24 * float64(time.Hour))).Round(time.Minute)
+	}
+	return f, true
+}
+
+// solve3 vyřeší soustavu tří lineárních rovnic zadanou rozšířenou maticí Gaussovou eliminací
+func solve3(m [3][4]float64) (float64, float64, float64, bool) {
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return 0, 0, 0, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := 0; row < 3; row++ {
+			if row == col {
+				continue
+			}
+			k := m[row][col] / m[col][col]
+			for c := col; c < 4; c++ {
+				m[row][c] -= k * m[col][c]
+			}
+		}
+	}
+	return m[0][3] / m[0][0], m[1][3] / m[1][1], m[2][3] / m[2][2], true
+}
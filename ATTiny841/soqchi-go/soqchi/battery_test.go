@@ -0,0 +1,64 @@
+package soqchi
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPredictBattery(t *testing.T) {
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, TZ)
+
+	// napětí klesá o 10 mV za den a navíc kolísá s teplotou o 5 mV/°C
+	var data Heartbeats
+	for i := 0; i < 30; i++ {
+		temp := 10 + 8*math.Sin(float64(i))
+		data = append(data, Heartbeat{
+			At:          start.AddDate(0, 0, i),
+			Voltage:     3.0 - 0.01*float64(i) + 0.005*temp,
+			Temperature: temp,
+		})
+	}
+
+	f, ok := PredictBattery(data, VoltageLimit)
+	if !ok {
+		t.Fatal("expected forecast")
+	}
+	if math.Abs(f.Slope+0.01) > 1e-6 || math.Abs(f.TempCoef-0.005) > 1e-6 {
+		t.Errorf("unexpected regression slope %f, temp coef %f", f.Slope, f.TempCoef)
+	}
+
+	// při průměrné teplotě je napětí 3.0 + 0.005*průměr, limit 2.5 V
+	exp := start.Add(time.Duration((0.5 + 0.005*f.Temperature) / 0.01 * 24 * float64(time.Hour)))
+	if d := f.LimitAt.Sub(exp); d > time.Minute || d < -time.Minute {
+		t.Errorf("expected limit at %s, got %s", exp, f.LimitAt)
+	}
+	if days, ok := f.DaysLeft(start.AddDate(0, 0, 29)); !ok || days <= 0 {
+		t.Errorf("unexpected days left %d %v", days, ok)
+	}
+
+	// stálá teplota - jen lineární trend
+	for i := range data {
+		data[i].Temperature = 5
+		data[i].Voltage = 3.0 - 0.02*float64(i)
+	}
+	f, ok = PredictBattery(data, VoltageLimit)
+	if !ok || f.TempCoef != 0 || math.Abs(f.Slope+0.02) > 1e-9 {
+		t.Fatalf("unexpected forecast %#v", f)
+	}
+	if !f.LimitAt.Equal(start.AddDate(0, 0, 25)) {
+		t.Errorf("expected limit after 25 days, got %s", f.LimitAt)
+	}
+
+	// napětí neklesá
+	for i := range data {
+		data[i].Voltage = 3
+	}
+	if f, ok := PredictBattery(data, VoltageLimit); !ok || !f.LimitAt.IsZero() {
+		t.Errorf("expected no limit for flat voltage, got %#v", f)
+	}
+
+	if _, ok := PredictBattery(data[:3], VoltageLimit); ok {
+		t.Error("too few heartbeats must not be predicted")
+	}
+}
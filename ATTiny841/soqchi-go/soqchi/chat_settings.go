@@ -0,0 +1,22 @@
+package soqchi
+
+import "time"
+
+// ChatSettings je nastavení Telegram chatu společné pro všechna zařízení - jazyk a časová zóna zpráv
+type ChatSettings struct {
+	ChatID int64
+	// Lang je jazyk zpráv (např. "cs"), prázdný znamená výchozí jazyk
+	Lang string
+	// TimeZone je časová zóna (IANA název) časů ve zprávách, prázdná znamená časovou zónu zařízení
+	TimeZone string
+}
+
+// Location vrací časovou zónu chatu, není-li nastavena (nebo je neplatná), pak def
+func (s *ChatSettings) Location(def *time.Location) *time.Location {
+	if s != nil && s.TimeZone != "" {
+		if loc, err := time.LoadLocation(s.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return def
+}
@@ -1,6 +1,18 @@
 package soqchi
 
+import "time"
+
+// výchozí limity pro zařízení, která nemají vlastní nastavení (viz Thresholds)
 const (
+	// VoltageLimit je napětí baterie, pod kterým watchdog upozorní na nízké napětí
 	VoltageLimit float64 = 2.5
-
+	// VoltageCritical je napětí baterie, pod kterým hrozí výpadek zařízení
+	VoltageCritical float64 = 2.3
+	// HeartbeatInterval je interval, ve kterém zařízení posílá heartbeat
+	HeartbeatInterval = 24 * time.Hour
+	// HeartbeatGrace je tolerance zpoždění heartbeatu - zařízení nemá Real Time Clock obvod
+	HeartbeatGrace = time.Hour
+	// TempHysteresis je hystereze teplotních upozornění ve °C - upozornění skončí, až se teplota
+	// vrátí o hysterezi zpět do povoleného rozsahu
+	TempHysteresis = 1.0
 )
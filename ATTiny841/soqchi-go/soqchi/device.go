@@ -7,10 +7,91 @@ type Device struct {
 	Name string
 	Voltage float64
 	AccessAllowed bool
+	// AccessAllowedUntil je čas, kdy vyprší povolený přístup - nulový čas znamená bez omezení
+	AccessAllowedUntil time.Time
+	// AccessWindows je týdenní rozvrh oken, kdy je přístup očekávaný
+	AccessWindows AccessSchedule
+	// TimeZone je časová zóna zařízení (IANA název), prázdná znamená Europe/Prague
+	TimeZone string
+	// OwnerChatID je chat vlastníka zařízení, který schvaluje přihlášení dalších uživatelů
+	OwnerChatID int64
+	// Thresholds jsou limity pro watchdog, nenastavené hodnoty se berou z globálních výchozích
+	Thresholds Thresholds
 	LastMessageAt time.Time
 	LastHeartbeatAt time.Time
 }
 
+// AccessEnabled vrací, zda je v čase at povolen přístup (zařízení nemá spouštět externí alarm) -
+// buď je přístup povolen ručně, nebo čas spadá do některého okna očekávaného přístupu
+func (d *Device) AccessEnabled(at time.Time) bool {
+	if d.AccessAllowed && (d.AccessAllowedUntil.IsZero() || at.Before(d.AccessAllowedUntil)) {
+		return true
+	}
+	_, ok := d.ExpectedEntry(at)
+	return ok
+}
+
+// ExpectedEntry vrací okno očekávaného přístupu, do kterého spadá čas at
+func (d *Device) ExpectedEntry(at time.Time) (AccessWindow, bool) {
+	return d.AccessWindows.Contains(at.In(d.Location()))
+}
+
+// Location vrací časovou zónu zařízení
+func (d *Device) Location() *time.Location {
+	if d.TimeZone != "" {
+		if loc, err := time.LoadLocation(d.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return TZ
+}
+
+// Health je stav zařízení tak, jak ho vyhodnocuje watchdog
+type Health int
+
+const (
+	Healthy Health = iota
+	// NoHeartbeat - zařízení dosud neposlalo žádný heartbeat
+	NoHeartbeat
+	// HeartbeatMissing - zařízení se neozvalo heartbeatem déle než je povoleno
+	HeartbeatMissing
+	// LowVoltage - napětí baterie kleslo pod limit nízkého napětí
+	LowVoltage
+	// CriticalVoltage - napětí baterie kleslo pod kritický limit, hrozí výpadek
+	CriticalVoltage
+)
+
+// String vrací název stavu, např. "low_voltage" - texty pro uživatele jsou v šablonách (šablona "health")
+func (h Health) String() string {
+	switch h {
+	case NoHeartbeat:
+		return "no_heartbeat"
+	case HeartbeatMissing:
+		return "heartbeat_missing"
+	case LowVoltage:
+		return "low_voltage"
+	case CriticalVoltage:
+		return "critical_voltage"
+	}
+	return "healthy"
+}
+
+// Health vyhodnotí stav zařízení v čase now podle jeho limitů
+func (d *Device) Health(now time.Time) Health {
+	t := d.Thresholds.WithDefaults()
+	switch {
+	case d.LastHeartbeatAt.IsZero():
+		return NoHeartbeat
+	case d.LastHeartbeatAt.Before(now.Add(-t.HeartbeatWindow())):
+		return HeartbeatMissing
+	case d.Voltage < t.VoltageCritical:
+		return CriticalVoltage
+	case d.Voltage < t.VoltageLow:
+		return LowVoltage
+	}
+	return Healthy
+}
+
 type Heartbeat struct {
 	At time.Time
 	Voltage, Temperature float64
@@ -18,6 +99,31 @@ type Heartbeat struct {
 
 type Heartbeats []Heartbeat
 
+// Reverse obrátí pořadí heartbeatů
+func (h Heartbeats) Reverse() {
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+}
+
 type DeviceInfo struct {
 	 HeartBeats Heartbeats
-}
\ No newline at end of file
+}
+
+// UnclaimedDevice je neznámé zařízení, které posílá zprávy, ale není v evidenci zařízení
+type UnclaimedDevice struct {
+	ID          string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	Count       int
+	LastRaw     string
+}
+
+// Chat je Telegram chat přihlášený k odběru zpráv ze zařízení
+type Chat struct {
+	ID        int64
+	Username  string
+	CreatedAt time.Time
+	// Pending je žádost o přihlášení, kterou ještě neschválil vlastník - takový chat nedostává zprávy
+	Pending bool
+}
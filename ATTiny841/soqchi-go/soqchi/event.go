@@ -0,0 +1,185 @@
+package soqchi
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventTopic je topic, do kterého se publikují události zařízení
+const EventTopic = "DeviceEvents"
+
+// EventVersion je verze obálky a dat událostí. Zvyšuje se při nekompatibilní změně - spotřebitel
+// událost vyšší verze, než zná, přeskočí.
+const EventVersion = 1
+
+// EventType je typ události zařízení, určuje tvar dat v obálce
+type EventType string
+
+const (
+	// EventDoorAlarm - otevření dveří (data DoorAlarm)
+	EventDoorAlarm EventType = "door_alarm"
+	// EventDoorOpen - info zpráva, dveře zůstávají otevřené (data Readings)
+	EventDoorOpen EventType = "door_open"
+	// EventDoorClosed - info zpráva, dveře jsou zavřené (data Readings)
+	EventDoorClosed EventType = "door_closed"
+	// EventHeartbeat - pravidelný heartbeat s napětím a teplotou (data Readings)
+	EventHeartbeat EventType = "heartbeat"
+	// EventDeviceSilent - zařízení se neozývá nebo se opět ozvalo (data DeviceSilent)
+	EventDeviceSilent EventType = "device_silent"
+	// EventLowBattery - nízké či kritické napětí baterie nebo jeho odhadovaný pokles (data LowBattery)
+	EventLowBattery EventType = "low_battery"
+	// EventTemperature - teplota mimo povolený rozsah nebo její návrat (data Temperature)
+	EventTemperature EventType = "temperature"
+	// EventFramesLost - zprávy ztracené od minulé kontroly watchdogem (data FramesLost)
+	EventFramesLost EventType = "frames_lost"
+	// EventAccessChanged - zastřežení, odstřežení nebo dočasné povolení přístupu (data AccessChanged)
+	EventAccessChanged EventType = "access_changed"
+	// EventScheduleChanged - změna rozvrhu očekávaného přístupu (data ScheduleChanged)
+	EventScheduleChanged EventType = "schedule_changed"
+	// EventLimitsChanged - změna limitu zařízení (data LimitsChanged)
+	EventLimitsChanged EventType = "limits_changed"
+	// EventSubscriptionChanged - přidání či zrušení odběru zpráv v dalším kanálu (data SubscriptionChanged)
+	EventSubscriptionChanged EventType = "subscription_changed"
+	// EventDeviceUnclaimed - první zpráva ze zařízení, které není v evidenci (data DeviceUnclaimed).
+	// Dostávají ji jen administrátoři.
+	EventDeviceUnclaimed EventType = "device_unclaimed"
+)
+
+// Event je obálka události zařízení
+type Event struct {
+	Version  int             `json:"version"`
+	Type     EventType       `json:"type"`
+	DeviceID string          `json:"deviceID"`
+	At       time.Time       `json:"at"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// NewEvent vytvoří obálku události aktuální verze s daty data
+func NewEvent(t EventType, deviceID string, at time.Time, data interface{}) (*Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal %s event data: %w", t, err)
+	}
+	return &Event{
+		Version:  EventVersion,
+		Type:     t,
+		DeviceID: deviceID,
+		At:       at,
+		Data:     raw,
+	}, nil
+}
+
+// Decode dekóduje data události do v
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("can't decode %s event data: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Readings jsou hodnoty naměřené zařízením - data událostí EventHeartbeat, EventDoorOpen a EventDoorClosed
+type Readings struct {
+	Voltage     float64 `json:"voltage"`
+	Temperature float64 `json:"temperature"`
+}
+
+// DoorAlarm jsou data události EventDoorAlarm. Window je okno rozvrhu, pokud jde o očekávaný vstup.
+type DoorAlarm struct {
+	Window *AccessWindow `json:"window,omitempty"`
+}
+
+// Alert je společná část dat událostí o změně stavu upozornění
+type Alert struct {
+	Condition AlertCondition  `json:"condition,omitempty"`
+	State     AlertTransition `json:"state"`
+	// Since je čas, od kdy podmínka platí
+	Since time.Time `json:"since"`
+}
+
+// Resolved vrací true, pokud podmínka přestala platit
+func (a Alert) Resolved() bool {
+	return a.State == AlertResolved
+}
+
+// Reminder vrací true, pokud jde o připomínku trvající podmínky
+func (a Alert) Reminder() bool {
+	return a.State == AlertReminder
+}
+
+// DeviceSilent jsou data události EventDeviceSilent (podmínky AlertNoHeartbeat a AlertHeartbeatMissing)
+type DeviceSilent struct {
+	Alert
+	LastMessageAt time.Time `json:"lastMessageAt"`
+	// Voltage je napětí z heartbeatu, kterým se zařízení opět ozvalo, jinak 0
+	Voltage float64 `json:"voltage,omitempty"`
+}
+
+// LowBattery jsou data události EventLowBattery (podmínky AlertLowVoltage, AlertCriticalVoltage
+// a AlertBatteryForecast)
+type LowBattery struct {
+	Alert
+	Voltage float64 `json:"voltage"`
+	// Limit je limit napětí, LimitAt a DaysLeft odhad, kdy pod něj napětí klesne (jen AlertBatteryForecast)
+	Limit    float64   `json:"limit"`
+	LimitAt  time.Time `json:"limitAt"`
+	DaysLeft int       `json:"daysLeft,omitempty"`
+	// WarnDays je počet dní, kolik předem se na odhadovaný pokles upozorňuje
+	WarnDays int `json:"warnDays,omitempty"`
+}
+
+// Temperature jsou data události EventTemperature (podmínky AlertTempLow a AlertTempHigh)
+type Temperature struct {
+	Alert
+	Temperature float64 `json:"temperature"`
+	Limit       float64 `json:"limit"`
+}
+
+// FramesLost jsou data události EventFramesLost
+type FramesLost struct {
+	Lost int `json:"lost"`
+	// Since je začátek období, za které se ztracené zprávy počítaly
+	Since time.Time `json:"since"`
+}
+
+// AccessChanged jsou data události EventAccessChanged. Nepovolený přístup znamená zastřeženo,
+// povolený s Until dočasné povolení, bez Until odstřeženo.
+type AccessChanged struct {
+	Allowed bool      `json:"allowed"`
+	Until   time.Time `json:"until"`
+	// By je uživatel, který přístup změnil
+	By string `json:"by,omitempty"`
+}
+
+// ScheduleChanged jsou data události EventScheduleChanged. Window je přidané (Added) nebo odebrané
+// okno rozvrhu, bez okna byl smazán celý rozvrh.
+type ScheduleChanged struct {
+	Window *AccessWindow `json:"window,omitempty"`
+	Added  bool          `json:"added,omitempty"`
+	// By je uživatel, který rozvrh změnil
+	By string `json:"by,omitempty"`
+}
+
+// LimitsChanged jsou data události EventLimitsChanged. Value je nová hodnota limitu s jednotkou
+// (např. "3.30 V"), prázdná znamená, že se hodnota nekontroluje. Default značí výchozí hodnotu.
+type LimitsChanged struct {
+	Limit   string `json:"limit"`
+	Value   string `json:"value,omitempty"`
+	Default bool   `json:"default,omitempty"`
+	// By je uživatel, který limit změnil
+	By string `json:"by,omitempty"`
+}
+
+// SubscriptionChanged jsou data události EventSubscriptionChanged, Added rozlišuje přidání a zrušení
+type SubscriptionChanged struct {
+	Channel Channel `json:"channel"`
+	Address string  `json:"address"`
+	Added   bool    `json:"added,omitempty"`
+	// By je uživatel, který odběr změnil
+	By string `json:"by,omitempty"`
+}
+
+// DeviceUnclaimed jsou data události EventDeviceUnclaimed, Raw jsou data zprávy v hexadecimálním tvaru
+type DeviceUnclaimed struct {
+	Raw string `json:"raw"`
+}
@@ -0,0 +1,48 @@
+package soqchi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventEnvelope(t *testing.T) {
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, TZ)
+	e, err := NewEvent(EventLowBattery, "ABC", at, LowBattery{
+		Alert:   Alert{Condition: AlertCriticalVoltage, State: AlertReminder, Since: at.AddDate(0, 0, -1)},
+		Voltage: 2.2,
+		Limit:   2.3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{`"version":1`, `"type":"low_battery"`, `"deviceID":"ABC"`, `"condition":"critical_voltage"`,
+		`"state":"reminder"`} {
+		if !strings.Contains(string(raw), exp) {
+			t.Errorf("%s does not contain %s", raw, exp)
+		}
+	}
+
+	var decoded Event
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var d LowBattery
+	if err := decoded.Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Condition != AlertCriticalVoltage || d.State != AlertReminder || d.Voltage != 2.2 || !d.Since.Equal(at.AddDate(0, 0, -1)) {
+		t.Errorf("unexpected data %#v", d)
+	}
+
+	var bad Alert
+	if err := json.Unmarshal([]byte(`{"state":"exploded"}`), &bad); err == nil {
+		t.Error("expected error for unknown alert transition")
+	}
+}
@@ -0,0 +1,48 @@
+package soqchi
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// inviteAlphabet neobsahuje snadno zaměnitelné znaky (0/O, 1/I/L)
+const inviteAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// inviteCodeLen je délka kódu pozvánky
+const inviteCodeLen = 8
+
+// Invite je jednorázová pozvánka k odběru zpráv ze zařízení
+type Invite struct {
+	Code      string
+	DeviceID  string
+	CreatedBy int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedBy a UsedByName jsou chat a uživatel, který pozvánku uplatnil, nulový UsedAt znamená nepoužitá
+	UsedBy     int64
+	UsedByName string
+	UsedAt     time.Time
+	// RevokedAt je čas zrušení pozvánky, nulový znamená nezrušená
+	RevokedAt time.Time
+}
+
+// Valid vrací true, pokud lze pozvánku v čase at uplatnit
+func (i *Invite) Valid(at time.Time) bool {
+	return i.UsedAt.IsZero() && i.RevokedAt.IsZero() && at.Before(i.ExpiresAt)
+}
+
+// NewInviteCode vygeneruje náhodný kód pozvánky, všechny znaky abecedy jsou stejně pravděpodobné
+func NewInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeLen)
+	max := big.NewInt(int64(len(inviteAlphabet)))
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("can't generate invite code: %w", err)
+		}
+		buf[i] = inviteAlphabet[n.Int64()]
+	}
+	return string(buf), nil
+}
@@ -1,6 +1,8 @@
 package soqchi
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -21,9 +23,40 @@ type Message struct {
 	DeviceID string    `json:"deviceID"`
 	At       time.Time `json:"receivedAt"`
 	Ack      bool      `json:"ack"`
+	Raw      string    `json:"raw"`
 	Flags    byte      `json:"flags"`
 	Voltage  float64   `json:"voltage,omitempty"`
 	Temp     float64   `json:"temp,omitempty"`
+
+	// verze formátu payloadu a údaje, které posílá jen firmware s binárním formátem (V2)
+	Version       int `json:"version,omitempty"`
+	Firmware      int `json:"firmware,omitempty"`
+	BootCount     int `json:"bootCount,omitempty"`
+	DoorOpenCount int `json:"doorOpenCount,omitempty"`
+
+	// nepovinná rádiová metadata ze Sigfox backendu
+	SeqNumber   *int    `json:"seqNumber,omitempty"`
+	RSSI        float64 `json:"rssi,omitempty"`
+	SNR         float64 `json:"snr,omitempty"`
+	AvgSNR      float64 `json:"avgSnr,omitempty"`
+	Station     string  `json:"station,omitempty"`
+	LinkQuality string  `json:"linkQuality,omitempty"`
+}
+
+// LoggedMessage je zpráva uložená v historii zpráv zařízení
+type LoggedMessage struct {
+	Message
+	// Downlink je hexa odpověď zaslaná do zařízení, prázdná, pokud zařízení odpověď nežádalo
+	Downlink string `json:"downlink,omitempty"`
+}
+
+// FrameKey identifikuje frame ze zařízení pro odhalení duplicit - stejný frame má stejný čas
+// i obsah (resp. sekvenční číslo), ať ho Sigfox doručí z kterékoliv základnové stanice
+func (m *Message) FrameKey() string {
+	if m.SeqNumber != nil {
+		return fmt.Sprintf("%d-s%d", m.At.Unix(), *m.SeqNumber)
+	}
+	return fmt.Sprintf("%d-%s", m.At.Unix(), strings.ToLower(m.Raw))
 }
 
 func (m *Message) Alarm() bool {
@@ -38,6 +71,12 @@ func (m *Message) Hartbeat() bool {
 	return m.Flags&flgHartbeat != 0
 }
 
+// HasReadings vrací true, pokud zpráva nese naměřené hodnoty - alarm bez dat ani nečitelný payload
+// je nemají a jejich napětí je nulové
+func (m *Message) HasReadings() bool {
+	return m.Voltage > 0
+}
+
 func (m *Message) DoorOpen() bool {
 
 	return m.Flags&flgDoorOpen != 0
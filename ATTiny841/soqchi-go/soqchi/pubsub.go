@@ -8,4 +8,7 @@ const (
 type PlainMessage struct {
 	Chats   []int64 `json:"chats"`
 	Message string  `json:"message"`
+	// DeviceID je zařízení, kterého se zpráva týká - zpráva se pak doručí i jeho odběratelům
+	// v dalších kanálech (e-mail, webhook, ntfy)
+	DeviceID string `json:"deviceID,omitempty"`
 }
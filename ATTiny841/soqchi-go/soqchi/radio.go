@@ -0,0 +1,75 @@
+package soqchi
+
+import "time"
+
+const (
+	// seqModulo - Sigfox sekvenční číslo je 12bitové a po 4095 přetéká na 0
+	seqModulo = 4096
+
+	// seqResetGap - větší mezera v sekvenčních číslech znamená spíš restart zařízení
+	// (číslování začne znovu od nuly) než ztracené zprávy
+	seqResetGap = 100
+)
+
+// LostFrames spočítá zprávy ztracené mezi zprávami msgs (seřazenými od nejstarší) podle mezer
+// v sekvenčních číslech. Zprávy bez sekvenčního čísla se ignorují.
+func LostFrames(msgs []LoggedMessage) int {
+	return LostFramesSince(msgs, time.Time{})
+}
+
+// LostFramesSince spočítá zprávy ztracené jako LostFrames, ale jen v mezerách před zprávami přijatými
+// od from - starší zprávy slouží jen k odhalení mezery hned na začátku období.
+func LostFramesSince(msgs []LoggedMessage, from time.Time) int {
+	var (
+		lost int
+		prev *int
+	)
+	for i := range msgs {
+		seq := msgs[i].SeqNumber
+		if seq == nil {
+			continue
+		}
+		if prev != nil && *seq != *prev && !msgs[i].At.Before(from) {
+			gap := ((*seq-*prev)%seqModulo+seqModulo)%seqModulo - 1
+			if gap < seqResetGap {
+				lost += gap
+			}
+		}
+		prev = seq
+	}
+	return lost
+}
+
+// SignalQuality je souhrn kvality rádiového spojení ze zpráv zařízení
+type SignalQuality struct {
+	// Last je poslední zpráva s rádiovými metadaty
+	Last *LoggedMessage
+	// Messages je počet zpráv s rádiovými metadaty
+	Messages        int
+	AvgRSSI, AvgSNR float64
+	MinRSSI         float64
+	LostFrames      int
+}
+
+// Signal spočítá souhrn kvality spojení ze zpráv msgs (seřazených od nejstarší)
+func Signal(msgs []LoggedMessage) SignalQuality {
+	q := SignalQuality{LostFrames: LostFrames(msgs)}
+	for i := range msgs {
+		m := &msgs[i]
+		if m.RSSI == 0 {
+			continue
+		}
+		if q.Messages == 0 || m.RSSI < q.MinRSSI {
+			q.MinRSSI = m.RSSI
+		}
+		q.Messages++
+		q.AvgRSSI += m.RSSI
+		q.AvgSNR += m.SNR
+		q.Last = m
+	}
+	if q.Messages > 0 {
+		q.AvgRSSI /= float64(q.Messages)
+		q.AvgSNR /= float64(q.Messages)
+	}
+	return q
+}
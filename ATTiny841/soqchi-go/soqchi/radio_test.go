@@ -0,0 +1,50 @@
+package soqchi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLostFrames(t *testing.T) {
+	seqs := func(nums ...int) []LoggedMessage {
+		var msgs []LoggedMessage
+		for i := range nums {
+			if nums[i] < 0 {
+				msgs = append(msgs, LoggedMessage{})
+				continue
+			}
+			msgs = append(msgs, LoggedMessage{Message: Message{SeqNumber: &nums[i]}})
+		}
+		return msgs
+	}
+
+	tests := []struct {
+		name string
+		msgs []LoggedMessage
+		exp  int
+	}{
+		{"empty", nil, 0},
+		{"continuous", seqs(10, 11, 12), 0},
+		{"gap", seqs(10, 13, 14), 2},
+		{"duplicate", seqs(10, 10, 11), 0},
+		{"without sequence", seqs(10, -1, 12), 1},
+		{"overflow", seqs(4094, 4095, 1), 1},
+		{"reset", seqs(1500, 0, 1), 0},
+	}
+
+	for _, tc := range tests {
+		if got := LostFrames(tc.msgs); got != tc.exp {
+			t.Errorf("%s: expected %d lost frames, got %d", tc.name, tc.exp, got)
+		}
+	}
+
+	// mezera před from se nepočítá, mezera hned po from ano
+	at := time.Date(2022, 2, 20, 10, 0, 0, 0, TZ)
+	msgs := seqs(10, 13, 15, 16)
+	for i := range msgs {
+		msgs[i].At = at.Add(time.Duration(i) * time.Hour)
+	}
+	if got := LostFramesSince(msgs, at.Add(2*time.Hour)); got != 1 {
+		t.Errorf("expected 1 lost frame since from, got %d", got)
+	}
+}
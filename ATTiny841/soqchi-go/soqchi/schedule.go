@@ -0,0 +1,108 @@
+package soqchi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessWindow je pravidelné týdenní okno, kdy je přístup očekávaný (např. úklid v úterý 9-12).
+// Čas je v minutách od půlnoci v časové zóně zařízení, okno je <From, To).
+type AccessWindow struct {
+	Weekday time.Weekday `json:"weekday"`
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+	Note    string       `json:"note,omitempty"`
+}
+
+// AccessSchedule je týdenní rozvrh oken s očekávaným přístupem
+type AccessSchedule []AccessWindow
+
+var weekdayNames = map[string]time.Weekday{
+	"ne": time.Sunday, "po": time.Monday, "út": time.Tuesday, "ut": time.Tuesday, "st": time.Wednesday,
+	"čt": time.Thursday, "ct": time.Thursday, "pá": time.Friday, "pa": time.Friday, "so": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var weekdayAbbr = [...]string{"ne", "po", "út", "st", "čt", "pá", "so"}
+
+// ParseAccessWindow rozparsuje okno ve tvaru "út 9:00-12:00 [poznámka]"
+func ParseAccessWindow(s string) (AccessWindow, error) {
+	parts := strings.Fields(s)
+	if len(parts) < 2 {
+		return AccessWindow{}, fmt.Errorf("expected \"<day> <from>-<to> [note]\", got %q", s)
+	}
+
+	day, ok := weekdayNames[strings.ToLower(parts[0])]
+	if !ok {
+		return AccessWindow{}, fmt.Errorf("unknown day %q", parts[0])
+	}
+
+	rng := strings.SplitN(parts[1], "-", 2)
+	if len(rng) != 2 {
+		return AccessWindow{}, fmt.Errorf("invalid time range %q", parts[1])
+	}
+	from, err := parseClock(rng[0])
+	if err != nil {
+		return AccessWindow{}, err
+	}
+	to, err := parseClock(rng[1])
+	if err != nil {
+		return AccessWindow{}, err
+	}
+	if from >= to {
+		return AccessWindow{}, fmt.Errorf("time range %q must not be empty or cross midnight", parts[1])
+	}
+
+	return AccessWindow{
+		Weekday: day,
+		From:    from,
+		To:      to,
+		Note:    strings.Join(parts[2:], " "),
+	}, nil
+}
+
+// parseClock převede "9", "9:30" nebo "24:00" na minuty od půlnoci
+func parseClock(s string) (int, error) {
+	hm := strings.SplitN(s, ":", 2)
+	h, err := strconv.Atoi(hm[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var m int
+	if len(hm) == 2 {
+		if m, err = strconv.Atoi(hm[1]); err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w AccessWindow) String() string {
+	s := weekdayAbbr[w.Weekday] + " " + w.Hours()
+	if w.Note != "" {
+		s += " " + w.Note
+	}
+	return s
+}
+
+// Hours vrací časový rozsah okna bez dne v týdnu, např. "8:00-17:30"
+func (w AccessWindow) Hours() string {
+	return fmt.Sprintf("%d:%02d-%d:%02d", w.From/60, w.From%60, w.To/60, w.To%60)
+}
+
+// Contains vrací okno, do kterého spadá čas t (v časové zóně, ve které je t zadán)
+func (s AccessSchedule) Contains(t time.Time) (AccessWindow, bool) {
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range s {
+		if w.Weekday == t.Weekday() && m >= w.From && m < w.To {
+			return w, true
+		}
+	}
+	return AccessWindow{}, false
+}
@@ -0,0 +1,55 @@
+package soqchi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAccessWindow(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp AccessWindow
+		err bool
+	}{
+		{in: "út 9:00-12:00 uklízečka", exp: AccessWindow{Weekday: time.Tuesday, From: 540, To: 720, Note: "uklízečka"}},
+		{in: "Sat 8-24", exp: AccessWindow{Weekday: time.Saturday, From: 480, To: 1440}},
+		{in: "po 12:00-9:00", err: true},
+		{in: "xx 9-12", err: true},
+		{in: "po 9:60-12", err: true},
+		{in: "po", err: true},
+	}
+
+	for _, tc := range tests {
+		w, err := ParseAccessWindow(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.in)
+			}
+			continue
+		}
+		if err != nil || w != tc.exp {
+			t.Errorf("%q: expected %+v, got %+v (%v)", tc.in, tc.exp, w, err)
+		}
+	}
+}
+
+func TestDeviceAccessEnabled(t *testing.T) {
+	d := &Device{AccessWindows: AccessSchedule{{Weekday: time.Tuesday, From: 540, To: 720}}}
+
+	// 22.2.2022 je úterý, okno je v čase Europe/Prague
+	tests := []struct {
+		at  time.Time
+		exp bool
+	}{
+		{time.Date(2022, 2, 22, 9, 0, 0, 0, TZ), true},
+		{time.Date(2022, 2, 22, 11, 59, 0, 0, TZ), true},
+		{time.Date(2022, 2, 22, 12, 0, 0, 0, TZ), false},
+		{time.Date(2022, 2, 22, 8, 30, 0, 0, time.UTC), true},
+		{time.Date(2022, 2, 23, 10, 0, 0, 0, TZ), false},
+	}
+	for _, tc := range tests {
+		if got := d.AccessEnabled(tc.at); got != tc.exp {
+			t.Errorf("%s: expected %v, got %v", tc.at, tc.exp, got)
+		}
+	}
+}
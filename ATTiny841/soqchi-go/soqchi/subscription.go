@@ -0,0 +1,123 @@
+package soqchi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Channel je kanál, kterým se doručují zprávy ze zařízení
+type Channel string
+
+const (
+	// ChannelTelegram - zprávy do chatů přihlášených k zařízení, adresou je ID chatu
+	ChannelTelegram Channel = "telegram"
+	// ChannelEmail - e-mail přes SMTP, adresou je e-mailová adresa
+	ChannelEmail Channel = "email"
+	// ChannelWebhook - JSON POST na URL, adresou je URL
+	ChannelWebhook Channel = "webhook"
+	// ChannelNtfy - HTTP push ve stylu ntfy, adresou je téma na výchozím serveru nebo celá URL tématu
+	ChannelNtfy Channel = "ntfy"
+)
+
+// ntfyTopic je povolený název tématu ntfy
+var ntfyTopic = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+
+// webhookSecretLen je počet náhodných bajtů klíče podpisu webhooku
+const webhookSecretLen = 32
+
+// nonPublicNets jsou rozsahy adres, na které se webhooky a ntfy zprávy neposílají - adresy zadávají
+// uživatelé a funkce nesmí sloužit k přístupu do vnitřní sítě či k metadatům cloudu (169.254.169.254)
+var nonPublicNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// Subscription je odběr zpráv ze zařízení v jiném kanálu než Telegram - Telegram chaty se
+// přihlašují příkazem /register a eviduje je Chat
+type Subscription struct {
+	Channel Channel
+	Address string
+	// Secret je klíč podpisu požadavků webhooku, u ostatních kanálů je prázdný
+	Secret string
+	// CreatedBy je chat, který odběr přidal
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+func (s Subscription) String() string {
+	return fmt.Sprintf("%s %s", s.Channel, s.Address)
+}
+
+// ParseSubscription ověří adresu odběru v kanálu channel a vrací odběr bez CreatedBy a CreatedAt.
+// URL webhooku a ntfy musí vést na veřejnou adresu.
+func ParseSubscription(channel, address string) (Subscription, error) {
+	s := Subscription{Channel: Channel(channel), Address: address}
+	switch s.Channel {
+	case ChannelEmail:
+		a, err := mail.ParseAddress(address)
+		if err != nil || a.Address != address {
+			return Subscription{}, fmt.Errorf("invalid e-mail address %q", address)
+		}
+	case ChannelWebhook:
+		if !isPublicURL(address) {
+			return Subscription{}, fmt.Errorf("invalid webhook URL %q", address)
+		}
+	case ChannelNtfy:
+		if !ntfyTopic.MatchString(address) && !isPublicURL(address) {
+			return Subscription{}, fmt.Errorf("invalid ntfy topic %q", address)
+		}
+	default:
+		return Subscription{}, fmt.Errorf("unknown channel %q", channel)
+	}
+	return s, nil
+}
+
+// isPublicURL vrací true pro http(s) URL, jejíž server není zadán adresou ani jménem z vnitřní sítě.
+// Jméno se tu nepřekládá - adresu, na kterou vede, kontroluje notify až při připojení.
+func isPublicURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIP(ip)
+	}
+	// jména bez tečky (i číselná "2130706433") a jména vnitřní sítě (metadata.google.internal)
+	return strings.Contains(host, ".") && host != "localhost" && !strings.HasSuffix(host, ".localhost") &&
+		!strings.HasSuffix(host, ".internal") && !strings.HasSuffix(host, ".local")
+}
+
+// IsPublicIP vrací true, pokud ip není adresa vnitřní sítě, loopback, link-local ani multicast
+func IsPublicIP(ip net.IP) bool {
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewWebhookSecret vygeneruje náhodný klíč podpisu webhooku
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, webhookSecretLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("can't generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
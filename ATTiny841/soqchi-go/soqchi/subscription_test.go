@@ -0,0 +1,43 @@
+package soqchi
+
+import "testing"
+
+func TestParseSubscription(t *testing.T) {
+	tests := []struct {
+		channel, address string
+		ok               bool
+	}{
+		{"email", "babicka@example.com", true},
+		{"email", "Babička <babicka@example.com>", false},
+		{"email", "babicka", false},
+		{"webhook", "https://example.com/hook?k=1", true},
+		{"webhook", "ftp://example.com/hook", false},
+		{"webhook", "example.com/hook", false},
+		{"webhook", "http://169.254.169.254/computeMetadata/v1/", false},
+		{"webhook", "http://localhost:8080/hook", false},
+		{"webhook", "http://127.0.0.1/hook", false},
+		{"webhook", "http://10.0.0.5/hook", false},
+		{"webhook", "http://192.168.1.1/hook", false},
+		{"webhook", "http://[::1]/hook", false},
+		{"webhook", "http://[::ffff:10.0.0.1]/hook", false},
+		{"webhook", "http://metadata.google.internal/", false},
+		{"webhook", "http://2130706433/", false},
+		{"webhook", "https://93.184.216.34/hook", true},
+		{"ntfy", "chata-alarm_1", true},
+		{"ntfy", "https://ntfy.example.com/chata", true},
+		{"ntfy", "chata/alarm", false},
+		{"ntfy", "http://172.16.0.1/chata", false},
+		{"telegram", "42", false},
+		{"sms", "+420123456789", false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSubscription(tt.channel, tt.address)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %q: expected ok=%v, got error %v", tt.channel, tt.address, tt.ok, err)
+			continue
+		}
+		if tt.ok && (s.Channel != Channel(tt.channel) || s.Address != tt.address) {
+			t.Errorf("%s %q: unexpected subscription %#v", tt.channel, tt.address, s)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package soqchi
+
+import "time"
+
+// Thresholds jsou limity zařízení, podle kterých watchdog vyhodnocuje jeho stav. Nulové hodnoty
+// (u teplot nil) znamenají výchozí hodnotu - viz WithDefaults.
+type Thresholds struct {
+	// HeartbeatInterval je očekávaný interval mezi heartbeaty
+	HeartbeatInterval time.Duration
+	// HeartbeatGrace je tolerance zpoždění heartbeatu
+	HeartbeatGrace time.Duration
+	// VoltageLow je napětí, pod kterým se upozorní na nízké napětí baterie
+	VoltageLow float64
+	// VoltageCritical je napětí, pod kterým hrozí výpadek zařízení
+	VoltageCritical float64
+	// TempMin a TempMax je rozsah povolených teplot, nil znamená bez kontroly
+	TempMin *float64
+	TempMax *float64
+	// TempHysteresis je hystereze teplotních upozornění ve °C
+	TempHysteresis float64
+}
+
+// WithDefaults vrací limity, kde jsou nenastavené hodnoty nahrazeny globálními výchozími
+func (t Thresholds) WithDefaults() Thresholds {
+	if t.HeartbeatInterval <= 0 {
+		t.HeartbeatInterval = HeartbeatInterval
+	}
+	if t.HeartbeatGrace <= 0 {
+		t.HeartbeatGrace = HeartbeatGrace
+	}
+	if t.VoltageLow <= 0 {
+		t.VoltageLow = VoltageLimit
+	}
+	if t.VoltageCritical <= 0 {
+		t.VoltageCritical = VoltageCritical
+	}
+	if t.TempHysteresis <= 0 {
+		t.TempHysteresis = TempHysteresis
+	}
+	return t
+}
+
+// HeartbeatWindow je doba, během které se musí zařízení ozvat heartbeatem
+func (t Thresholds) HeartbeatWindow() time.Duration {
+	t = t.WithDefaults()
+	return t.HeartbeatInterval + t.HeartbeatGrace
+}
+
+// TemperatureLow vyhodnotí s hysterezí, zda je teplota temp příliš nízká. Upozornění začne platit pod
+// TempMin a skončí, až teplota vystoupí na TempMin + hystereze, firing je dosavadní stav upozornění.
+// Bez nastaveného TempMin vrací ok false.
+func (t Thresholds) TemperatureLow(temp float64, firing bool) (active, ok bool) {
+	if t.TempMin == nil {
+		return false, false
+	}
+	if firing {
+		return temp < *t.TempMin+t.WithDefaults().TempHysteresis, true
+	}
+	return temp < *t.TempMin, true
+}
+
+// TemperatureHigh vyhodnotí s hysterezí, zda je teplota temp příliš vysoká - obdoba TemperatureLow
+func (t Thresholds) TemperatureHigh(temp float64, firing bool) (active, ok bool) {
+	if t.TempMax == nil {
+		return false, false
+	}
+	if firing {
+		return temp > *t.TempMax-t.WithDefaults().TempHysteresis, true
+	}
+	return temp > *t.TempMax, true
+}
+
+// Copy vrací kopii limitů, která nesdílí ukazatele na teploty
+func (t Thresholds) Copy() Thresholds {
+	if t.TempMin != nil {
+		v := *t.TempMin
+		t.TempMin = &v
+	}
+	if t.TempMax != nil {
+		v := *t.TempMax
+		t.TempMax = &v
+	}
+	return t
+}
@@ -0,0 +1,72 @@
+package soqchi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceHealth(t *testing.T) {
+	now := time.Date(2022, 2, 20, 8, 0, 0, 0, TZ)
+	d := Device{LastHeartbeatAt: now.Add(-26 * time.Hour), Voltage: 3}
+	if h := d.Health(now); h != HeartbeatMissing {
+		t.Errorf("expected missing heartbeat with default window, got %s", h)
+	}
+
+	// zařízení s heartbeatem jednou za dva dny
+	d.Thresholds.HeartbeatInterval = 48 * time.Hour
+	if h := d.Health(now); h != Healthy {
+		t.Errorf("expected healthy device, got %s", h)
+	}
+
+	d.Voltage = 2.4
+	if h := d.Health(now); h != LowVoltage {
+		t.Errorf("expected low voltage, got %s", h)
+	}
+	d.Voltage = 2.2
+	if h := d.Health(now); h != CriticalVoltage {
+		t.Errorf("expected critical voltage, got %s", h)
+	}
+
+	// lithiový článek
+	d.Thresholds.VoltageLow, d.Thresholds.VoltageCritical, d.Voltage = 3.4, 3.2, 3.3
+	if h := d.Health(now); h != LowVoltage {
+		t.Errorf("expected low voltage for custom limit, got %s", h)
+	}
+}
+
+func TestThresholdsTemperature(t *testing.T) {
+	var th Thresholds
+	if _, ok := th.TemperatureLow(-40, false); ok {
+		t.Error("temperature without limits must not be evaluated")
+	}
+	min, max := 0.0, 30.0
+	th.TempMin, th.TempMax = &min, &max
+
+	// teplota kolísající kolem limitu nevyvolá opakovaná upozornění
+	firing := false
+	var changes int
+	for _, temp := range []float64{1, -0.5, 0.2, -0.1, 0.8, 1.2, 0.5} {
+		active, _ := th.TemperatureLow(temp, firing)
+		if active != firing {
+			changes++
+		}
+		firing = active
+	}
+	if changes != 2 || firing {
+		t.Errorf("expected alert fired and resolved once, got %d changes", changes)
+	}
+
+	th.TempHysteresis = 2
+	if active, _ := th.TemperatureHigh(28.5, true); !active {
+		t.Error("high temperature alert must hold within hysteresis")
+	}
+	if active, _ := th.TemperatureHigh(28.5, false); active {
+		t.Error("temperature under limit must not fire")
+	}
+
+	c := th.Copy()
+	*c.TempMin = 5
+	if *th.TempMin != 0 {
+		t.Error("copy must not share temperature limits")
+	}
+}
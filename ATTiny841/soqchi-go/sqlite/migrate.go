@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations obsahuje postupné změny schématu databáze. Verze schématu odpovídá počtu
+// provedených migrací - nové migrace se vždy jen přidávají na konec, existující se nemění.
+var migrations = []string{
+	// 1 - zařízení, chaty a heartbeaty (obdoba kolekcí ve Firestore)
+	`CREATE TABLE devices (
+		id                TEXT PRIMARY KEY,
+		name              TEXT NOT NULL DEFAULT '',
+		last_message_at   DATETIME,
+		last_heartbeat_at DATETIME,
+		access_allowed    BOOLEAN NOT NULL DEFAULT 0,
+		voltage           REAL NOT NULL DEFAULT 0
+	);
+	CREATE TABLE chats (
+		device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		chat_id    INTEGER NOT NULL,
+		username   TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (device_id, chat_id)
+	);
+	CREATE TABLE heartbeats (
+		device_id   TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		received_at DATETIME NOT NULL,
+		voltage     REAL NOT NULL,
+		temp        REAL NOT NULL,
+		PRIMARY KEY (device_id, received_at)
+	);`,
+
+	// 2 - historie všech zpráv ze zařízení
+	`CREATE TABLE messages (
+		device_id   TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		received_at DATETIME NOT NULL,
+		raw         TEXT NOT NULL,
+		flags       INTEGER NOT NULL,
+		ack         BOOLEAN NOT NULL,
+		voltage     REAL NOT NULL,
+		temp        REAL NOT NULL,
+		downlink    TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (device_id, received_at)
+	);`,
+
+	// 3 - evidence zpracovaných framů pro odhalení duplicit
+	`CREATE TABLE frames (
+		device_id   TEXT NOT NULL,
+		key         TEXT NOT NULL,
+		received_at DATETIME NOT NULL,
+		PRIMARY KEY (device_id, key)
+	);`,
+
+	// 4 - rádiová metadata zpráv
+	`ALTER TABLE messages ADD COLUMN seq_number INTEGER;
+	ALTER TABLE messages ADD COLUMN rssi REAL NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN snr REAL NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN avg_snr REAL NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN station TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN link_quality TEXT NOT NULL DEFAULT '';`,
+
+	// 5 - údaje z binárního formátu payloadu (V2)
+	`ALTER TABLE messages ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN firmware INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN boot_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN door_open_count INTEGER NOT NULL DEFAULT 0;`,
+
+	// 6 - neznámá zařízení
+	`CREATE TABLE unclaimed (
+		id            TEXT PRIMARY KEY,
+		first_seen_at DATETIME NOT NULL,
+		last_seen_at  DATETIME NOT NULL,
+		count         INTEGER NOT NULL,
+		last_raw      TEXT NOT NULL
+	);`,
+
+	// 7 - časově omezený povolený přístup
+	`ALTER TABLE devices ADD COLUMN access_allowed_until DATETIME;`,
+
+	// 8 - týdenní rozvrh očekávaného přístupu (JSON) a časová zóna zařízení
+	`ALTER TABLE devices ADD COLUMN access_windows TEXT NOT NULL DEFAULT '';
+	ALTER TABLE devices ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';`,
+
+	// 9 - vlastník zařízení a neschválené žádosti o přihlášení
+	`ALTER TABLE devices ADD COLUMN owner_chat_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chats ADD COLUMN pending BOOLEAN NOT NULL DEFAULT 0;`,
+
+	// 10 - jednorázové pozvánky k odběru zpráv
+	`CREATE TABLE invites (
+		code         TEXT PRIMARY KEY,
+		device_id    TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		created_by   INTEGER NOT NULL,
+		created_at   DATETIME NOT NULL,
+		expires_at   DATETIME NOT NULL,
+		used_by      INTEGER NOT NULL DEFAULT 0,
+		used_by_name TEXT NOT NULL DEFAULT '',
+		used_at      DATETIME,
+		revoked_at   DATETIME
+	);`,
+
+	// 11 - limity zařízení pro watchdog, nuly a NULL znamenají výchozí hodnoty
+	`ALTER TABLE devices ADD COLUMN heartbeat_interval INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE devices ADD COLUMN heartbeat_grace INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE devices ADD COLUMN voltage_low REAL NOT NULL DEFAULT 0;
+	ALTER TABLE devices ADD COLUMN voltage_critical REAL NOT NULL DEFAULT 0;
+	ALTER TABLE devices ADD COLUMN temp_min REAL;
+	ALTER TABLE devices ADD COLUMN temp_max REAL;`,
+
+	// 12 - stav upozornění watchdogu pro jednotlivé podmínky zařízení
+	`CREATE TABLE alerts (
+		device_id   TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		condition   TEXT NOT NULL,
+		firing      BOOLEAN NOT NULL,
+		since       DATETIME,
+		notified_at DATETIME,
+		resolved_at DATETIME,
+		PRIMARY KEY (device_id, condition)
+	);`,
+
+	// 13 - hystereze teplotních upozornění
+	`ALTER TABLE devices ADD COLUMN temp_hysteresis REAL NOT NULL DEFAULT 0;`,
+
+	// 14 - odběry zpráv ze zařízení v dalších kanálech (e-mail, webhook, ntfy)
+	`CREATE TABLE subscriptions (
+		device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+		channel    TEXT NOT NULL,
+		address    TEXT NOT NULL,
+		created_by INTEGER NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (device_id, channel, address)
+	);`,
+
+	// 15 - jazyk a časová zóna zpráv pro jednotlivé chaty
+	`CREATE TABLE chat_settings (
+		chat_id   INTEGER PRIMARY KEY,
+		lang      TEXT NOT NULL DEFAULT '',
+		time_zone TEXT NOT NULL DEFAULT ''
+	);`,
+
+	// 16 - klíč podpisu webhooku pro každý odběr, dříve přidané webhooky dostanou náhodný klíč
+	// (stejného formátu jako soqchi.NewWebhookSecret)
+	`ALTER TABLE subscriptions ADD COLUMN secret TEXT NOT NULL DEFAULT '';
+	UPDATE subscriptions SET secret = lower(hex(randomblob(32))) WHERE channel = 'webhook';`,
+}
+
+// migrate převede schéma databáze na poslední verzi. Každá migrace běží ve vlastní transakci.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("can't create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return fmt.Errorf("can't read schema version: %w", err)
+	}
+
+	for v := current; v < len(migrations); v++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?)`, v+1); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d commit failed: %w", v+1, err)
+		}
+	}
+	return nil
+}
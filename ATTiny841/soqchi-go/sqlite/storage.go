@@ -0,0 +1,677 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// heartbeatLimit odpovídá počtu posledních heartbeatů, které vrací firestore.Client.DeviceInfo
+const heartbeatLimit = 60
+
+// frameRetention odpovídá době, po kterou firestore drží evidenci framů (TTL ExpireAt)
+const frameRetention = 7 * 24 * time.Hour
+
+// Client je úložiště nad SQLite databází pro provoz mimo Google Cloud (např. Raspberry Pi)
+type Client struct {
+	db *sql.DB
+}
+
+// New otevře (případně založí) databázi v souboru path a převede její schéma na poslední verzi
+func New(ctx context.Context, path string) (*Client, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, fmt.Errorf("can't open sqlite database %s: %w", path, err)
+	}
+	// SQLite neumí souběžné zápisy, všechny operace tak jdou přes jediné spojení
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Client{db: db}, nil
+}
+
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+func (c *Client) AddUser(ctx context.Context, deviceID string, chatID int64, username string) error {
+	return addUser(ctx, c.db, deviceID, chatID, username, false)
+}
+
+func (c *Client) AddPendingUser(ctx context.Context, deviceID string, chatID int64, username string) error {
+	return addUser(ctx, c.db, deviceID, chatID, username, true)
+}
+
+func addUser(ctx context.Context, e execer, deviceID string, chatID int64, username string, pending bool) error {
+	_, err := e.ExecContext(ctx, `INSERT OR REPLACE INTO chats (device_id, chat_id, username, created_at, pending)
+		SELECT id, ?, ?, ?, ? FROM devices WHERE id = ?`, chatID, username, time.Now().UTC(), pending, deviceID)
+	return err
+}
+
+func (c *Client) ApproveUser(ctx context.Context, deviceID string, chatID int64) (bool, error) {
+	res, err := c.db.ExecContext(ctx, `UPDATE chats SET pending = 0 WHERE device_id = ? AND chat_id = ? AND pending`,
+		deviceID, chatID)
+	if err != nil {
+		return false, fmt.Errorf("can't approve chat %d for device %s: %w", chatID, deviceID, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (c *Client) RemoveUser(ctx context.Context, deviceID string, chatID int64) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chats WHERE device_id = ? AND chat_id = ?`, deviceID, chatID); err != nil {
+		return fmt.Errorf("can't remove chat %d of device %s: %w", chatID, deviceID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE devices SET owner_chat_id = 0 WHERE id = ? AND owner_chat_id = ?`, deviceID, chatID); err != nil {
+		return fmt.Errorf("can't remove chat %d of device %s: %w", chatID, deviceID, err)
+	}
+	return tx.Commit()
+}
+
+func (c *Client) ClaimOwnership(ctx context.Context, deviceID string, chatID int64, username string) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE devices SET owner_chat_id = ? WHERE id = ? AND owner_chat_id = 0
+		AND NOT EXISTS (SELECT 1 FROM chats WHERE device_id = devices.id AND NOT pending)`, chatID, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("can't claim ownership of device %s: %w", deviceID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := addUser(ctx, tx, deviceID, chatID, username, false); err != nil {
+		return false, fmt.Errorf("can't claim ownership of device %s: %w", deviceID, err)
+	}
+	return true, tx.Commit()
+}
+
+func (c *Client) SaveInvite(ctx context.Context, invite *soqchi.Invite) error {
+	_, err := c.db.ExecContext(ctx, `INSERT INTO invites (code, device_id, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, invite.Code, invite.DeviceID, invite.CreatedBy, invite.CreatedAt.UTC(), invite.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("can't save invite for device %s: %w", invite.DeviceID, err)
+	}
+	return nil
+}
+
+func (c *Client) Invite(ctx context.Context, code string) (*soqchi.Invite, error) {
+	inv, err := scanInvite(c.db.QueryRowContext(ctx, `SELECT `+inviteColumns+` FROM invites WHERE code = ?`, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return inv, err
+}
+
+func (c *Client) RedeemInvite(ctx context.Context, code string, chatID int64, username string, at time.Time) (*soqchi.Invite, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE invites SET used_by = ?, used_by_name = ?, used_at = ?
+		WHERE code = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?`,
+		chatID, username, at.UTC(), code, at.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("can't redeem invite: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+
+	inv, err := scanInvite(tx.QueryRowContext(ctx, `SELECT `+inviteColumns+` FROM invites WHERE code = ?`, code))
+	if err != nil {
+		return nil, fmt.Errorf("can't redeem invite: %w", err)
+	}
+	if err := addUser(ctx, tx, inv.DeviceID, chatID, username, false); err != nil {
+		return nil, fmt.Errorf("can't redeem invite: %w", err)
+	}
+	return inv, tx.Commit()
+}
+
+func (c *Client) RevokeInvite(ctx context.Context, code string, at time.Time) (bool, error) {
+	res, err := c.db.ExecContext(ctx, `UPDATE invites SET revoked_at = ? WHERE code = ? AND used_at IS NULL AND revoked_at IS NULL`,
+		at.UTC(), code)
+	if err != nil {
+		return false, fmt.Errorf("can't revoke invite: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (c *Client) Chat(ctx context.Context, deviceID string, chatID int64) (*soqchi.Chat, error) {
+	ch := soqchi.Chat{ID: chatID}
+	err := c.db.QueryRowContext(ctx, `SELECT username, created_at, pending FROM chats WHERE device_id = ? AND chat_id = ?`,
+		deviceID, chatID).Scan(&ch.Username, &ch.CreatedAt, &ch.Pending)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ch.CreatedAt = ch.CreatedAt.In(soqchi.TZ)
+	return &ch, nil
+}
+
+func (c *Client) Device(ctx context.Context, deviceID string) (*soqchi.Device, error) {
+	row := c.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = ?`, deviceID)
+	d, err := scanDevice(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (c *Client) AllDevices(ctx context.Context) ([]*soqchi.Device, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT `+deviceColumns+` FROM devices ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve devices: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*soqchi.Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+func (c *Client) SetAccess(ctx context.Context, deviceID string, allowed bool, until time.Time) error {
+	var u sql.NullTime
+	if !until.IsZero() {
+		u = sql.NullTime{Time: until.UTC(), Valid: true}
+	}
+	return updateDevice(ctx, c.db, deviceID, `access_allowed = ?, access_allowed_until = ?`, allowed, u)
+}
+
+func (c *Client) SetAccessWindows(ctx context.Context, deviceID string, windows soqchi.AccessSchedule) error {
+	var raw []byte
+	if len(windows) > 0 {
+		var err error
+		if raw, err = json.Marshal(windows); err != nil {
+			return err
+		}
+	}
+	return updateDevice(ctx, c.db, deviceID, `access_windows = ?`, string(raw))
+}
+
+func (c *Client) SetThresholds(ctx context.Context, deviceID string, t soqchi.Thresholds) error {
+	return updateDevice(ctx, c.db, deviceID, `heartbeat_interval = ?, heartbeat_grace = ?, voltage_low = ?,
+		voltage_critical = ?, temp_min = ?, temp_max = ?, temp_hysteresis = ?`,
+		int64(t.HeartbeatInterval/time.Second), int64(t.HeartbeatGrace/time.Second), t.VoltageLow, t.VoltageCritical,
+		nullFloat(t.TempMin), nullFloat(t.TempMax), t.TempHysteresis)
+}
+
+func nullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+func (c *Client) ChatDevices(ctx context.Context, chatID int64) ([]*soqchi.Device, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT `+deviceColumns+` FROM devices
+		WHERE id IN (SELECT device_id FROM chats WHERE chat_id = ? AND NOT pending) ORDER BY id`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve devices of chat %d: %w", chatID, err)
+	}
+	defer rows.Close()
+
+	var result []*soqchi.Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+func (c *Client) AllChats(ctx context.Context, deviceID string) ([]int64, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT chat_id FROM chats WHERE device_id = ? AND NOT pending ORDER BY chat_id`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve all chats failed: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("retrieve all chats failed: %w", err)
+		}
+		chats = append(chats, id)
+	}
+	return chats, rows.Err()
+}
+
+func (c *Client) SaveHeartbeat(ctx context.Context, deviceID string, t time.Time, voltage, temperature float64) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := updateDevice(ctx, tx, deviceID, `last_message_at = ?, last_heartbeat_at = ?, voltage = ?`, t.UTC(), t.UTC(), voltage); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO heartbeats (device_id, received_at, voltage, temp) VALUES (?, ?, ?, ?)`,
+		deviceID, t.UTC(), voltage, temperature)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Client) SaveTimestamp(ctx context.Context, deviceID string, t time.Time) error {
+	return updateDevice(ctx, c.db, deviceID, `last_message_at = ?`, t.UTC())
+}
+
+func (c *Client) RegisterFrame(ctx context.Context, deviceID, key string, at time.Time) (bool, error) {
+	// starší framy už duplicitou být nemohou, evidence by jinak rostla donekonečna
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM frames WHERE device_id = ? AND received_at < ?`,
+		deviceID, at.Add(-frameRetention).UTC()); err != nil {
+		return false, err
+	}
+	res, err := c.db.ExecContext(ctx, `INSERT OR IGNORE INTO frames (device_id, key, received_at) VALUES (?, ?, ?)`,
+		deviceID, key, at.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (c *Client) ReleaseFrame(ctx context.Context, deviceID, key string) error {
+	_, err := c.db.ExecContext(ctx, `DELETE FROM frames WHERE device_id = ? AND key = ?`, deviceID, key)
+	return err
+}
+
+func (c *Client) SaveUnclaimed(ctx context.Context, msg *soqchi.Message) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE unclaimed SET last_seen_at = ?, last_raw = ?, count = count + 1 WHERE id = ?`,
+		msg.At.UTC(), msg.Raw, msg.DeviceID)
+	if err != nil {
+		return false, fmt.Errorf("can't save unclaimed device %s: %w", msg.DeviceID, err)
+	}
+
+	var first bool
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		var firstSeen time.Time
+		if err := tx.QueryRowContext(ctx, `SELECT first_seen_at FROM unclaimed WHERE id = ?`, msg.DeviceID).Scan(&firstSeen); err != nil {
+			return false, fmt.Errorf("can't save unclaimed device %s: %w", msg.DeviceID, err)
+		}
+		first = firstSeen.Equal(msg.At)
+	} else {
+		first = true
+		_, err = tx.ExecContext(ctx, `INSERT INTO unclaimed (id, first_seen_at, last_seen_at, count, last_raw) VALUES (?, ?, ?, 1, ?)`,
+			msg.DeviceID, msg.At.UTC(), msg.At.UTC(), msg.Raw)
+		if err != nil {
+			return false, fmt.Errorf("can't save unclaimed device %s: %w", msg.DeviceID, err)
+		}
+	}
+	return first, tx.Commit()
+}
+
+func (c *Client) UnclaimedDevices(ctx context.Context) ([]*soqchi.UnclaimedDevice, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT id, first_seen_at, last_seen_at, count, last_raw FROM unclaimed ORDER BY last_seen_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve unclaimed devices: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*soqchi.UnclaimedDevice
+	for rows.Next() {
+		var u soqchi.UnclaimedDevice
+		if err := rows.Scan(&u.ID, &u.FirstSeenAt, &u.LastSeenAt, &u.Count, &u.LastRaw); err != nil {
+			return nil, err
+		}
+		u.FirstSeenAt = u.FirstSeenAt.In(soqchi.TZ)
+		u.LastSeenAt = u.LastSeenAt.In(soqchi.TZ)
+		result = append(result, &u)
+	}
+	return result, rows.Err()
+}
+
+func (c *Client) ClaimDevice(ctx context.Context, deviceID, name string) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO devices (id, name, last_message_at)
+		SELECT id, ?, last_seen_at FROM unclaimed WHERE id = ?`, name, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("can't claim device %s: %w", deviceID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM unclaimed WHERE id = ?`, deviceID); err != nil {
+		return false, fmt.Errorf("can't claim device %s: %w", deviceID, err)
+	}
+	return true, tx.Commit()
+}
+
+func (c *Client) SaveMessage(ctx context.Context, msg *soqchi.Message, downlink string) error {
+	var seq sql.NullInt64
+	if msg.SeqNumber != nil {
+		seq = sql.NullInt64{Int64: int64(*msg.SeqNumber), Valid: true}
+	}
+
+	_, err := c.db.ExecContext(ctx, `INSERT OR REPLACE INTO messages (device_id, received_at, raw, flags, ack, voltage, temp, downlink,
+		seq_number, rssi, snr, avg_snr, station, link_quality, version, firmware, boot_count, door_open_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.DeviceID, msg.At.UTC(), msg.Raw, msg.Flags, msg.Ack, msg.Voltage, msg.Temp, downlink,
+		seq, msg.RSSI, msg.SNR, msg.AvgSNR, msg.Station, msg.LinkQuality, msg.Version, msg.Firmware, msg.BootCount, msg.DoorOpenCount)
+	return err
+}
+
+func (c *Client) Messages(ctx context.Context, deviceID string, from, to time.Time) ([]soqchi.LoggedMessage, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT received_at, raw, flags, ack, voltage, temp, downlink,
+		seq_number, rssi, snr, avg_snr, station, link_quality, version, firmware, boot_count, door_open_count
+		FROM messages WHERE device_id = ? AND received_at >= ? AND received_at < ? ORDER BY received_at`, deviceID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("messages for (%s) failed: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var result []soqchi.LoggedMessage
+	for rows.Next() {
+		var (
+			m   = soqchi.LoggedMessage{Message: soqchi.Message{DeviceID: deviceID}}
+			seq sql.NullInt64
+		)
+		if err := rows.Scan(&m.At, &m.Raw, &m.Flags, &m.Ack, &m.Voltage, &m.Temp, &m.Downlink,
+			&seq, &m.RSSI, &m.SNR, &m.AvgSNR, &m.Station, &m.LinkQuality,
+			&m.Version, &m.Firmware, &m.BootCount, &m.DoorOpenCount); err != nil {
+			return nil, fmt.Errorf("message decoding failed: %w", err)
+		}
+		m.At = m.At.In(soqchi.TZ)
+		if seq.Valid {
+			n := int(seq.Int64)
+			m.SeqNumber = &n
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+func (c *Client) Heartbeats(ctx context.Context, deviceID string, from, to time.Time, limit int) (soqchi.Heartbeats, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := c.db.QueryContext(ctx, `SELECT received_at, voltage, temp FROM (
+			SELECT received_at, voltage, temp FROM heartbeats
+			WHERE device_id = ? AND received_at >= ? AND received_at < ? ORDER BY received_at DESC LIMIT ?
+		) ORDER BY received_at`, deviceID, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("heartbeats for (%s) failed: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var result soqchi.Heartbeats
+	for rows.Next() {
+		var h soqchi.Heartbeat
+		if err := rows.Scan(&h.At, &h.Voltage, &h.Temperature); err != nil {
+			return nil, fmt.Errorf("heartbeat decoding failed: %w", err)
+		}
+		h.At = h.At.In(soqchi.TZ)
+		result = append(result, h)
+	}
+	return result, rows.Err()
+}
+
+func (c *Client) AlertStates(ctx context.Context, deviceID string) ([]soqchi.AlertState, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT condition, firing, since, notified_at, resolved_at FROM alerts
+		WHERE device_id = ? ORDER BY condition`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("alert states of device %s failed: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var states []soqchi.AlertState
+	for rows.Next() {
+		var (
+			st                        soqchi.AlertState
+			since, notified, resolved sql.NullTime
+		)
+		if err := rows.Scan(&st.Condition, &st.Firing, &since, &notified, &resolved); err != nil {
+			return nil, fmt.Errorf("alert state decoding failed: %w", err)
+		}
+		st.Since = localTime(since)
+		st.NotifiedAt = localTime(notified)
+		st.ResolvedAt = localTime(resolved)
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+func (c *Client) SaveAlertState(ctx context.Context, deviceID string, state soqchi.AlertState) error {
+	_, err := c.db.ExecContext(ctx, `INSERT INTO alerts (device_id, condition, firing, since, notified_at, resolved_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (device_id, condition) DO UPDATE SET firing = excluded.firing, since = excluded.since,
+			notified_at = excluded.notified_at, resolved_at = excluded.resolved_at`,
+		deviceID, string(state.Condition), state.Firing, nullTime(state.Since), nullTime(state.NotifiedAt),
+		nullTime(state.ResolvedAt))
+	if err != nil {
+		return fmt.Errorf("can't save alert state %s of device %s: %w", state.Condition, deviceID, err)
+	}
+	return nil
+}
+
+func (c *Client) AddSubscription(ctx context.Context, deviceID string, sub soqchi.Subscription) error {
+	_, err := c.db.ExecContext(ctx, `INSERT INTO subscriptions (device_id, channel, address, secret, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (device_id, channel, address) DO UPDATE SET secret = excluded.secret,
+			created_by = excluded.created_by, created_at = excluded.created_at`,
+		deviceID, string(sub.Channel), sub.Address, sub.Secret, sub.CreatedBy, sub.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("can't add subscription %s to device %s: %w", sub, deviceID, err)
+	}
+	return nil
+}
+
+func (c *Client) RemoveSubscription(ctx context.Context, deviceID string, channel soqchi.Channel, address string) (bool, error) {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE device_id = ? AND channel = ? AND address = ?`,
+		deviceID, string(channel), address)
+	if err != nil {
+		return false, fmt.Errorf("can't remove subscription %s %s from device %s: %w", channel, address, deviceID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (c *Client) Subscriptions(ctx context.Context, deviceID string) ([]soqchi.Subscription, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT channel, address, secret, created_by, created_at FROM subscriptions
+		WHERE device_id = ? ORDER BY created_at`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("subscriptions of device %s failed: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var subs []soqchi.Subscription
+	for rows.Next() {
+		var s soqchi.Subscription
+		if err := rows.Scan(&s.Channel, &s.Address, &s.Secret, &s.CreatedBy, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("subscription decoding failed: %w", err)
+		}
+		s.CreatedAt = s.CreatedAt.In(soqchi.TZ)
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+func (c *Client) ChatSettings(ctx context.Context, chatID int64) (*soqchi.ChatSettings, error) {
+	s := soqchi.ChatSettings{ChatID: chatID}
+	err := c.db.QueryRowContext(ctx, `SELECT lang, time_zone FROM chat_settings WHERE chat_id = ?`, chatID).
+		Scan(&s.Lang, &s.TimeZone)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("settings of chat %d failed: %w", chatID, err)
+	}
+	return &s, nil
+}
+
+func (c *Client) SaveChatSettings(ctx context.Context, s soqchi.ChatSettings) error {
+	_, err := c.db.ExecContext(ctx, `INSERT INTO chat_settings (chat_id, lang, time_zone) VALUES (?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET lang = excluded.lang, time_zone = excluded.time_zone`,
+		s.ChatID, s.Lang, s.TimeZone)
+	if err != nil {
+		return fmt.Errorf("can't save settings of chat %d: %w", s.ChatID, err)
+	}
+	return nil
+}
+
+// nullTime převede čas do UTC, nulový čas ukládá jako NULL
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// localTime převede uložený čas do časové zóny soqchi.TZ, NULL na nulový čas
+func localTime(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return t.Time.In(soqchi.TZ)
+}
+
+func (c *Client) DeviceInfo(ctx context.Context, deviceID string) (*soqchi.DeviceInfo, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT received_at, voltage, temp FROM (
+			SELECT received_at, voltage, temp FROM heartbeats WHERE device_id = ? ORDER BY received_at DESC LIMIT ?
+		) ORDER BY received_at`, deviceID, heartbeatLimit)
+	if err != nil {
+		return nil, fmt.Errorf("heartbeats for (%s) failed: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var inf = soqchi.DeviceInfo{HeartBeats: soqchi.Heartbeats{}}
+	for rows.Next() {
+		var h soqchi.Heartbeat
+		if err := rows.Scan(&h.At, &h.Voltage, &h.Temperature); err != nil {
+			return nil, fmt.Errorf("heartbeat decoding failed: %w", err)
+		}
+		h.At = h.At.In(soqchi.TZ)
+		inf.HeartBeats = append(inf.HeartBeats, h)
+	}
+	return &inf, rows.Err()
+}
+
+const deviceColumns = `id, name, last_message_at, last_heartbeat_at, access_allowed, voltage, access_allowed_until,
+	access_windows, time_zone, owner_chat_id, heartbeat_interval, heartbeat_grace, voltage_low, voltage_critical,
+	temp_min, temp_max, temp_hysteresis`
+
+const inviteColumns = `code, device_id, created_by, created_at, expires_at, used_by, used_by_name, used_at, revoked_at`
+
+func scanInvite(s scanner) (*soqchi.Invite, error) {
+	var (
+		inv             soqchi.Invite
+		usedAt, revoked sql.NullTime
+	)
+	if err := s.Scan(&inv.Code, &inv.DeviceID, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt, &inv.UsedBy,
+		&inv.UsedByName, &usedAt, &revoked); err != nil {
+		return nil, err
+	}
+	inv.CreatedAt = inv.CreatedAt.In(soqchi.TZ)
+	inv.ExpiresAt = inv.ExpiresAt.In(soqchi.TZ)
+	if usedAt.Valid {
+		inv.UsedAt = usedAt.Time.In(soqchi.TZ)
+	}
+	if revoked.Valid {
+		inv.RevokedAt = revoked.Time.In(soqchi.TZ)
+	}
+	return &inv, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func scanDevice(s scanner) (*soqchi.Device, error) {
+	var (
+		d                 soqchi.Device
+		lastMsg, lastBeat sql.NullTime
+		accessUntil       sql.NullTime
+		windows           string
+		interval, grace   int64
+		tempMin, tempMax  sql.NullFloat64
+	)
+	if err := s.Scan(&d.ID, &d.Name, &lastMsg, &lastBeat, &d.AccessAllowed, &d.Voltage, &accessUntil,
+		&windows, &d.TimeZone, &d.OwnerChatID, &interval, &grace, &d.Thresholds.VoltageLow,
+		&d.Thresholds.VoltageCritical, &tempMin, &tempMax, &d.Thresholds.TempHysteresis); err != nil {
+		return nil, err
+	}
+	d.Thresholds.HeartbeatInterval = time.Duration(interval) * time.Second
+	d.Thresholds.HeartbeatGrace = time.Duration(grace) * time.Second
+	if tempMin.Valid {
+		d.Thresholds.TempMin = &tempMin.Float64
+	}
+	if tempMax.Valid {
+		d.Thresholds.TempMax = &tempMax.Float64
+	}
+	if windows != "" {
+		if err := json.Unmarshal([]byte(windows), &d.AccessWindows); err != nil {
+			return nil, fmt.Errorf("access windows of device %s: %w", d.ID, err)
+		}
+	}
+	d.AccessAllowedUntil = localTime(accessUntil)
+	d.LastMessageAt = localTime(lastMsg)
+	d.LastHeartbeatAt = localTime(lastBeat)
+	return &d, nil
+}
+
+// updateDevice aktualizuje sloupce zařízení a stejně jako Firestore vrací chybu, pokud zařízení neexistuje
+func updateDevice(ctx context.Context, e execer, deviceID string, set string, args ...interface{}) error {
+	res, err := e.ExecContext(ctx, `UPDATE devices SET `+set+` WHERE id = ?`, append(args, deviceID)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	return nil
+}
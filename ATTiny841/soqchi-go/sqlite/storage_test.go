@@ -0,0 +1,540 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := New(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	if _, err := c.db.Exec(`INSERT INTO devices (id, name) VALUES ('ABC', 'chata')`); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if err := migrate(ctx, c.db); err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if err := c.db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != len(migrations) {
+		t.Errorf("expected schema version %d, got %d", len(migrations), v)
+	}
+}
+
+func TestDeviceAndChats(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if d, err := c.Device(ctx, "UNKNOWN"); d != nil || err != nil {
+		t.Errorf("expected nil device without error, got %#v, %v", d, err)
+	}
+
+	if err := c.AddUser(ctx, "ABC", 42, "franta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddUser(ctx, "UNKNOWN", 43, "pepa"); err != nil {
+		t.Fatal(err)
+	}
+
+	chats, err := c.AllChats(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 1 || chats[0] != 42 {
+		t.Errorf("expected chat 42, got %v", chats)
+	}
+}
+
+func TestHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+	if err := c.SaveHeartbeat(ctx, "ABC", at, 2.95, -3.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveHeartbeat(ctx, "UNKNOWN", at, 2.95, -3.5); err == nil {
+		t.Error("expected error for unknown device")
+	}
+	if err := c.SaveTimestamp(ctx, "ABC", at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.Device(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.LastHeartbeatAt.Equal(at) || !d.LastMessageAt.Equal(at.Add(time.Hour)) || d.Voltage != 2.95 {
+		t.Errorf("unexpected device state %#v", d)
+	}
+
+	info, err := c.DeviceInfo(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.HeartBeats) != 1 || info.HeartBeats[0].Temperature != -3.5 || !info.HeartBeats[0].At.Equal(at) {
+		t.Errorf("unexpected heartbeats %#v", info.HeartBeats)
+	}
+
+	if err := c.SaveHeartbeat(ctx, "ABC", at.Add(24*time.Hour), 2.9, 1); err != nil {
+		t.Fatal(err)
+	}
+	hbs, err := c.Heartbeats(ctx, "ABC", at.Add(time.Minute), at.Add(48*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hbs) != 1 || hbs[0].Voltage != 2.9 {
+		t.Errorf("expected only the second heartbeat, got %#v", hbs)
+	}
+
+	// limit vrací nejnovější heartbeaty, stejně tak DeviceInfo
+	for i := 2; i <= heartbeatLimit+5; i++ {
+		if err := c.SaveHeartbeat(ctx, "ABC", at.Add(time.Duration(i)*24*time.Hour), 3, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hbs, err = c.Heartbeats(ctx, "ABC", time.Time{}, at.AddDate(1, 0, 0), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := at.Add(time.Duration(heartbeatLimit+5) * 24 * time.Hour)
+	if len(hbs) != 3 || !hbs[2].At.Equal(last) || !hbs[0].At.Before(hbs[1].At) {
+		t.Errorf("expected 3 newest heartbeats oldest first, got %#v", hbs)
+	}
+	info, err = c.DeviceInfo(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.HeartBeats) != heartbeatLimit || !info.HeartBeats[heartbeatLimit-1].At.Equal(last) {
+		t.Errorf("DeviceInfo should return newest %d heartbeats, got %d", heartbeatLimit, len(info.HeartBeats))
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	// časy se ukládají v UTC, ale vrací se v soqchi.TZ stejně jako z Firestore - grafy a výpisy
+	// pak ukazují stejný čas bez ohledu na úložiště
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+	_ = c.SaveHeartbeat(ctx, "ABC", at, 2.95, -3.5)
+	_ = c.SaveTimestamp(ctx, "ABC", at.Add(time.Hour))
+	_ = c.SetAccess(ctx, "ABC", true, at.Add(2*time.Hour))
+	_, _ = c.SaveUnclaimed(ctx, &soqchi.Message{DeviceID: "NEW", At: at, Raw: "81"})
+
+	d, err := c.Device(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.DeviceInfo(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hbs, err := c.Heartbeats(ctx, "ABC", at.Add(-time.Hour), at.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unclaimed, err := c.UnclaimedDevices(ctx)
+	if err != nil || len(info.HeartBeats) != 1 || len(hbs) != 1 || len(unclaimed) != 1 {
+		t.Fatalf("unexpected data %#v %#v %#v %v", info, hbs, unclaimed, err)
+	}
+
+	for name, tm := range map[string]time.Time{
+		"LastMessageAt":      d.LastMessageAt,
+		"LastHeartbeatAt":    d.LastHeartbeatAt,
+		"AccessAllowedUntil": d.AccessAllowedUntil,
+		"DeviceInfo":         info.HeartBeats[0].At,
+		"Heartbeats":         hbs[0].At,
+		"FirstSeenAt":        unclaimed[0].FirstSeenAt,
+		"LastSeenAt":         unclaimed[0].LastSeenAt,
+	} {
+		if tm.Location() != soqchi.TZ {
+			t.Errorf("%s: expected location %s, got %s", name, soqchi.TZ, tm.Location())
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+	for i, flags := range []byte{0x81, 0x40, 0x20} {
+		seq := 100 + i
+		msg := &soqchi.Message{DeviceID: "ABC", At: at.Add(time.Duration(i) * time.Hour), Raw: "81", Flags: flags, Ack: i == 0, Temp: -1.5,
+			SeqNumber: &seq, RSSI: -118.5, Station: "1F2A"}
+		if err := c.SaveMessage(ctx, msg, "0100000000000000"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := c.Messages(ctx, "ABC", at, at.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %#v", msgs)
+	}
+	if m := msgs[0]; !m.Alarm() || !m.DoorOpen() || !m.Ack || m.Downlink != "0100000000000000" || m.Temp != -1.5 || !m.At.Equal(at) {
+		t.Errorf("unexpected message %#v", m)
+	}
+	if m := msgs[1]; m.SeqNumber == nil || *m.SeqNumber != 101 || m.RSSI != -118.5 || m.Station != "1F2A" {
+		t.Errorf("unexpected radio metadata %#v", m)
+	}
+}
+
+func TestRegisterFrame(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+
+	for i, exp := range []bool{true, false} {
+		first, err := c.RegisterFrame(ctx, "ABC", "1645353000-81", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != exp {
+			t.Errorf("registration %d: expected %v, got %v", i, exp, first)
+		}
+	}
+
+	if err := c.ReleaseFrame(ctx, "ABC", "1645353000-81"); err != nil {
+		t.Fatal(err)
+	}
+	if first, _ := c.RegisterFrame(ctx, "ABC", "1645353000-81", at); !first {
+		t.Error("released frame should be registered again")
+	}
+
+	// evidence starší než frameRetention se při registraci dalšího framu smaže
+	if _, err := c.RegisterFrame(ctx, "ABC", "1645957800-82", at.Add(frameRetention+time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM frames`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected old frames to be pruned, got %d (%v)", n, err)
+	}
+}
+
+func TestUnclaimed(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	at := time.Date(2022, 2, 20, 10, 30, 0, 0, time.UTC)
+
+	// opakovaná první zpráva je stále první
+	for i, exp := range []bool{true, true, false} {
+		first, err := c.SaveUnclaimed(ctx, &soqchi.Message{DeviceID: "NEW", At: at.Add(time.Duration(i/2) * time.Hour), Raw: "81"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != exp {
+			t.Errorf("message %d: expected first %v, got %v", i, exp, first)
+		}
+	}
+
+	devices, err := c.UnclaimedDevices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Count != 3 || !devices[0].LastSeenAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("unexpected unclaimed devices %#v", devices)
+	}
+
+	if ok, err := c.ClaimDevice(ctx, "NEW", "garáž"); !ok || err != nil {
+		t.Fatalf("claim failed: %v, %v", ok, err)
+	}
+	if ok, _ := c.ClaimDevice(ctx, "NEW", "garáž"); ok {
+		t.Error("device claimed twice")
+	}
+	if d, _ := c.Device(ctx, "NEW"); d == nil || d.Name != "garáž" {
+		t.Errorf("unexpected claimed device %#v", d)
+	}
+}
+
+func TestSetAccess(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	until := time.Date(2022, 2, 20, 12, 30, 0, 0, time.UTC)
+
+	if err := c.SetAccess(ctx, "ABC", true, until); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.Device(ctx, "ABC"); !d.AccessAllowed || !d.AccessAllowedUntil.Equal(until) {
+		t.Errorf("unexpected access %#v", d)
+	}
+
+	if err := c.SetAccess(ctx, "ABC", false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.Device(ctx, "ABC"); d.AccessAllowed || !d.AccessAllowedUntil.IsZero() {
+		t.Errorf("unexpected access %#v", d)
+	}
+}
+
+func TestAccessWindows(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	windows := soqchi.AccessSchedule{{Weekday: time.Tuesday, From: 540, To: 720, Note: "úklid"}}
+	if err := c.SetAccessWindows(ctx, "ABC", windows); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.Device(ctx, "ABC"); len(d.AccessWindows) != 1 || d.AccessWindows[0] != windows[0] {
+		t.Errorf("unexpected windows %#v", d.AccessWindows)
+	}
+
+	if err := c.SetAccessWindows(ctx, "ABC", nil); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.Device(ctx, "ABC"); len(d.AccessWindows) != 0 {
+		t.Errorf("unexpected windows %#v", d.AccessWindows)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if d, _ := c.Device(ctx, "ABC"); d.Thresholds.HeartbeatInterval != 0 || d.Thresholds.TempMin != nil {
+		t.Errorf("expected default thresholds, got %#v", d.Thresholds)
+	}
+
+	tmin := -5.0
+	th := soqchi.Thresholds{HeartbeatInterval: 12 * time.Hour, VoltageLow: 3.3, VoltageCritical: 3.1, TempMin: &tmin,
+		TempHysteresis: 0.5}
+	if err := c.SetThresholds(ctx, "ABC", th); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := c.Device(ctx, "ABC")
+	got := d.Thresholds
+	if got.HeartbeatInterval != th.HeartbeatInterval || got.HeartbeatGrace != 0 || got.VoltageLow != 3.3 ||
+		got.VoltageCritical != 3.1 || got.TempMin == nil || *got.TempMin != tmin || got.TempMax != nil ||
+		got.TempHysteresis != 0.5 {
+		t.Errorf("unexpected thresholds %#v", got)
+	}
+
+	if err := c.SetThresholds(ctx, "XYZ", th); err == nil {
+		t.Error("expected error for unknown device")
+	}
+}
+
+func TestAlertStates(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if states, err := c.AlertStates(ctx, "ABC"); err != nil || len(states) != 0 {
+		t.Fatalf("expected no alert states, got %#v, %v", states, err)
+	}
+
+	at := time.Date(2022, 2, 20, 8, 0, 0, 0, soqchi.TZ)
+	st := soqchi.AlertState{Condition: soqchi.AlertLowVoltage}
+	st.Update(true, at, 0)
+	if err := c.SaveAlertState(ctx, "ABC", st); err != nil {
+		t.Fatal(err)
+	}
+	st.Update(false, at.Add(time.Hour), 0)
+	if err := c.SaveAlertState(ctx, "ABC", st); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := c.AlertStates(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Firing || !states[0].Since.Equal(at) || !states[0].ResolvedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("unexpected alert states %#v", states)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	at := time.Date(2022, 2, 20, 8, 0, 0, 0, soqchi.TZ)
+	for i, s := range []soqchi.Subscription{
+		{Channel: soqchi.ChannelNtfy, Address: "chata", CreatedBy: 42, CreatedAt: at.Add(time.Hour)},
+		{Channel: soqchi.ChannelEmail, Address: "babicka@example.com", CreatedBy: 42, CreatedAt: at},
+		// opakované přidání odběr jen aktualizuje
+		{Channel: soqchi.ChannelNtfy, Address: "chata", Secret: "tajne", CreatedBy: 43, CreatedAt: at.Add(2 * time.Hour)},
+	} {
+		if err := c.AddSubscription(ctx, "ABC", s); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+	}
+
+	subs, err := c.Subscriptions(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 || subs[0].Address != "babicka@example.com" || subs[1].CreatedBy != 43 || subs[1].Secret != "tajne" ||
+		!subs[0].CreatedAt.Equal(at) {
+		t.Errorf("unexpected subscriptions %#v", subs)
+	}
+
+	if ok, err := c.RemoveSubscription(ctx, "ABC", soqchi.ChannelEmail, "babicka@example.com"); err != nil || !ok {
+		t.Errorf("expected subscription to be removed, got %v, %v", ok, err)
+	}
+	if ok, err := c.RemoveSubscription(ctx, "ABC", soqchi.ChannelEmail, "babicka@example.com"); err != nil || ok {
+		t.Errorf("expected missing subscription, got %v, %v", ok, err)
+	}
+	if subs, err := c.Subscriptions(ctx, "ABC"); err != nil || len(subs) != 1 {
+		t.Errorf("expected 1 subscription, got %#v, %v", subs, err)
+	}
+}
+
+func TestMigrateWebhookSecret(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	// databáze před migrací 16 s webhookem bez klíče podpisu
+	for _, q := range []string{
+		`ALTER TABLE subscriptions DROP COLUMN secret`,
+		`DELETE FROM schema_version WHERE version = 16`,
+		`INSERT INTO subscriptions (device_id, channel, address, created_by, created_at) VALUES
+			('ABC', 'webhook', 'https://example.com/hook', 42, '2022-02-20 08:00:00'),
+			('ABC', 'ntfy', 'chata', 42, '2022-02-20 08:00:00')`,
+	} {
+		if _, err := c.db.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := migrate(ctx, c.db); err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := c.Subscriptions(ctx, "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range subs {
+		if (s.Channel == soqchi.ChannelWebhook) != (len(s.Secret) == 64) {
+			t.Errorf("unexpected secret of %s: %q", s, s.Secret)
+		}
+	}
+}
+
+func TestChatSettings(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if s, err := c.ChatSettings(ctx, 42); err != nil || s != nil {
+		t.Fatalf("expected no settings, got %#v, %v", s, err)
+	}
+	for _, s := range []soqchi.ChatSettings{
+		{ChatID: 42, Lang: "en", TimeZone: "Europe/London"},
+		{ChatID: 42, Lang: "cs"},
+	} {
+		if err := c.SaveChatSettings(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, err := c.ChatSettings(ctx, 42); err != nil || s == nil || *s != (soqchi.ChatSettings{ChatID: 42, Lang: "cs"}) {
+		t.Errorf("unexpected settings %#v, %v", s, err)
+	}
+}
+
+func TestOwnershipAndPending(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if err := c.AddPendingUser(ctx, "ABC", 43, "pepa"); err != nil {
+		t.Fatal(err)
+	}
+	// neschválená žádost vlastnictví nebrání
+	if ok, err := c.ClaimOwnership(ctx, "ABC", 42, "franta"); err != nil || !ok {
+		t.Fatalf("expected ownership, got %v %v", ok, err)
+	}
+	if ok, _ := c.ClaimOwnership(ctx, "ABC", 44, "karel"); ok {
+		t.Fatal("device can have only one owner")
+	}
+	if d, _ := c.Device(ctx, "ABC"); d.OwnerChatID != 42 {
+		t.Errorf("expected owner 42, got %d", d.OwnerChatID)
+	}
+
+	if chats, _ := c.AllChats(ctx, "ABC"); len(chats) != 1 || chats[0] != 42 {
+		t.Fatalf("pending chat must not be listed, got %v", chats)
+	}
+	if ok, err := c.ApproveUser(ctx, "ABC", 43); err != nil || !ok {
+		t.Fatalf("expected approval, got %v %v", ok, err)
+	}
+	if ok, _ := c.ApproveUser(ctx, "ABC", 43); ok {
+		t.Error("approved chat can't be approved again")
+	}
+	if ch, _ := c.Chat(ctx, "ABC", 43); ch == nil || ch.Pending || ch.Username != "pepa" {
+		t.Errorf("unexpected chat %#v", ch)
+	}
+	if devices, err := c.ChatDevices(ctx, 43); err != nil || len(devices) != 1 || devices[0].ID != "ABC" {
+		t.Errorf("expected device ABC for chat 43, got %#v %v", devices, err)
+	}
+
+	if err := c.RemoveUser(ctx, "ABC", 43); err != nil {
+		t.Fatal(err)
+	}
+	if ch, _ := c.Chat(ctx, "ABC", 43); ch != nil {
+		t.Errorf("removed chat should not exist, got %#v", ch)
+	}
+
+	// odhlášený vlastník přestane být vlastníkem
+	if err := c.RemoveUser(ctx, "ABC", 42); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.Device(ctx, "ABC"); d.OwnerChatID != 0 {
+		t.Errorf("unregistered owner must lose ownership, got %d", d.OwnerChatID)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	now := time.Now()
+
+	for _, code := range []string{"VALID", "EXPIRED"} {
+		exp := now.Add(time.Hour)
+		if code == "EXPIRED" {
+			exp = now.Add(-time.Minute)
+		}
+		if err := c.SaveInvite(ctx, &soqchi.Invite{Code: code, DeviceID: "ABC", CreatedBy: 42, CreatedAt: now, ExpiresAt: exp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if inv, err := c.RedeemInvite(ctx, "EXPIRED", 43, "pepa", now); err != nil || inv != nil {
+		t.Fatalf("expired invite must not be redeemed, got %#v %v", inv, err)
+	}
+	inv, err := c.RedeemInvite(ctx, "VALID", 43, "pepa", now)
+	if err != nil || inv == nil || inv.DeviceID != "ABC" || inv.UsedBy != 43 {
+		t.Fatalf("unexpected redeem result %#v %v", inv, err)
+	}
+	if inv, _ := c.RedeemInvite(ctx, "VALID", 44, "karel", now); inv != nil {
+		t.Fatal("invite can be used only once")
+	}
+	if chats, _ := c.AllChats(ctx, "ABC"); len(chats) != 1 || chats[0] != 43 {
+		t.Errorf("expected chat 43 subscribed, got %v", chats)
+	}
+
+	if ok, _ := c.RevokeInvite(ctx, "VALID", now); ok {
+		t.Error("used invite can't be revoked")
+	}
+	if ok, err := c.RevokeInvite(ctx, "EXPIRED", now); err != nil || !ok {
+		t.Errorf("expected revoke, got %v %v", ok, err)
+	}
+	if inv, _ := c.Invite(ctx, "EXPIRED"); inv == nil || inv.RevokedAt.IsZero() {
+		t.Errorf("revocation not recorded: %#v", inv)
+	}
+}
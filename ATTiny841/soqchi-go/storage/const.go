@@ -0,0 +1,15 @@
+package storage
+
+const (
+	// EnvBackend je název proměnné prostředí, která určuje použité úložiště
+	EnvBackend = "STORAGE_BACKEND"
+
+	// EnvSQLitePath je cesta k souboru s SQLite databází
+	EnvSQLitePath = "SQLITE_PATH"
+
+	BackendFirestore = "firestore"
+	BackendSQLite    = "sqlite"
+	BackendMemory    = "memory"
+
+	defaultSQLitePath = "soqchi.db"
+)
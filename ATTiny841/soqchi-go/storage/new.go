@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/ISim/Arduino/soqchigfc/firestore"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/sqlite"
+	"os"
+	"sync"
+)
+
+var (
+	sqliteClient    *sqlite.Client
+	onceSQLite      sync.Once
+	sqliteInitError error
+
+	memoryClient *memory.Client
+	onceMemory   sync.Once
+)
+
+// New vrací úložiště dle konfigurace v proměnné prostředí STORAGE_BACKEND. Bez nastavení se
+// použije Firestore. SQLite databáze a paměťové úložiště se sdílí napříč voláními.
+func New(ctx context.Context) (Storage, error) {
+	switch b := os.Getenv(EnvBackend); b {
+	case "", BackendFirestore:
+		return firestore.New(ctx)
+
+	case BackendSQLite:
+		onceSQLite.Do(func() {
+			path := os.Getenv(EnvSQLitePath)
+			if path == "" {
+				path = defaultSQLitePath
+			}
+			sqliteClient, sqliteInitError = sqlite.New(context.Background(), path)
+		})
+		if sqliteInitError != nil {
+			return nil, fmt.Errorf("sqlite initialization error: %w", sqliteInitError)
+		}
+		return sqliteClient, nil
+
+	case BackendMemory:
+		onceMemory.Do(func() {
+			memoryClient = memory.New()
+		})
+		return memoryClient, nil
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", b)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/firestore"
+	"github.com/ISim/Arduino/soqchigfc/memory"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/sqlite"
+	"time"
+)
+
+// Storage je společné rozhraní úložiště dat pro všechny cloudové funkce. Implementuje ho
+// firestore.Client (produkce na Google Cloudu), sqlite.Client (vlastní server) a memory.Client
+// (testy, běh bez cloudu). Konkrétní úložiště dle konfigurace vrací New.
+type Storage interface {
+	// AddUser přihlásí chat k odběru zpráv ze zařízení. Pokud zařízení neexistuje, nic se
+	// nestane a nevrací se ani chyba
+	AddUser(ctx context.Context, deviceID string, chatID int64, username string) error
+
+	// AddPendingUser zaeviduje žádost chatu o přihlášení k odběru zpráv, kterou musí schválit vlastník
+	AddPendingUser(ctx context.Context, deviceID string, chatID int64, username string) error
+
+	// ApproveUser schválí žádost o přihlášení. Vrací false, pokud žádost neexistuje
+	ApproveUser(ctx context.Context, deviceID string, chatID int64) (bool, error)
+
+	// RemoveUser odhlásí chat od odběru zpráv, případně zruší jeho žádost o přihlášení. Odhlášený
+	// vlastník přestane být vlastníkem zařízení.
+	RemoveUser(ctx context.Context, deviceID string, chatID int64) error
+
+	// ClaimOwnership nastaví chat jako vlastníka zařízení a přihlásí ho k odběru zpráv, ale jen
+	// pokud zařízení dosud nemá vlastníka ani žádný přihlášený chat. Vrací, zda se vlastníkem stal
+	ClaimOwnership(ctx context.Context, deviceID string, chatID int64, username string) (bool, error)
+
+	// Chat vrací přihlášení chatu k zařízení (i neschválené), případně nil
+	Chat(ctx context.Context, deviceID string, chatID int64) (*soqchi.Chat, error)
+
+	// SaveInvite uloží novou pozvánku k zařízení
+	SaveInvite(ctx context.Context, invite *soqchi.Invite) error
+
+	// Invite vrací pozvánku dle kódu, případně nil
+	Invite(ctx context.Context, code string) (*soqchi.Invite, error)
+
+	// RedeemInvite atomicky uplatní platnou pozvánku - označí ji jako použitou a přihlásí chat k odběru
+	// zpráv ze zařízení. Pro neplatnou, použitou či zrušenou pozvánku vrací nil
+	RedeemInvite(ctx context.Context, code string, chatID int64, username string, at time.Time) (*soqchi.Invite, error)
+
+	// RevokeInvite zruší dosud nepoužitou pozvánku. Vrací false, pokud pozvánku už nelze zrušit
+	RevokeInvite(ctx context.Context, code string, at time.Time) (bool, error)
+
+	// Device vrací data zařízení, případně nil, pokud zařízení neexistuje
+	Device(ctx context.Context, deviceID string) (*soqchi.Device, error)
+
+	// AllDevices vrací všechna evidovaná zařízení
+	AllDevices(ctx context.Context) ([]*soqchi.Device, error)
+
+	// SetAccess nastaví, zda je přístup povolen, případně do kdy (nulový until znamená bez omezení)
+	SetAccess(ctx context.Context, deviceID string, allowed bool, until time.Time) error
+
+	// SetAccessWindows nastaví týdenní rozvrh oken s očekávaným přístupem
+	SetAccessWindows(ctx context.Context, deviceID string, windows soqchi.AccessSchedule) error
+
+	// SetThresholds nastaví limity zařízení, podle kterých ho kontroluje watchdog
+	SetThresholds(ctx context.Context, deviceID string, t soqchi.Thresholds) error
+
+	// ChatDevices vrací zařízení, ke kterým je chat přihlášen (bez neschválených žádostí)
+	ChatDevices(ctx context.Context, chatID int64) ([]*soqchi.Device, error)
+
+	// AllChats vrací ID všech chatů přihlášených k odběru zpráv ze zařízení (bez neschválených)
+	AllChats(ctx context.Context, deviceID string) ([]int64, error)
+
+	// SaveHeartbeat uloží heartbeat a aktualizuje poslední hodnoty u zařízení
+	SaveHeartbeat(ctx context.Context, deviceID string, t time.Time, voltage, temperature float64) error
+
+	// SaveTimestamp aktualizuje čas poslední zprávy ze zařízení
+	SaveTimestamp(ctx context.Context, deviceID string, t time.Time) error
+
+	// RegisterFrame zaeviduje frame ze zařízení. Vrací true, pokud je frame s daným klíčem
+	// nový, a false, pokud už byl dříve zaevidován (duplicita)
+	RegisterFrame(ctx context.Context, deviceID, key string, at time.Time) (bool, error)
+
+	// ReleaseFrame zruší evidenci framu, aby ho bylo možné zpracovat znovu
+	ReleaseFrame(ctx context.Context, deviceID, key string) error
+
+	// SaveUnclaimed zaeviduje zprávu z neznámého zařízení. Vrací true, pokud je zpráva první zprávou
+	// zařízení - i při opakovaném zpracování téže zprávy, aby se upozornění dalo poslat znovu
+	SaveUnclaimed(ctx context.Context, msg *soqchi.Message) (bool, error)
+
+	// UnclaimedDevices vrací neznámá zařízení, která posílají zprávy
+	UnclaimedDevices(ctx context.Context) ([]*soqchi.UnclaimedDevice, error)
+
+	// ClaimDevice převezme neznámé zařízení do evidence zařízení pod jménem name. Vrací false,
+	// pokud zařízení mezi neznámými není
+	ClaimDevice(ctx context.Context, deviceID, name string) (bool, error)
+
+	// SaveMessage uloží přijatou zprávu do historie zpráv zařízení spolu s odpovědí (downlink)
+	SaveMessage(ctx context.Context, msg *soqchi.Message, downlink string) error
+
+	// Messages vrací historii zpráv zařízení v intervalu <from, to) seřazenou od nejstarší
+	Messages(ctx context.Context, deviceID string, from, to time.Time) ([]soqchi.LoggedMessage, error)
+
+	// Heartbeats vrací heartbeaty zařízení přijaté v intervalu <from, to) seřazené od nejstaršího. Je-li
+	// limit kladný, vrací nejvýše limit nejnovějších heartbeatů z intervalu
+	Heartbeats(ctx context.Context, deviceID string, from, to time.Time, limit int) (soqchi.Heartbeats, error)
+
+	// AlertStates vrací stavy upozornění watchdogu na podmínky zařízení
+	AlertStates(ctx context.Context, deviceID string) ([]soqchi.AlertState, error)
+
+	// SaveAlertState uloží stav upozornění na podmínku zařízení
+	SaveAlertState(ctx context.Context, deviceID string, state soqchi.AlertState) error
+
+	// AddSubscription přidá odběr zpráv ze zařízení v jiném kanálu než Telegram, stejný odběr přepíše
+	AddSubscription(ctx context.Context, deviceID string, sub soqchi.Subscription) error
+
+	// RemoveSubscription zruší odběr zpráv ze zařízení. Vrací false, pokud odběr neexistuje
+	RemoveSubscription(ctx context.Context, deviceID string, channel soqchi.Channel, address string) (bool, error)
+
+	// Subscriptions vrací odběry zpráv ze zařízení v dalších kanálech seřazené podle času přidání
+	Subscriptions(ctx context.Context, deviceID string) ([]soqchi.Subscription, error)
+
+	// ChatSettings vrací nastavení chatu (jazyk, časová zóna), případně nil, pokud chat nic nenastavil
+	ChatSettings(ctx context.Context, chatID int64) (*soqchi.ChatSettings, error)
+
+	// SaveChatSettings uloží nastavení chatu
+	SaveChatSettings(ctx context.Context, s soqchi.ChatSettings) error
+
+	// DeviceInfo vrací posledních 60 heartbeatů zařízení
+	DeviceInfo(ctx context.Context, deviceID string) (*soqchi.DeviceInfo, error)
+}
+
+var (
+	_ Storage = (*firestore.Client)(nil)
+	_ Storage = (*memory.Client)(nil)
+	_ Storage = (*sqlite.Client)(nil)
+)
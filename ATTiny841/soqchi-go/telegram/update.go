@@ -27,15 +27,83 @@ func NewUpdate(r io.Reader) (*Update, error) {
 // Command vrátí příkaz zaslaný botovi a zbytek argumentů jako string. Pokud
 // update nebyl command, vrací prázdné řetězce
 func (u *Update) Command() (string, string) {
+	if u.u.Message == nil {
+		return "", ""
+	}
 	return u.u.Message.Command(), u.u.Message.CommandArguments()
 }
 
 func (u *Update) FromUser() string {
-	return u.u.Message.Chat.UserName
+	switch {
+	case u.u.Message != nil:
+		return u.u.Message.Chat.UserName
+	case u.u.CallbackQuery != nil && u.u.CallbackQuery.From != nil:
+		return u.u.CallbackQuery.From.UserName
+	}
+	return ""
 }
 
 func (u *Update) ChatID() int64 {
-	return u.u.Message.Chat.ID
+	switch {
+	case u.u.Message != nil:
+		return u.u.Message.Chat.ID
+	case u.u.CallbackQuery != nil && u.u.CallbackQuery.Message != nil:
+		return u.u.CallbackQuery.Message.Chat.ID
+	}
+	return 0
+}
+
+// CallbackData vrátí data tlačítka, které uživatel stiskl. Pokud update nebyl stisk
+// tlačítka, vrací prázdný řetězec
+func (u *Update) CallbackData() string {
+	if u.u.CallbackQuery == nil {
+		return ""
+	}
+	return u.u.CallbackQuery.Data
+}
+
+// AnswerCallback potvrdí Telegramu zpracování stisku tlačítka, text se uživateli zobrazí jako notifikace
+func (u *Update) AnswerCallback(text string) error {
+	if u.u.CallbackQuery == nil {
+		return nil
+	}
+	_, err := botAPI.AnswerCallbackQuery(tba.NewCallback(u.u.CallbackQuery.ID, text))
+	return err
+}
+
+// RemoveButtons odstraní tlačítka ze zprávy, pod kterou uživatel tlačítko stiskl
+func (u *Update) RemoveButtons() error {
+	if u.u.CallbackQuery == nil || u.u.CallbackQuery.Message == nil {
+		return nil
+	}
+	m := u.u.CallbackQuery.Message
+	_, err := botAPI.Send(tba.NewEditMessageReplyMarkup(m.Chat.ID, m.MessageID,
+		tba.InlineKeyboardMarkup{InlineKeyboard: [][]tba.InlineKeyboardButton{}}))
+	return err
+}
+
+func (s *Update) SendText(chatID int64, msg string) error {
+	tMsg := tba.NewMessage(chatID, msg)
+	_, err := botAPI.Send(tMsg)
+	return err
+}
+
+// Button je tlačítko pod zprávou, po jeho stisku přijde botovi update s Data
+type Button struct {
+	Text string
+	Data string
+}
+
+// SendButtons pošle zprávu s řadou tlačítek
+func (s *Update) SendButtons(chatID int64, msg string, buttons ...Button) error {
+	var row []tba.InlineKeyboardButton
+	for _, b := range buttons {
+		row = append(row, tba.NewInlineKeyboardButtonData(b.Text, b.Data))
+	}
+	tMsg := tba.NewMessage(chatID, msg)
+	tMsg.ReplyMarkup = tba.NewInlineKeyboardMarkup(row)
+	_, err := botAPI.Send(tMsg)
+	return err
 }
 
 func (s *Update) SendImage(chatID int64, name string, img io.Reader, size int64) error {
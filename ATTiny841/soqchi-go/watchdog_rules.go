@@ -0,0 +1,203 @@
+package soqchigfc
+
+import (
+	"context"
+	"github.com/ISim/Arduino/soqchigfc/soqchi"
+	"github.com/ISim/Arduino/soqchigfc/storage"
+	"time"
+)
+
+// lostFramesWindow je nejdelší období, za které se kontrolují ztracené zprávy - jinak se kontroluje
+// období od minulého běhu watchdogu (ten běží jednou denně)
+const lostFramesWindow = 25 * time.Hour
+
+// finding je výsledek vyhodnocení jedné podmínky zařízení
+type finding struct {
+	// condition je podmínka, jejíž stav se eviduje
+	condition soqchi.AlertCondition
+	active    bool
+	// once je jednorázové upozornění, které se pošle pokaždé, když platí - u podmínky se eviduje
+	// jen čas vyhodnocení (NotifiedAt)
+	once bool
+	// event je typ události o změně stavu podmínky, data vrací její data
+	event soqchi.EventType
+	data  func(alert soqchi.Alert) interface{}
+}
+
+// rule je nezávislá kontrola zařízení watchdogem. Vrací nálezy pro podmínky, které lze vyhodnotit -
+// podmínky, které vyhodnotit nelze (např. napětí zařízení, které se dosud neohlásilo), ve výsledku
+// chybí a jejich stav se nemění.
+type rule struct {
+	name  string
+	check func(ctx context.Context, device *soqchi.Device, now time.Time) ([]finding, error)
+}
+
+// rules vrací pravidla, která watchdog vyhodnocuje pro každé zařízení
+func (w *watchdog) rules() []rule {
+	return []rule{
+		{"no heartbeat", w.noHeartbeat},
+		{"stale heartbeat", w.staleHeartbeat},
+		{"voltage", w.voltage},
+		{"temperature", w.temperature},
+		{"battery forecast", w.batteryForecast},
+		{"sequence gaps", w.sequenceGaps},
+	}
+}
+
+// noHeartbeat hlídá zařízení, která dosud neposlala žádný heartbeat
+func (w *watchdog) noHeartbeat(_ context.Context, device *soqchi.Device, _ time.Time) ([]finding, error) {
+	return []finding{{
+		condition: soqchi.AlertNoHeartbeat,
+		active:    device.LastHeartbeatAt.IsZero(),
+		event:     soqchi.EventDeviceSilent,
+		data: func(a soqchi.Alert) interface{} {
+			return soqchi.DeviceSilent{Alert: a, LastMessageAt: device.LastMessageAt}
+		},
+	}}, nil
+}
+
+// staleHeartbeat hlídá, zda heartbeat přišel v intervalu nastaveném u zařízení
+func (w *watchdog) staleHeartbeat(_ context.Context, device *soqchi.Device, now time.Time) ([]finding, error) {
+	if device.LastHeartbeatAt.IsZero() {
+		return nil, nil
+	}
+	return []finding{{
+		condition: soqchi.AlertHeartbeatMissing,
+		active:    device.LastHeartbeatAt.Before(now.Add(-device.Thresholds.HeartbeatWindow())),
+		event:     soqchi.EventDeviceSilent,
+		data: func(a soqchi.Alert) interface{} {
+			return soqchi.DeviceSilent{Alert: a, LastMessageAt: device.LastMessageAt}
+		},
+	}}, nil
+}
+
+// voltage hlídá poslední známé napětí baterie - i u zařízení, které se přestalo ozývat
+func (w *watchdog) voltage(_ context.Context, device *soqchi.Device, _ time.Time) ([]finding, error) {
+	if device.LastHeartbeatAt.IsZero() {
+		return nil, nil
+	}
+	t := device.Thresholds.WithDefaults()
+	critical := device.Voltage < t.VoltageCritical
+	data := func(limit float64) func(a soqchi.Alert) interface{} {
+		return func(a soqchi.Alert) interface{} {
+			return soqchi.LowBattery{Alert: a, Voltage: device.Voltage, Limit: limit}
+		}
+	}
+	findings := []finding{{
+		condition: soqchi.AlertCriticalVoltage,
+		active:    critical,
+		event:     soqchi.EventLowBattery,
+		data:      data(t.VoltageCritical),
+	}}
+	if !critical {
+		// při kritickém napětí se upozornění na nízké napětí neposílá ani neukončuje
+		findings = append(findings, finding{
+			condition: soqchi.AlertLowVoltage,
+			active:    device.Voltage < t.VoltageLow,
+			event:     soqchi.EventLowBattery,
+			data:      data(t.VoltageLow),
+		})
+	}
+	return findings, nil
+}
+
+// temperature hlídá teplotu z posledního heartbeatu stejně jako příjem zpráv a se stejným stavem
+// upozornění - zachytí např. změnu limitů nebo upozornění, které se při příjmu zprávy nepodařilo odeslat.
+// Heartbeat starší než poslední změna stavu se nevyhodnocuje, stav už určila novější zpráva.
+func (w *watchdog) temperature(ctx context.Context, device *soqchi.Device, now time.Time) ([]finding, error) {
+	t := device.Thresholds
+	if t.TempMin == nil && t.TempMax == nil {
+		return nil, nil
+	}
+	hbs, err := w.storage.Heartbeats(ctx, device.ID, time.Time{}, now, 1)
+	if err != nil || len(hbs) == 0 {
+		return nil, err
+	}
+	hb := hbs[len(hbs)-1]
+	states, err := alertStates(ctx, w.storage, device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []finding
+	for _, c := range temperatureChecks(t, hb.Temperature, states) {
+		if hb.At.Before(c.state.Since) || hb.At.Before(c.state.ResolvedAt) {
+			continue
+		}
+		limit := c.limit
+		findings = append(findings, finding{
+			condition: c.state.Condition,
+			active:    c.active,
+			event:     soqchi.EventTemperature,
+			data: func(a soqchi.Alert) interface{} {
+				return soqchi.Temperature{Alert: a, Temperature: hb.Temperature, Limit: limit}
+			},
+		})
+	}
+	return findings, nil
+}
+
+// batteryForecast hlídá, zda napětí baterie podle trendu neklesne pod limit během batteryWarnDays
+// dní. U zařízení, které už má nízké napětí, se odhad nevyhodnocuje.
+func (w *watchdog) batteryForecast(ctx context.Context, device *soqchi.Device, now time.Time) ([]finding, error) {
+	if device.LastHeartbeatAt.IsZero() || device.Voltage < device.Thresholds.WithDefaults().VoltageLow {
+		return nil, nil
+	}
+	f, ok, err := predictBattery(ctx, w.storage, device, now)
+	if err != nil || !ok {
+		return nil, err
+	}
+	days, ok := f.DaysLeft(now)
+	return []finding{{
+		condition: soqchi.AlertBatteryForecast,
+		active:    ok && days <= w.batteryWarnDays,
+		event:     soqchi.EventLowBattery,
+		data: func(a soqchi.Alert) interface{} {
+			return soqchi.LowBattery{Alert: a, Voltage: device.Voltage, Limit: f.Limit, LimitAt: f.LimitAt,
+				DaysLeft: days, WarnDays: w.batteryWarnDays}
+		},
+	}}, nil
+}
+
+// predictBattery odhadne vývoj napětí baterie z heartbeatů za posledních batteryTrendDays dní
+func predictBattery(ctx context.Context, s storage.Storage, device *soqchi.Device, now time.Time) (*soqchi.BatteryForecast, bool, error) {
+	hbs, err := s.Heartbeats(ctx, device.ID, now.AddDate(0, 0, -batteryTrendDays), now, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	f, ok := soqchi.PredictBattery(hbs, device.Thresholds.WithDefaults().VoltageLow)
+	return f, ok, nil
+}
+
+// sequenceGaps upozorní na zprávy ztracené od minulé kontroly - pozná se podle mezer v sekvenčních
+// číslech zpráv. Čas minulé kontroly je v uloženém stavu podmínky AlertFramesLost, každá mezera se
+// tak hlásí jen jednou.
+func (w *watchdog) sequenceGaps(ctx context.Context, device *soqchi.Device, now time.Time) ([]finding, error) {
+	states, err := w.storage.AlertStates(ctx, device.ID)
+	if err != nil {
+		return nil, err
+	}
+	from := now.Add(-lostFramesWindow)
+	for _, st := range states {
+		if st.Condition == soqchi.AlertFramesLost && st.NotifiedAt.After(from) {
+			from = st.NotifiedAt
+		}
+	}
+
+	// zprávy před from odhalí mezeru hned na začátku období
+	msgs, err := w.storage.Messages(ctx, device.ID, from.Add(-lostFramesWindow), now)
+	if err != nil {
+		return nil, err
+	}
+
+	lost := soqchi.LostFramesSince(msgs, from)
+	return []finding{{
+		condition: soqchi.AlertFramesLost,
+		active:    lost > 0,
+		once:      true,
+		event:     soqchi.EventFramesLost,
+		data: func(soqchi.Alert) interface{} {
+			return soqchi.FramesLost{Lost: lost, Since: from}
+		},
+	}}, nil
+}